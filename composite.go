@@ -0,0 +1,164 @@
+package postgresql_helper
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/songzhibin97/postgresql_helper/types"
+)
+
+// Composite 复合类型或 ROW(...) 列的扫描目标，按定义顺序保存各字段的文本值，NULL 字段的 Valid 为 false
+// lib/pq 以文本形式返回复合类型（如 (1,"hello, world",,t)），可直接作为 Scan / Get 的目标或结构体字段类型，
+// 再通过 Decode 转换为具体类型；嵌套的复合字段可以继续解码到 *Composite
+type Composite []sql.NullString
+
+// Scan 实现 sql.Scanner，解析复合类型的文本表示
+func (c *Composite) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("%w: cannot scan %T into Composite", types.ErrInvalidStructure, src)
+	}
+
+	fields, err := parseComposite(text)
+	if err != nil {
+		return err
+	}
+	*c = fields
+	return nil
+}
+
+// Decode 将各字段依次转换到 dest 指向的变量，dest 数量须与字段数一致
+// 支持 sql.Scanner（包括 *Composite、*sql.NullString 等）以及字符串、整数、浮点数、布尔类型的指针；
+// 非 Scanner 目标遇到 NULL 字段时，指针的指针（如 **string）置为 nil，其余返回错误
+func (c Composite) Decode(dest ...interface{}) error {
+	if len(dest) != len(c) {
+		return fmt.Errorf("%w: composite has %d fields, got %d destinations", types.ErrInvalidStructure, len(c), len(dest))
+	}
+	for i, d := range dest {
+		if err := decodeCompositeField(c[i], d); err != nil {
+			return fmt.Errorf("decode composite field %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// decodeCompositeField 将单个字段的文本值写入 dest
+func decodeCompositeField(field sql.NullString, dest interface{}) error {
+	if scanner, ok := dest.(sql.Scanner); ok {
+		if !field.Valid {
+			return scanner.Scan(nil)
+		}
+		return scanner.Scan([]byte(field.String))
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("%w: destination must be a non-nil pointer, got %T", types.ErrInvalidStructure, dest)
+	}
+	v = v.Elem()
+	if v.Kind() == reflect.Ptr {
+		if !field.Valid {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if !field.Valid {
+		return fmt.Errorf("%w: NULL value for non-nullable %s", types.ErrInvalidStructure, v.Type())
+	}
+
+	text := field.String
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		// 复合类型中的布尔值输出为 t / f
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("%w: unsupported destination type %s", types.ErrInvalidStructure, v.Type())
+	}
+	return nil
+}
+
+// parseComposite 解析复合类型的文本输出：字段以逗号分隔，未加引号的空字段为 NULL，
+// 引号内的 "" 与 \" 表示双引号，反斜杠转义下一个字符
+func parseComposite(text string) ([]sql.NullString, error) {
+	if len(text) < 2 || text[0] != '(' || text[len(text)-1] != ')' {
+		return nil, fmt.Errorf("%w: invalid composite value %q", types.ErrInvalidStructure, text)
+	}
+	inner := text[1 : len(text)-1]
+
+	var fields []sql.NullString
+	var sb strings.Builder
+	quoted, inQuotes, escaped := false, false, false
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case escaped:
+			sb.WriteByte(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case inQuotes && c == '"':
+			if i+1 < len(inner) && inner[i+1] == '"' {
+				sb.WriteByte('"')
+				i++
+			} else {
+				inQuotes = false
+			}
+		case inQuotes:
+			sb.WriteByte(c)
+		case c == '"':
+			inQuotes, quoted = true, true
+		case c == ',':
+			fields = append(fields, compositeField(sb.String(), quoted))
+			sb.Reset()
+			quoted = false
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if inQuotes || escaped {
+		return nil, fmt.Errorf("%w: unterminated composite value %q", types.ErrInvalidStructure, text)
+	}
+	return append(fields, compositeField(sb.String(), quoted)), nil
+}
+
+// compositeField 未加引号的空字段表示 NULL，"" 表示空字符串
+func compositeField(value string, quoted bool) sql.NullString {
+	return sql.NullString{String: value, Valid: quoted || value != ""}
+}
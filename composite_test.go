@@ -0,0 +1,79 @@
+package postgresql_helper
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/songzhibin97/postgresql_helper/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComposite_Scan(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("decode composite column", func(t *testing.T) {
+		type userAddress struct {
+			ID      int64     `db:"id"`
+			Address Composite `db:"address"`
+		}
+
+		mock.ExpectQuery(`^SELECT id, address FROM users$`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "address"}).
+				AddRow(1, []byte(`(42,"hello, world",,t,"say ""hi"" \\ bye","")`)).
+				AddRow(2, nil))
+
+		var rows []userAddress
+		require.NoError(t, query.Raw(ctx, &rows, "SELECT id, address FROM users"))
+		require.Len(t, rows, 2)
+		require.Len(t, rows[0].Address, 6)
+		assert.Nil(t, rows[1].Address, "NULL composite should scan to nil")
+
+		var (
+			number  int
+			street  string
+			zip     *string
+			primary bool
+			note    string
+			empty   sql.NullString
+		)
+		require.NoError(t, rows[0].Address.Decode(&number, &street, &zip, &primary, &note, &empty))
+		assert.Equal(t, 42, number)
+		assert.Equal(t, "hello, world", street)
+		assert.Nil(t, zip, "unquoted empty field is NULL")
+		assert.True(t, primary)
+		assert.Equal(t, `say "hi" \ bye`, note)
+		assert.Equal(t, sql.NullString{String: "", Valid: true}, empty, `"" is an empty string, not NULL`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("nested composite", func(t *testing.T) {
+		var c Composite
+		require.NoError(t, c.Scan(`(1,"(2,""a b"")")`))
+
+		var (
+			id    int64
+			inner Composite
+		)
+		require.NoError(t, c.Decode(&id, &inner))
+		assert.Equal(t, int64(1), id)
+		assert.Equal(t, Composite{{String: "2", Valid: true}, {String: "a b", Valid: true}}, inner)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var c Composite
+		assert.ErrorIs(t, c.Scan("1,2"), types.ErrInvalidStructure)
+		assert.ErrorIs(t, c.Scan(`("abc)`), types.ErrInvalidStructure)
+		assert.ErrorIs(t, c.Scan(42), types.ErrInvalidStructure)
+
+		require.NoError(t, c.Scan("(,x)"))
+		var a, b string
+		assert.ErrorIs(t, c.Decode(&a), types.ErrInvalidStructure, "field count mismatch")
+		assert.ErrorIs(t, c.Decode(&a, &b), types.ErrInvalidStructure, "NULL into non-nullable")
+	})
+}
@@ -3,14 +3,19 @@ package postgresql_helper
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/lib/pq"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
 	"github.com/songzhibin97/postgresql_helper/types"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,6 +25,7 @@ var (
 	_totalOperCount  *prometheus.CounterVec
 	_totalErrorCount *prometheus.CounterVec
 	_operDuration    *prometheus.HistogramVec
+	_txOperCount     *prometheus.CounterVec
 )
 
 func init() {
@@ -45,7 +51,17 @@ func init() {
 		Buckets:   []float64{0.02, 0.04, 0.06, 0.08, 0.1, 0.3, 0.5, 0.7, 1, 5, 10, 20, 30, 60},
 	}, []string{"collection", "operation"})
 
-	prometheus.DefaultRegisterer.MustRegister(_totalOperCount, _totalErrorCount, _operDuration)
+	// 事务内执行的操作计数，名称固定为 pgsql_helper_tx_operate_count，便于排查锁问题时与自动提交操作对比
+	// 按调用时 ctx 是否携带 InTx 事务计数：Table 的方法与 Query 构建器的 GetAll / Count 等即使在 InTx 内
+	// 也使用连接池执行，同样计入，因此该值是事务内实际执行语句数的上限
+	_txOperCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "pgsql_helper",
+		Name:      "tx_operate_count",
+		Help: "DB operation count issued inside an InTx callback; Table and Query builder operations " +
+			"are counted even though they run on the pool, so this is an upper bound of statements executed on the transaction",
+	}, []string{"collection", "operation"})
+
+	prometheus.DefaultRegisterer.MustRegister(_totalOperCount, _totalErrorCount, _operDuration, _txOperCount)
 }
 
 type oper string
@@ -61,6 +77,13 @@ var (
 	ErrForeignKeyViolation = errors.New("foreign key violation")
 	ErrUniqueViolation     = errors.New("unique violation")
 	ErrCheckViolation      = errors.New("check constraint violation")
+
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	ErrMigrationTimeout = errors.New("migration timed out")
+
+	ErrNoMigrationsRegistered = errors.New("no migrations registered")
+	ErrNoRowsInserted         = errors.New("no rows inserted")
+	ErrRowLimitExceeded       = errors.New("row limit exceeded")
 )
 
 const (
@@ -79,6 +102,10 @@ func collectOperCount(collection string, op oper) {
 	_totalOperCount.WithLabelValues(collection, string(op)).Inc()
 }
 
+func collectTxOperCount(collection string, op oper) {
+	_txOperCount.WithLabelValues(collection, string(op)).Inc()
+}
+
 func collectErrorCount(collection string, op oper) {
 	_totalErrorCount.WithLabelValues(collection, string(op)).Inc()
 }
@@ -90,8 +117,18 @@ func collectOperDuration(collection string, op oper, duration time.Duration) {
 var _ types.DB = (*DB)(nil)
 
 type DB struct {
-	db   *sqlx.DB
-	name string
+	db          *sqlx.DB
+	name        string
+	fieldMapper func(string) string // 未标记 db 标签字段的列名映射，nil 表示必须显式标记
+	cache       types.Cache         // 查询结果缓存，nil 表示不缓存
+
+	maxRowsWithoutLimit int // 未设置 LIMIT 的 GetAll 最多返回的行数，0 表示不限制
+
+	logger *slog.Logger // 操作日志，nil 表示不记录
+
+	indexNaming NamingStrategy // CreateIndex 未指定名称时的命名规则，nil 表示使用 DefaultIndexName
+
+	searchPathStmt string // 新建连接时执行的 SET search_path 语句，DISCARD ALL 后需重新执行；为空表示未配置
 }
 
 // 添加错误包装函数到 DB 结构体
@@ -106,13 +143,13 @@ func (p DB) wrapError(err error, operation string) error {
 	if ok {
 		switch pgErr.Code {
 		case "23505": // 唯一约束冲突
-			return fmt.Errorf("%w: %s - %s", ErrUniqueViolation, operation, pgErr.Detail)
+			return constraintErrorf(ErrUniqueViolation, operation, pgErr)
 		case "23503": // 外键冲突
-			return fmt.Errorf("%w: %s - %s", ErrForeignKeyViolation, operation, pgErr.Detail)
+			return constraintErrorf(ErrForeignKeyViolation, operation, pgErr)
 		case "23514": // CHECK约束冲突
-			return fmt.Errorf("%w: %s - %s", ErrCheckViolation, operation, pgErr.Detail)
+			return constraintErrorf(ErrCheckViolation, operation, pgErr)
 		case "23000": // 完整性约束冲突
-			return fmt.Errorf("%w: %s - %s", ErrConstraintViolation, operation, pgErr.Detail)
+			return constraintErrorf(ErrConstraintViolation, operation, pgErr)
 		case "42501": // 权限不足
 			return fmt.Errorf("%w: %s", ErrPermissionDenied, operation)
 		case "57014": // 查询取消
@@ -128,6 +165,38 @@ func (p DB) wrapError(err error, operation string) error {
 	return fmt.Errorf("%s: %w", operation, err)
 }
 
+// constraintError 约束冲突错误，保留被违反的约束名
+type constraintError struct {
+	err        error
+	constraint string
+}
+
+func (e *constraintError) Error() string { return e.err.Error() }
+func (e *constraintError) Unwrap() error { return e.err }
+
+// constraintErrorf 包装约束冲突错误，约束名存在时追加到错误信息中
+func constraintErrorf(sentinel error, operation string, pgErr *pq.Error) error {
+	err := fmt.Errorf("%w: %s - %s", sentinel, operation, pgErr.Detail)
+	if pgErr.Constraint != "" {
+		err = fmt.Errorf("%w (constraint %s)", err, pgErr.Constraint)
+	}
+	return &constraintError{err: err, constraint: pgErr.Constraint}
+}
+
+// ConstraintName 返回错误对应的被违反约束（或唯一索引）名，无法确定时返回空字符串
+// 可用于 wrapError 包装后的约束冲突错误，也可用于原始 *pq.Error
+func ConstraintName(err error) string {
+	var cErr *constraintError
+	if errors.As(err, &cErr) {
+		return cErr.constraint
+	}
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return pgErr.Constraint
+	}
+	return ""
+}
+
 func (p DB) Table(ctx context.Context, tableName string) types.Table {
 	return &Table{DB: &p, name: tableName}
 }
@@ -143,6 +212,59 @@ func (p DB) Ping(ctx context.Context) error {
 	})
 }
 
+// ServerVersion 返回服务端版本的文本形式（如 "15.4"）和数字形式（如 150004），可用于按版本启用特性
+func (p DB) ServerVersion(ctx context.Context) (string, int, error) {
+	var (
+		version    string
+		versionNum string
+	)
+	err := p.withMetrics(ctx, "", queryOper, func(ctx context.Context) error {
+		row := p.db.QueryRowxContext(ctx,
+			"SELECT current_setting('server_version'), current_setting('server_version_num')")
+		return p.wrapError(row.Scan(&version, &versionNum), "get server version")
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	num, err := strconv.Atoi(strings.TrimSpace(versionNum))
+	if err != nil {
+		return "", 0, fmt.Errorf("parse server_version_num %q: %w", versionNum, err)
+	}
+	return version, num, nil
+}
+
+// defaultReadyInterval WaitForReady 未指定间隔时的重试间隔
+const defaultReadyInterval = time.Second
+
+// WaitForReady 循环 Ping 直到数据库可达或 ctx 结束，适用于容器启动时等待数据库就绪
+// interval <= 0 时使用默认间隔 1s；ctx 结束时返回的错误包含最后一次 Ping 的错误
+func (p DB) WaitForReady(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultReadyInterval
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			if lastErr == nil {
+				return fmt.Errorf("wait for database ready: %w", ctx.Err())
+			}
+			return fmt.Errorf("wait for database ready: %w (last error: %v)", ctx.Err(), lastErr)
+		case <-timer.C:
+		}
+
+		if lastErr = p.Ping(ctx); lastErr == nil {
+			return nil
+		}
+		timer.Reset(interval)
+	}
+}
+
 type contextTxKey struct{}
 
 func getTxFromContext(ctx context.Context) *sqlx.Tx {
@@ -157,7 +279,13 @@ func (p DB) InTx(ctx context.Context, fn func(ctx context.Context) error) error
 		return fn(ctx) // 已存在事务，直接执行（禁止嵌套）
 	}
 
-	tx, err := p.db.BeginTxx(ctx, nil)
+	var tx *sqlx.Tx
+	var err error
+	if conn := ConnFromContext(ctx); conn != nil {
+		tx, err = conn.BeginTxx(ctx, nil)
+	} else {
+		tx, err = p.db.BeginTxx(ctx, nil)
+	}
 	if err != nil {
 		return p.wrapError(err, "begin transaction")
 	}
@@ -180,30 +308,297 @@ func (p DB) InTx(ctx context.Context, fn func(ctx context.Context) error) error
 	return p.wrapError(err, "commit transaction")
 }
 
+type contextConnKey struct{}
+
+// ConnFromContext 返回 WithDedicatedConn 绑定到上下文的连接，不存在时返回 nil
+func ConnFromContext(ctx context.Context) *sqlx.Conn {
+	if conn, ok := ctx.Value(contextConnKey{}).(*sqlx.Conn); ok {
+		return conn
+	}
+	return nil
+}
+
+// queryer 返回执行语句的目标：上下文中的事务优先，其次是 WithDedicatedConn 绑定的连接，最后是连接池
+func (p DB) queryer(ctx context.Context) sqlx.QueryerContext {
+	if tx := getTxFromContext(ctx); tx != nil {
+		return tx
+	}
+	if conn := ConnFromContext(ctx); conn != nil {
+		return conn
+	}
+	return p.db
+}
+
+// execer 返回执行写语句的对象，选择顺序与 queryer 相同
+func (p DB) execer(ctx context.Context) sqlx.ExecerContext {
+	if tx := getTxFromContext(ctx); tx != nil {
+		return tx
+	}
+	if conn := ConnFromContext(ctx); conn != nil {
+		return conn
+	}
+	return p.db
+}
+
+// WithDedicatedConn 从连接池取出一条连接并绑定到 ctx 后执行 fn，用于需要会话级 SET（而非 SET LOCAL）后执行原始SQL的场景
+// 只有原始SQL路径会使用该连接：ConnFromContext、DB.Query / QueryNamed、Query.Raw 以及 InTx 开启的事务；
+// Table 的方法与 Query 构建器的 GetAll / Count 等仍从连接池取连接，看不到 fn 内的会话设置。
+// fn 返回后执行 DISCARD ALL 重置会话状态（设置、预编译语句、临时表等）再归还连接，
+// 重置失败时丢弃该连接，保证会话设置不会泄漏给连接池的其他使用者。不能在事务内调用
+func (p DB) WithDedicatedConn(ctx context.Context, fn func(ctx context.Context) error) error {
+	if getTxFromContext(ctx) != nil {
+		return p.wrapError(fmt.Errorf("%w: dedicated connection cannot be acquired inside a transaction",
+			types.ErrInvalidStructure), "acquire dedicated connection")
+	}
+	if ConnFromContext(ctx) != nil {
+		return fn(ctx) // 已绑定连接，直接复用
+	}
+
+	conn, err := p.db.Connx(ctx)
+	if err != nil {
+		return p.wrapError(err, "acquire dedicated connection")
+	}
+	defer conn.Close()
+	defer p.resetSession(ctx, conn)
+
+	return fn(context.WithValue(ctx, contextConnKey{}, conn))
+}
+
+// resetSession 以 DISCARD ALL 重置连接的会话状态，失败时通知连接池丢弃该连接
+// DISCARD ALL 包含 RESET ALL，配置了 SearchPath 时需重新设置 search_path 后才能归还
+func (p DB) resetSession(ctx context.Context, conn *sqlx.Conn) {
+	// ctx 已取消时仍需完成重置
+	resetCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelBackendTimeout)
+	defer cancel()
+	_, err := conn.ExecContext(resetCtx, "DISCARD ALL")
+	if err == nil && p.searchPathStmt != "" {
+		_, err = conn.ExecContext(resetCtx, p.searchPathStmt)
+	}
+	if err != nil {
+		_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
+
+// WithSearchPath 在当前事务内执行 SET LOCAL search_path，事务结束后自动恢复
+// ctx 必须来自 InTx，否则返回 ErrInvalidStructure
+func (p DB) WithSearchPath(ctx context.Context, schemas ...string) error {
+	if len(schemas) == 0 {
+		return p.wrapError(fmt.Errorf("%w: at least one schema is required", types.ErrInvalidStructure), "set search_path")
+	}
+	tx := getTxFromContext(ctx)
+	if tx == nil {
+		return p.wrapError(fmt.Errorf("%w: SET LOCAL requires a transaction", types.ErrInvalidStructure), "set search_path")
+	}
+
+	_, err := tx.ExecContext(ctx, "SET LOCAL search_path TO "+quoteSearchPath(schemas))
+	return p.wrapError(err, "set search_path")
+}
+
 func (p DB) Close() error {
 	return p.db.Close()
 }
 
 func (p DB) Query(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return p.QueryNamed(ctx, "", query, args...)
+}
+
+// QueryNamed 执行原始SQL，并以 name 作为指标的 collection 标签
+// 便于在监控中区分不同的自定义查询（Query 使用空标签）；ctx 中存在事务或专用连接时在其上执行
+func (p DB) QueryNamed(ctx context.Context, name string, query string, args ...interface{}) (*sqlx.Rows, error) {
 	var result *sqlx.Rows
-	err := p.withMetrics(ctx, "", queryOper, func(ctx context.Context) error {
+	err := p.withMetrics(ctx, name, queryOper, func(ctx context.Context) error {
 		var err error
-		result, err = p.db.QueryxContext(ctx, query, args...)
+		result, err = p.queryer(ctx).QueryxContext(ctx, query, args...)
 		return p.wrapError(err, "execute query")
 	})
 	return result, err
 }
 
+// cancelBackendTimeout 发送 pg_cancel_backend 的超时时间
+const cancelBackendTimeout = 5 * time.Second
+
+// DeadlineContext 在一条固定连接上执行 fn，timeout > 0 时为 ctx 附加超时
+// fn 返回前 ctx 被取消或超时时，通过连接池中的另一条连接调用 pg_cancel_backend 终止服务端仍在执行的语句，
+// 并在返回前等待取消请求完成
+//
+// 限制：
+//   - 只有通过 conn 执行的语句会被取消
+//   - lib/pq 自身会在取消时新建连接发送 CancelRequest，但经过代理或网络受限时可能失败，本方法作为补充；
+//     取消仍是尽力而为，语句可能在取消到达前已经结束
+//   - 需要当前角色有权取消该后端（同一角色或 pg_signal_backend），且不适用于 PgBouncer 事务池模式（后端PID不固定）
+//   - 取消请求需要从连接池再取一条连接；MaxOpenConns 为 1 或连接池已满时会等待至 cancelBackendTimeout 后放弃，
+//     服务端语句不会被本方法取消，需为连接池预留空闲连接
+func (p DB) DeadlineContext(ctx context.Context, timeout time.Duration, fn func(ctx context.Context, conn *sqlx.Conn) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return p.withMetrics(ctx, "", queryOper, func(ctx context.Context) error {
+		conn, err := p.db.Connx(ctx)
+		if err != nil {
+			return p.wrapError(err, "acquire connection")
+		}
+		defer conn.Close()
+
+		var pid int
+		if err := conn.GetContext(ctx, &pid, "SELECT pg_backend_pid()"); err != nil {
+			return p.wrapError(err, "get backend pid")
+		}
+
+		finished := make(chan struct{})
+		watcherDone := make(chan struct{})
+		go func() {
+			defer close(watcherDone)
+			select {
+			case <-finished:
+			case <-ctx.Done():
+			}
+			// fn 因取消而提前返回时服务端语句可能仍在执行；对空闲后端发送取消没有副作用
+			if ctx.Err() != nil {
+				p.cancelBackend(pid)
+			}
+		}()
+
+		err = fn(ctx, conn)
+		close(finished)
+		// 等待取消请求结束后再归还连接，避免取消落到后续复用该连接的语句上
+		<-watcherDone
+		return err
+	})
+}
+
+// cancelBackend 请求服务端取消指定后端正在执行的语句，失败时忽略
+func (p DB) cancelBackend(pid int) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelBackendTimeout)
+	defer cancel()
+	_, _ = p.db.ExecContext(ctx, "SELECT pg_cancel_backend($1)", pid)
+}
+
+// PreparedStmt 预编译的命名参数语句，可在循环中重复执行
+// 执行时若上下文中存在事务（InTx），语句在该事务内执行
+type PreparedStmt struct {
+	*DB
+	stmt *sqlx.NamedStmt
+}
+
+// PrepareNamed 预编译使用 :name 命名参数的SQL，使用完毕后需调用 Close
+func (p DB) PrepareNamed(ctx context.Context, query string) (*PreparedStmt, error) {
+	var stmt *sqlx.NamedStmt
+	err := p.withMetrics(ctx, "", queryOper, func(ctx context.Context) error {
+		var err error
+		if tx := getTxFromContext(ctx); tx != nil {
+			stmt, err = tx.PrepareNamedContext(ctx, query)
+		} else {
+			stmt, err = p.db.PrepareNamedContext(ctx, query)
+		}
+		return p.wrapError(err, "prepare named statement")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PreparedStmt{DB: &p, stmt: stmt}, nil
+}
+
+// namedStmt 返回绑定到上下文事务的语句，没有事务时返回原语句
+func (s *PreparedStmt) namedStmt(ctx context.Context) *sqlx.NamedStmt {
+	if tx := getTxFromContext(ctx); tx != nil {
+		return tx.NamedStmtContext(ctx, s.stmt)
+	}
+	return s.stmt
+}
+
+// Exec 以 arg（结构体或映射）绑定参数执行语句
+func (s *PreparedStmt) Exec(ctx context.Context, arg interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := s.withMetrics(ctx, "", queryOper, func(ctx context.Context) error {
+		var err error
+		result, err = s.namedStmt(ctx).ExecContext(ctx, arg)
+		return s.wrapError(err, "execute prepared statement")
+	})
+	return result, err
+}
+
+// Get 执行语句并将单行结果扫描到 dest
+func (s *PreparedStmt) Get(ctx context.Context, dest interface{}, arg interface{}) error {
+	return s.withMetrics(ctx, "", queryOper, func(ctx context.Context) error {
+		err := s.namedStmt(ctx).GetContext(ctx, dest, arg)
+		return s.wrapError(err, "execute prepared statement")
+	})
+}
+
+// Select 执行语句并将多行结果扫描到切片 dest
+func (s *PreparedStmt) Select(ctx context.Context, dest interface{}, arg interface{}) error {
+	return s.withMetrics(ctx, "", queryOper, func(ctx context.Context) error {
+		err := s.namedStmt(ctx).SelectContext(ctx, dest, arg)
+		return s.wrapError(err, "execute prepared statement")
+	})
+}
+
+// Close 释放预编译语句
+func (s *PreparedStmt) Close() error {
+	return s.stmt.Close()
+}
+
 func (p DB) withMetrics(ctx context.Context, collection string, op oper, fn func(context.Context) error) error {
 	collectOperCount(collection, op)
-	start := time.Now()
-	defer func() { collectOperDuration(collection, op, time.Since(start)) }()
+	if getTxFromContext(ctx) != nil {
+		collectTxOperCount(collection, op)
+	}
 
-	if err := fn(ctx); err != nil {
+	var stats *opStats
+	if p.logger != nil {
+		stats = &opStats{}
+		ctx = context.WithValue(ctx, opStatsKey{}, stats)
+	}
+
+	start := time.Now()
+	err := fn(ctx)
+	duration := time.Since(start)
+	collectOperDuration(collection, op, duration)
+	if err != nil {
 		collectErrorCount(collection, op)
-		return err
 	}
-	return nil
+	if p.logger != nil {
+		p.logOperation(ctx, collection, op, duration, stats, err)
+	}
+	return err
+}
+
+type opStatsKey struct{}
+
+// opStats 记录单次操作的附加信息，供日志输出
+type opStats struct {
+	rowsAffected    int64
+	hasRowsAffected bool
+}
+
+// recordRowsAffected 记录当前操作影响的行数，未配置 Logger 时不做任何事
+func recordRowsAffected(ctx context.Context, n int64) {
+	if stats, ok := ctx.Value(opStatsKey{}).(*opStats); ok {
+		stats.rowsAffected = n
+		stats.hasRowsAffected = true
+	}
+}
+
+// logOperation 成功时以 Debug 级别、失败时以 Error 级别记录操作
+func (p DB) logOperation(ctx context.Context, collection string, op oper, duration time.Duration, stats *opStats, err error) {
+	attrs := []slog.Attr{
+		slog.String("operation", string(op)),
+		slog.String("collection", collection),
+		slog.Duration("duration", duration),
+	}
+	if stats.hasRowsAffected {
+		attrs = append(attrs, slog.Int64("rows_affected", stats.rowsAffected))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		p.logger.LogAttrs(ctx, slog.LevelError, "postgresql operation failed", attrs...)
+		return
+	}
+	p.logger.LogAttrs(ctx, slog.LevelDebug, "postgresql operation", attrs...)
 }
 
 // DBConfig 数据库连接配置
@@ -213,6 +608,32 @@ type DBConfig struct {
 	MaxIdleConns    int           // 最大空闲连接数
 	ConnMaxLifetime time.Duration // 连接最大生命周期
 	ConnMaxIdleTime time.Duration // 连接最大空闲时间
+
+	// FieldMapper 将未标记 db 标签的结构体字段名映射为列名（如 SnakeCase）
+	// 为 nil 时保持默认行为：只有显式标记 db 标签的字段参与读写
+	FieldMapper func(string) string
+
+	// Cache 查询结果缓存，配合 Query.Cached 使用；为 nil 时 Cached 不生效
+	Cache types.Cache
+
+	// MaxRowsWithoutLimit 未设置 LIMIT 的 GetAll 查询自动附加的安全上限（默认 0 不启用）
+	// 结果超过上限时 dest 只保留前 MaxRowsWithoutLimit 行，并返回 ErrRowLimitExceeded
+	MaxRowsWithoutLimit int
+
+	// WarmupConns New 时预先建立并放回连接池的连接数，避免首批并发请求都承担建连开销
+	// 不超过 MaxOpenConns；超过 MaxIdleConns 的部分在放回时会被关闭
+	WarmupConns int
+
+	// SearchPath 每条新建连接执行 SET search_path 使用的模式列表，为空时使用服务端默认值
+	// 适用于按模式隔离租户的场景；单个事务内临时切换见 DB.WithSearchPath
+	SearchPath []string
+
+	// Logger 结构化日志：操作成功以 Debug 级别记录，失败以 Error 级别记录，
+	// 属性包括 operation、collection、duration 以及（如有）rows_affected；为 nil 时不记录
+	Logger *slog.Logger
+
+	// IndexNaming CreateIndex 未指定索引名时的命名规则，为 nil 时使用 DefaultIndexName
+	IndexNaming NamingStrategy
 }
 
 // DefaultDBConfig 返回带有合理默认值的配置
@@ -231,12 +652,73 @@ func New(config DBConfig) (*DB, error) {
 		return nil, fmt.Errorf("database DSN is required")
 	}
 
+	if len(config.SearchPath) > 0 {
+		// 通过连接钩子设置 search_path，连接池中的每条连接都会执行
+		connector, err := pq.NewConnector(config.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("connect to database failed: %w", err)
+		}
+		db := sqlx.NewDb(sql.OpenDB(newSearchPathConnector(connector, config.SearchPath)), "postgres")
+		return NewFromSQLX(db, config)
+	}
+
 	// 创建底层sqlx连接
 	db, err := sqlx.Connect("postgres", config.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("connect to database failed: %w", err)
 	}
 
+	return NewFromSQLX(db, config)
+}
+
+// searchPathConnector 在建立连接后立即设置 search_path
+type searchPathConnector struct {
+	driver.Connector
+	stmt string
+}
+
+func newSearchPathConnector(connector driver.Connector, schemas []string) driver.Connector {
+	return &searchPathConnector{
+		Connector: connector,
+		stmt:      searchPathStatement(schemas),
+	}
+}
+
+func (c *searchPathConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("driver connection does not support ExecContext")
+	}
+	if _, err := execer.ExecContext(ctx, c.stmt, nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("set search_path failed: %w", err)
+	}
+	return conn, nil
+}
+
+// searchPathStatement 返回设置连接级 search_path 的语句
+func searchPathStatement(schemas []string) string {
+	return "SET search_path TO " + quoteSearchPath(schemas)
+}
+
+// quoteSearchPath 将模式列表转为以逗号分隔的带引号标识符
+func quoteSearchPath(schemas []string) string {
+	quoted := make([]string, len(schemas))
+	for i, schema := range schemas {
+		quoted[i] = pq.QuoteIdentifier(schema)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// NewFromSQLX 在已建立的 sqlx 连接上应用连接池配置、校验连接并预热连接池
+// 适用于复用已有连接或在测试中接入 sqlmock（见 testhelper 包）；config.DSN 仅用于提取数据库名
+func NewFromSQLX(db *sqlx.DB, config DBConfig) (*DB, error) {
 	// 应用连接池配置
 	if config.MaxOpenConns > 0 {
 		db.SetMaxOpenConns(config.MaxOpenConns)
@@ -257,10 +739,81 @@ func New(config DBConfig) (*DB, error) {
 		return nil, fmt.Errorf("ping database failed: %w", err)
 	}
 
-	return &DB{
-		db:   db,
-		name: extractDatabaseName(config.DSN),
-	}, nil
+	if err := warmupConns(db, config); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("warm up connections failed: %w", err)
+	}
+
+	// 扫描结果时使用相同的字段映射规则
+	if config.FieldMapper != nil {
+		db.Mapper = reflectx.NewMapperFunc("db", config.FieldMapper)
+	}
+
+	p := &DB{
+		db:          db,
+		name:        extractDatabaseName(config.DSN),
+		fieldMapper: config.FieldMapper,
+		cache:       config.Cache,
+
+		maxRowsWithoutLimit: config.MaxRowsWithoutLimit,
+		logger:              config.Logger,
+		indexNaming:         config.IndexNaming,
+	}
+	if len(config.SearchPath) > 0 {
+		p.searchPathStmt = searchPathStatement(config.SearchPath)
+	}
+	return p, nil
+}
+
+// warmupConns 同时持有 WarmupConns 条连接后再全部放回，使其进入空闲池
+func warmupConns(db *sqlx.DB, config DBConfig) error {
+	n := config.WarmupConns
+	if config.MaxOpenConns > 0 && n > config.MaxOpenConns {
+		n = config.MaxOpenConns
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	conns := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		conn, err := db.DB.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+		if err := conn.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SnakeCase 将Go字段名转换为蛇形命名，可用作 DBConfig.FieldMapper
+// 例如: UserID -> user_id, CreatedAt -> created_at
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// 在单词边界插入下划线：小写后接大写，或连续大写后接小写（如 HTTPServer -> http_server）
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1]))) {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
 }
 
 // Connect 使用DSN和默认配置创建数据库连接 (简便方法)
@@ -323,8 +876,58 @@ func (p *DB) AddConnectionStats(register *prometheus.Registry) {
 		},
 	)
 
+	// 等待与回收统计（累计值）
+	waitCountCollector := prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Namespace: "pgsql_helper",
+			Subsystem: "pgsql",
+			Name:      "connections_wait_count_total",
+			Help:      "Total number of connections waited for",
+		},
+		func() float64 {
+			return float64(p.db.Stats().WaitCount)
+		},
+	)
+
+	waitDurationCollector := prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Namespace: "pgsql_helper",
+			Subsystem: "pgsql",
+			Name:      "connections_wait_duration_seconds_total",
+			Help:      "Total time blocked waiting for a new connection",
+		},
+		func() float64 {
+			return p.db.Stats().WaitDuration.Seconds()
+		},
+	)
+
+	maxIdleClosedCollector := prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Namespace: "pgsql_helper",
+			Subsystem: "pgsql",
+			Name:      "connections_max_idle_closed_total",
+			Help:      "Total number of connections closed due to SetMaxIdleConns",
+		},
+		func() float64 {
+			return float64(p.db.Stats().MaxIdleClosed)
+		},
+	)
+
+	maxLifetimeClosedCollector := prometheus.NewCounterFunc(
+		prometheus.CounterOpts{
+			Namespace: "pgsql_helper",
+			Subsystem: "pgsql",
+			Name:      "connections_max_lifetime_closed_total",
+			Help:      "Total number of connections closed due to SetConnMaxLifetime",
+		},
+		func() float64 {
+			return float64(p.db.Stats().MaxLifetimeClosed)
+		},
+	)
+
 	// 注册到指定的注册表
-	register.MustRegister(statsCollector, idleCollector, inUseCollector)
+	register.MustRegister(statsCollector, idleCollector, inUseCollector,
+		waitCountCollector, waitDurationCollector, maxIdleClosedCollector, maxLifetimeClosedCollector)
 }
 
 // GetStats 返回连接池的当前状态
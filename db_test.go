@@ -1,14 +1,26 @@
 package postgresql_helper
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
 	"testing"
 	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/songzhibin97/postgresql_helper/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // 创建一个测试用的DB对象
@@ -75,6 +87,44 @@ func TestDB_WrapError(t *testing.T) {
 	}
 }
 
+func TestConstraintName(t *testing.T) {
+	db := newTestDB()
+
+	t.Run("unique violation", func(t *testing.T) {
+		err := db.wrapError(&pq.Error{
+			Code:       "23505",
+			Detail:     "Key (email)=(a@example.com) already exists.",
+			Constraint: "users_email_key",
+		}, "insert users")
+
+		assert.ErrorIs(t, err, ErrUniqueViolation)
+		assert.Equal(t, "users_email_key", ConstraintName(err))
+		assert.Contains(t, err.Error(), "(constraint users_email_key)")
+
+		// 再次包装后仍可取得约束名
+		wrapped := fmt.Errorf("create account: %w", err)
+		assert.Equal(t, "users_email_key", ConstraintName(wrapped))
+	})
+
+	t.Run("foreign key violation", func(t *testing.T) {
+		err := db.wrapError(&pq.Error{Code: "23503", Constraint: "orders_user_id_fkey"}, "insert orders")
+		assert.ErrorIs(t, err, ErrForeignKeyViolation)
+		assert.Equal(t, "orders_user_id_fkey", ConstraintName(err))
+	})
+
+	t.Run("raw pq error", func(t *testing.T) {
+		assert.Equal(t, "users_pkey", ConstraintName(&pq.Error{Code: "23505", Constraint: "users_pkey"}))
+	})
+
+	t.Run("without constraint", func(t *testing.T) {
+		err := db.wrapError(&pq.Error{Code: "23505", Detail: "Key already exists"}, "insert users")
+		assert.Equal(t, "", ConstraintName(err))
+		assert.NotContains(t, err.Error(), "constraint")
+		assert.Equal(t, "", ConstraintName(errors.New("other")))
+		assert.Equal(t, "", ConstraintName(nil))
+	})
+}
+
 // 测试Table方法
 func TestDB_Table(t *testing.T) {
 	db := newTestDB()
@@ -159,6 +209,171 @@ func TestNewAndConnect(t *testing.T) {
 	})
 }
 
+func TestNew_WarmupConns(t *testing.T) {
+	t.Run("warm up idle pool", func(t *testing.T) {
+		mockDB, _, err := sqlmock.New()
+		require.NoError(t, err, "Failed to create mock database")
+
+		config := DefaultDBConfig()
+		config.WarmupConns = 5
+		db, err := NewFromSQLX(sqlx.NewDb(mockDB, "postgres"), config)
+		require.NoError(t, err)
+		defer db.Close()
+
+		stats := db.GetStats()
+		assert.Equal(t, 5, stats.OpenConnections, "Pool should hold the warmed up connections")
+		assert.Equal(t, 5, stats.Idle, "Warmed up connections should be returned to the pool")
+	})
+
+	t.Run("capped at MaxOpenConns", func(t *testing.T) {
+		mockDB, _, err := sqlmock.New()
+		require.NoError(t, err, "Failed to create mock database")
+
+		config := DefaultDBConfig()
+		config.MaxOpenConns = 3
+		config.WarmupConns = 10
+		db, err := NewFromSQLX(sqlx.NewDb(mockDB, "postgres"), config)
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, 3, db.GetStats().OpenConnections)
+	})
+}
+
+// dsnConnector 以固定DSN打开驱动连接，用于测试连接钩子
+type dsnConnector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.drv }
+
+func TestSearchPathConnector(t *testing.T) {
+	mockDB, mock, err := sqlmock.NewWithDSN("search_path_test")
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	connector := newSearchPathConnector(dsnConnector{dsn: "search_path_test", drv: mockDB.Driver()},
+		[]string{"tenant_a", "public"})
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	mock.ExpectExec(`SET search_path TO "tenant_a", "public"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"?column?"}).AddRow(1))
+
+	var one int
+	require.NoError(t, db.QueryRow("SELECT 1").Scan(&one))
+	assert.Equal(t, 1, one)
+	assert.NoError(t, mock.ExpectationsWereMet(), "SET search_path should run on connect")
+}
+
+func TestDB_WithSearchPath(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+
+	t.Run("inside transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(`SET LOCAL search_path TO "tenant_b", "public"`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err := db.InTx(context.Background(), func(ctx context.Context) error {
+			return db.WithSearchPath(ctx, "tenant_b", "public")
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("requires transaction", func(t *testing.T) {
+		err := db.WithSearchPath(context.Background(), "tenant_b")
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+
+	t.Run("requires schemas", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		err := db.InTx(context.Background(), func(ctx context.Context) error {
+			return db.WithSearchPath(ctx)
+		})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+func TestDB_WaitForReady(t *testing.T) {
+	t.Run("ready after failed pings", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err, "Failed to create mock database")
+		defer mockDB.Close()
+
+		db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+
+		for i := 0; i < 3; i++ {
+			mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		}
+		mock.ExpectPing()
+
+		err = db.WaitForReady(context.Background(), time.Millisecond)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet(), "Should ping until success")
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err, "Failed to create mock database")
+		defer mockDB.Close()
+
+		db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+
+		for i := 0; i < 100; i++ {
+			mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err = db.WaitForReady(ctx, 10*time.Millisecond)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "connection refused")
+	})
+}
+
+func TestDB_ServerVersion(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+	query := "SELECT current_setting('server_version'), current_setting('server_version_num')"
+
+	t.Run("parse version", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(query)).
+			WillReturnRows(sqlmock.NewRows([]string{"server_version", "server_version_num"}).
+				AddRow("15.4 (Debian 15.4-1.pgdg120+1)", "150004"))
+
+		version, num, err := db.ServerVersion(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "15.4 (Debian 15.4-1.pgdg120+1)", version)
+		assert.Equal(t, 150004, num)
+		assert.True(t, num >= 150000, "MERGE is available from PostgreSQL 15")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid numeric version", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(query)).
+			WillReturnRows(sqlmock.NewRows([]string{"server_version", "server_version_num"}).AddRow("15.4", "n/a"))
+
+		_, _, err := db.ServerVersion(context.Background())
+		assert.ErrorContains(t, err, "parse server_version_num")
+	})
+}
+
 // 测试一些特殊的错误类型
 func TestErrorTypes(t *testing.T) {
 	assert.Equal(t, "duplicated", ErrDuplicated.Error())
@@ -199,3 +414,424 @@ func TestMetricsFunctions(t *testing.T) {
 	collectErrorCount("test_collection", queryOper)
 	collectOperDuration("test_collection", queryOper, 100*time.Millisecond)
 }
+
+// 测试QueryNamed的指标标签
+func TestDB_QueryNamed(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+
+	before := testutil.ToFloat64(_totalOperCount.WithLabelValues("monthly_report", string(queryOper)))
+	unnamedBefore := testutil.ToFloat64(_totalOperCount.WithLabelValues("", string(queryOper)))
+
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	rows, err := db.QueryNamed(context.Background(), "monthly_report", "SELECT 1")
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+
+	assert.Equal(t, before+1, testutil.ToFloat64(_totalOperCount.WithLabelValues("monthly_report", string(queryOper))),
+		"Named query should be counted under its own collection label")
+	assert.Equal(t, unnamedBefore, testutil.ToFloat64(_totalOperCount.WithLabelValues("", string(queryOper))),
+		"Unnamed collection should not change")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	t.Run("runs inside the context transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT 2").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(2))
+		mock.ExpectRollback()
+
+		// 只有一条连接时，未使用事务连接的查询会一直等待直到超时
+		db.db.SetMaxOpenConns(1)
+		defer db.db.SetMaxOpenConns(0)
+		txCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		errAbort := errors.New("abort")
+		err := db.InTx(txCtx, func(ctx context.Context) error {
+			rows, err := db.Query(ctx, "SELECT 2")
+			if err != nil {
+				return err
+			}
+			if err := rows.Close(); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+		assert.NoError(t, mock.ExpectationsWereMet(), "Query should run between BEGIN and ROLLBACK")
+	})
+}
+
+func TestDB_TxOperCount(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+	ctx := context.Background()
+
+	txBefore := testutil.ToFloat64(_txOperCount.WithLabelValues("tx_report", string(queryOper)))
+
+	// 事务外执行不计入事务计数
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	rows, err := db.QueryNamed(ctx, "tx_report", "SELECT 1")
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+	assert.Equal(t, txBefore, testutil.ToFloat64(_txOperCount.WithLabelValues("tx_report", string(queryOper))),
+		"Autocommit operation should not be counted as tx operation")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT 2").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(2))
+	mock.ExpectCommit()
+	err = db.InTx(ctx, func(ctx context.Context) error {
+		rows, err := db.QueryNamed(ctx, "tx_report", "SELECT 2")
+		if err != nil {
+			return err
+		}
+		return rows.Close()
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, txBefore+1, testutil.ToFloat64(_txOperCount.WithLabelValues("tx_report", string(queryOper))),
+		"Operation inside InTx should increment tx counter")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDB_PrepareNamed(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+	ctx := context.Background()
+
+	t.Run("named insert executed twice", func(t *testing.T) {
+		prep := mock.ExpectPrepare(`INSERT INTO users \(name, age\) VALUES \(\$1, \$2\)`)
+		prep.ExpectExec().WithArgs("John", 30).WillReturnResult(sqlmock.NewResult(1, 1))
+		prep.ExpectExec().WithArgs("Jane", 25).WillReturnResult(sqlmock.NewResult(2, 1))
+		prep.WillBeClosed()
+
+		stmt, err := db.PrepareNamed(ctx, "INSERT INTO users (name, age) VALUES (:name, :age)")
+		require.NoError(t, err, "PrepareNamed should succeed")
+
+		_, err = stmt.Exec(ctx, map[string]interface{}{"name": "John", "age": 30})
+		require.NoError(t, err)
+		result, err := stmt.Exec(ctx, struct {
+			Name string `db:"name"`
+			Age  int    `db:"age"`
+		}{Name: "Jane", Age: 25})
+		require.NoError(t, err)
+		affected, _ := result.RowsAffected()
+		assert.Equal(t, int64(1), affected)
+
+		require.NoError(t, stmt.Close())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("select inside transaction", func(t *testing.T) {
+		prep := mock.ExpectPrepare(`SELECT id, name FROM users WHERE age > \$1`)
+		mock.ExpectBegin()
+		// 事务与语句共用同一连接时，database/sql 直接复用已预编译的语句
+		prep.ExpectQuery().WithArgs(20).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "John"))
+		mock.ExpectCommit()
+
+		stmt, err := db.PrepareNamed(ctx, "SELECT id, name FROM users WHERE age > :age")
+		require.NoError(t, err)
+		defer stmt.Close()
+
+		var users []struct {
+			ID   int    `db:"id"`
+			Name string `db:"name"`
+		}
+		err = db.InTx(ctx, func(ctx context.Context) error {
+			return stmt.Select(ctx, &users, map[string]interface{}{"age": 20})
+		})
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, "John", users[0].Name)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("prepare error", func(t *testing.T) {
+		mock.ExpectPrepare("SELECT broken").WillReturnError(errors.New("syntax error"))
+
+		stmt, err := db.PrepareNamed(ctx, "SELECT broken")
+		assert.Error(t, err)
+		assert.Nil(t, stmt)
+	})
+}
+
+func TestDB_DeadlineContext(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+
+	t.Run("cancellation cancels backend", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT pg_backend_pid\(\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_backend_pid"}).AddRow(4321))
+		mock.ExpectExec(`SELECT pg_cancel_backend\(\$1\)`).
+			WithArgs(4321).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		err := db.DeadlineContext(ctx, 0, func(ctx context.Context, conn *sqlx.Conn) error {
+			// 模拟长时间运行的语句，直到上下文被取消
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NoError(t, mock.ExpectationsWereMet(), "Cancel request should be sent before returning")
+	})
+
+	t.Run("timeout cancels backend", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT pg_backend_pid\(\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_backend_pid"}).AddRow(99))
+		mock.ExpectExec(`SELECT pg_cancel_backend\(\$1\)`).
+			WithArgs(99).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := db.DeadlineContext(context.Background(), 10*time.Millisecond, func(ctx context.Context, conn *sqlx.Conn) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("completed work does not cancel", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT pg_backend_pid\(\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_backend_pid"}).AddRow(7))
+		mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+
+		err := db.DeadlineContext(context.Background(), time.Second, func(ctx context.Context, conn *sqlx.Conn) error {
+			var n int
+			return conn.GetContext(ctx, &n, "SELECT 1")
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet(), "No cancel request should be sent")
+	})
+}
+
+func TestDB_WithDedicatedConn(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+	ctx := context.Background()
+
+	t.Run("session settings are discarded before release", func(t *testing.T) {
+		mock.ExpectExec(`SET statement_timeout = '5s'`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE jobs SET state = 'done'`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(`DISCARD ALL`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := db.WithDedicatedConn(ctx, func(ctx context.Context) error {
+			conn := ConnFromContext(ctx)
+			require.NotNil(t, conn)
+			if _, err := conn.ExecContext(ctx, "SET statement_timeout = '5s'"); err != nil {
+				return err
+			}
+			return db.InTx(ctx, func(ctx context.Context) error {
+				_, err := getTxFromContext(ctx).ExecContext(ctx, "UPDATE jobs SET state = 'done'")
+				return err
+			})
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, ConnFromContext(ctx), "Connection must not leak into the caller's context")
+		assert.NoError(t, mock.ExpectationsWereMet(), "DISCARD ALL should run after fn")
+		assert.Equal(t, 1, mockDB.Stats().Idle, "Reset connection should return to the pool")
+	})
+
+	t.Run("fn error still resets the session", func(t *testing.T) {
+		mock.ExpectExec(`DISCARD ALL`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		fnErr := errors.New("boom")
+		err := db.WithDedicatedConn(ctx, func(ctx context.Context) error { return fnErr })
+		assert.ErrorIs(t, err, fnErr)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("only raw SQL is bound to the connection", func(t *testing.T) {
+		mock.ExpectExec(`SET work_mem = '256MB'`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT current_setting`).WillReturnRows(sqlmock.NewRows([]string{"work_mem"}).AddRow("256MB"))
+		mock.ExpectExec(`DISCARD ALL`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// 只有一条连接时，需要从连接池取连接的构建器查询会一直等待直到超时
+		db.db.SetMaxOpenConns(1)
+		defer db.db.SetMaxOpenConns(0)
+		connCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		err := db.WithDedicatedConn(connCtx, func(ctx context.Context) error {
+			if _, err := ConnFromContext(ctx).ExecContext(ctx, "SET work_mem = '256MB'"); err != nil {
+				return err
+			}
+			rows, err := db.Query(ctx, "SELECT current_setting('work_mem')")
+			if err != nil {
+				return err
+			}
+			require.NoError(t, rows.Close())
+
+			var users []User
+			err = db.Table(ctx, "users").Query().GetAll(ctx, &users)
+			assert.ErrorIs(t, err, context.DeadlineExceeded, "Builder queries use the pool, not the dedicated connection")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("failed reset discards the connection", func(t *testing.T) {
+		mock.ExpectExec(`DISCARD ALL`).WillReturnError(errors.New("connection lost"))
+		mock.ExpectClose()
+
+		err := db.WithDedicatedConn(ctx, func(ctx context.Context) error { return nil })
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 0, mockDB.Stats().OpenConnections, "Connection with unknown session state must not be reused")
+	})
+
+	t.Run("search_path is re-applied after reset", func(t *testing.T) {
+		spMockDB, spMock, err := sqlmock.New()
+		require.NoError(t, err, "Failed to create mock database")
+		defer spMockDB.Close()
+
+		config := DefaultDBConfig()
+		config.SearchPath = []string{"tenant_a", "public"}
+		spDB, err := NewFromSQLX(sqlx.NewDb(spMockDB, "postgres"), config)
+		require.NoError(t, err)
+
+		spMock.ExpectExec(`DISCARD ALL`).WillReturnResult(sqlmock.NewResult(0, 0))
+		spMock.ExpectExec(regexp.QuoteMeta(`SET search_path TO "tenant_a", "public"`)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = spDB.WithDedicatedConn(ctx, func(ctx context.Context) error { return nil })
+		assert.NoError(t, err)
+		assert.NoError(t, spMock.ExpectationsWereMet(), "SET search_path should follow DISCARD ALL")
+		assert.Equal(t, 1, spMockDB.Stats().Idle, "Restored connection should return to the pool")
+
+		// 无法恢复 search_path 时丢弃连接
+		spMock.ExpectExec(`DISCARD ALL`).WillReturnResult(sqlmock.NewResult(0, 0))
+		spMock.ExpectExec(`SET search_path`).WillReturnError(errors.New("schema does not exist"))
+		spMock.ExpectClose()
+
+		err = spDB.WithDedicatedConn(ctx, func(ctx context.Context) error { return nil })
+		assert.NoError(t, err)
+		assert.NoError(t, spMock.ExpectationsWereMet())
+		assert.Equal(t, 0, spMockDB.Stats().OpenConnections, "Connection without the configured search_path must not be reused")
+	})
+
+	t.Run("not allowed inside a transaction", func(t *testing.T) {
+		txCtx := context.WithValue(ctx, contextTxKey{}, &sqlx.Tx{})
+		err := db.WithDedicatedConn(txCtx, func(ctx context.Context) error { return nil })
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// 测试SnakeCase字段映射
+func TestSnakeCase(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Name", "name"},
+		{"CreatedAt", "created_at"},
+		{"UserID", "user_id"},
+		{"HTTPServer", "http_server"},
+		{"already_snake", "already_snake"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, SnakeCase(tt.input))
+		})
+	}
+}
+
+// 测试连接池统计指标
+func TestDB_AddConnectionStats(t *testing.T) {
+	mockDB, _, err := sqlmock.New()
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+
+	registry := prometheus.NewRegistry()
+	db.AddConnectionStats(registry)
+
+	families, err := registry.Gather()
+	require.NoError(t, err, "Gather should succeed")
+
+	names := make([]string, 0, len(families))
+	for _, mf := range families {
+		names = append(names, mf.GetName())
+	}
+
+	for _, expected := range []string{
+		"pgsql_helper_pgsql_connections_open",
+		"pgsql_helper_pgsql_connections_idle",
+		"pgsql_helper_pgsql_connections_in_use",
+		"pgsql_helper_pgsql_connections_wait_count_total",
+		"pgsql_helper_pgsql_connections_wait_duration_seconds_total",
+		"pgsql_helper_pgsql_connections_max_idle_closed_total",
+		"pgsql_helper_pgsql_connections_max_lifetime_closed_total",
+	} {
+		assert.Contains(t, names, expected)
+	}
+}
+
+func TestDB_Logger(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	require.NoError(t, err, "Failed to create mock database")
+	defer mockDB.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db", logger: logger}
+	table := db.Table(context.Background(), "users")
+
+	decode := func(t *testing.T) map[string]interface{} {
+		t.Helper()
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		buf.Reset()
+		return entry
+	}
+
+	t.Run("error logged on failure", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM users").WillReturnError(errors.New("connection reset"))
+
+		_, err := table.Delete(context.Background(), "id = :id", map[string]interface{}{"id": 1})
+		require.Error(t, err)
+
+		entry := decode(t)
+		assert.Equal(t, "ERROR", entry["level"])
+		assert.Equal(t, "postgresql operation failed", entry["msg"])
+		assert.Equal(t, "delete", entry["operation"])
+		assert.Equal(t, "users", entry["collection"])
+		assert.Contains(t, entry["error"], "connection reset")
+		assert.Contains(t, entry, "duration")
+	})
+
+	t.Run("debug logged with rows affected", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM users").WillReturnResult(sqlmock.NewResult(0, 3))
+
+		_, err := table.Delete(context.Background(), "id > :id", map[string]interface{}{"id": 1})
+		require.NoError(t, err)
+
+		entry := decode(t)
+		assert.Equal(t, "DEBUG", entry["level"])
+		assert.Equal(t, float64(3), entry["rows_affected"])
+		assert.NotContains(t, entry, "error")
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,6 +1,6 @@
 module github.com/songzhibin97/postgresql_helper
 
-go 1.18
+go 1.21
 
 require (
 	github.com/DATA-DOG/go-sqlmock v1.5.2
@@ -2,13 +2,19 @@ package postgresql_helper
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/songzhibin97/postgresql_helper/types"
 )
 
@@ -17,6 +23,15 @@ type migrator struct {
 	db         *DB
 	migrations []types.Migration
 	tableName  string
+
+	allowChecksumMismatch bool // 忽略已应用迁移的校验和差异
+	tableReady            bool // 迁移表已创建或已升级到当前结构
+
+	beforeMigrate func(types.Migration)        // 每个迁移执行前回调
+	afterMigrate  func(types.Migration, error) // 每个迁移执行后回调
+
+	migrationTimeout  time.Duration // 单个迁移的执行超时，0 表示不限制
+	requireMigrations bool          // 未注册任何迁移时 MigrateUp 返回错误
 }
 
 // NewMigrator 创建新的迁移管理器
@@ -45,6 +60,45 @@ func WithMigrationsTable(tableName string) MigratorOption {
 	}
 }
 
+// WithAllowChecksumMismatch 允许已应用迁移的校验和与当前定义不一致
+// 默认情况下 MigrateUp 检测到已应用迁移被修改时会返回 ErrChecksumMismatch
+func WithAllowChecksumMismatch() MigratorOption {
+	return func(m *migrator) {
+		m.allowChecksumMismatch = true
+	}
+}
+
+// WithBeforeMigrate 设置每个迁移（升级或回滚）执行前的回调
+func WithBeforeMigrate(fn func(types.Migration)) MigratorOption {
+	return func(m *migrator) {
+		m.beforeMigrate = fn
+	}
+}
+
+// WithAfterMigrate 设置每个迁移（升级或回滚）执行后的回调，err 为该迁移的执行结果
+func WithAfterMigrate(fn func(types.Migration, error)) MigratorOption {
+	return func(m *migrator) {
+		m.afterMigrate = fn
+	}
+}
+
+// WithMigrationTimeout 设置单个迁移函数的执行超时
+// 超时后该迁移的事务回滚（超时前通过传入的 ctx 与 db.Query 执行的语句一并撤销），返回 ErrMigrationTimeout，
+// 并在结果中记录超时的迁移；迁移函数需要使用传入的 ctx 才能被及时中断
+func WithMigrationTimeout(d time.Duration) MigratorOption {
+	return func(m *migrator) {
+		m.migrationTimeout = d
+	}
+}
+
+// WithRequireMigrations 要求至少注册一个迁移
+// 用于发现迁移未被加载等配置错误，未注册时 MigrateUp 返回 ErrNoMigrationsRegistered
+func WithRequireMigrations() MigratorOption {
+	return func(m *migrator) {
+		m.requireMigrations = true
+	}
+}
+
 // Register 注册新迁移
 func (m *migrator) Register(migration types.Migration) error {
 	// 检查版本号重复
@@ -76,7 +130,15 @@ func (m *migrator) CreateMigrationsTable(ctx context.Context) error {
 	}
 
 	if exists {
-		return nil // 表已存在，无需创建
+		// 表已存在，兼容旧版本迁移表：补充 checksum 列
+		if !m.tableReady {
+			query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS checksum VARCHAR(64)", m.tableName)
+			if _, err := m.db.db.ExecContext(ctx, query); err != nil {
+				return fmt.Errorf("failed to upgrade migrations table: %w", err)
+			}
+			m.tableReady = true
+		}
+		return nil
 	}
 
 	// 创建迁移表
@@ -105,17 +167,35 @@ func (m *migrator) CreateMigrationsTable(ctx context.Context) error {
 				Nullable: false,
 				Default:  "NOW()",
 			},
+			{
+				Name:     "checksum",
+				Type:     "VARCHAR(64)",
+				Nullable: true,
+			},
 		},
 		IfNotExists: true,
 	}
 
-	if err := schema.CreateTable(ctx, tableSchema); err != nil {
+	// 并发的迁移器可能在存在性检查之后抢先建表，此时视为成功（见 isDuplicateTable），
+	// 对方创建的是当前版本的迁移表，无需再补充 checksum 列
+	if err := schema.CreateTable(ctx, tableSchema); err != nil && !isDuplicateTable(err) {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
 
+	m.tableReady = true
 	return nil
 }
 
+// isDuplicateTable 判断错误是否为并发建表冲突：表已存在 (42P07)，
+// 或两个 CREATE TABLE IF NOT EXISTS 同时写入表的行类型时在 pg_type_typname_nsp_index 上的唯一冲突 (23505)
+func isDuplicateTable(err error) bool {
+	if errors.Is(err, ErrUniqueViolation) {
+		return ConstraintName(err) == "pg_type_typname_nsp_index"
+	}
+	var pgErr *pq.Error
+	return errors.As(err, &pgErr) && pgErr.Code == "42P07"
+}
+
 // GetCurrentVersion 获取当前数据库版本
 func (m *migrator) GetCurrentVersion(ctx context.Context) (int64, error) {
 	// 确保迁移表存在
@@ -143,10 +223,33 @@ func (m *migrator) GetAppliedMigrations(ctx context.Context) ([]types.Migration,
 
 	// 查询所有已应用的迁移
 	query := fmt.Sprintf(
-		"SELECT version, name, description, applied_at FROM %s ORDER BY version",
+		"SELECT version, name, description, applied_at, COALESCE(checksum, '') FROM %s ORDER BY version",
 		m.tableName)
 
-	rows, err := m.db.db.QueryContext(ctx, query)
+	return m.queryAppliedMigrations(ctx, query)
+}
+
+// GetAppliedMigrationsRange 获取版本在 [from, to] 区间内的已应用迁移
+func (m *migrator) GetAppliedMigrationsRange(ctx context.Context, from, to int64) ([]types.Migration, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid version range: from %d is greater than to %d", from, to)
+	}
+
+	// 确保迁移表存在
+	if err := m.CreateMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(
+		"SELECT version, name, description, applied_at, COALESCE(checksum, '') FROM %s WHERE version BETWEEN $1 AND $2 ORDER BY version",
+		m.tableName)
+
+	return m.queryAppliedMigrations(ctx, query, from, to)
+}
+
+// queryAppliedMigrations 执行迁移记录查询并扫描结果
+func (m *migrator) queryAppliedMigrations(ctx context.Context, query string, args ...interface{}) ([]types.Migration, error) {
+	rows, err := m.db.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query migrations: %w", err)
 	}
@@ -162,6 +265,7 @@ func (m *migrator) GetAppliedMigrations(ctx context.Context) ([]types.Migration,
 			&migration.Name,
 			&migration.Description,
 			&appliedAt,
+			&migration.Checksum,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan migration: %w", err)
 		}
@@ -186,6 +290,10 @@ func (m *migrator) MigrateUp(ctx context.Context) (*types.MigrationResult, error
 func (m *migrator) MigrateUpTo(ctx context.Context, targetVersion int64) (*types.MigrationResult, error) {
 	startTime := time.Now()
 
+	if m.requireMigrations && len(m.migrations) == 0 {
+		return nil, fmt.Errorf("%w: check that migrations are loaded before calling MigrateUp", ErrNoMigrationsRegistered)
+	}
+
 	// 确保迁移表存在
 	if err := m.CreateMigrationsTable(ctx); err != nil {
 		return nil, err
@@ -203,6 +311,13 @@ func (m *migrator) MigrateUpTo(ctx context.Context, targetVersion int64) (*types
 		return nil, err
 	}
 
+	// 校验已应用迁移的内容是否被修改
+	if !m.allowChecksumMismatch {
+		if err := m.verifyChecksums(appliedVersions); err != nil {
+			return nil, err
+		}
+	}
+
 	result := &types.MigrationResult{
 		StartVersion:      currentVersion,
 		AppliedMigrations: []types.Migration{},
@@ -240,21 +355,27 @@ func (m *migrator) MigrateUpTo(ctx context.Context, targetVersion int64) (*types
 			continue
 		}
 
-		// 在事务中执行迁移
-		err := m.db.InTx(ctx, func(ctx context.Context) error {
+		// 在事务中执行迁移（NonTransactional 迁移除外）
+		err := m.runMigration(ctx, migration, func(ctx context.Context) error {
 			// 执行迁移
-			if err := migration.UpFn(ctx, m.db); err != nil {
+			if err := m.callMigrateFn(ctx, migration.UpFn); err != nil {
 				return fmt.Errorf("migration %d (%s) failed: %w",
 					migration.Version, migration.Name, err)
 			}
 
 			// 记录迁移
 			query := fmt.Sprintf(
-				"INSERT INTO %s (version, name, description) VALUES ($1, $2, $3)",
+				"INSERT INTO %s (version, name, description, checksum) VALUES ($1, $2, $3, $4)",
 				m.tableName)
 
-			_, err = m.db.db.ExecContext(ctx, query,
-				migration.Version, migration.Name, migration.Description)
+			var checksum interface{}
+			if migration.Checksum != "" {
+				checksum = migration.Checksum
+			}
+
+			// 与迁移语句在同一事务中写入版本记录
+			_, err = m.db.execer(ctx).ExecContext(ctx, query,
+				migration.Version, migration.Name, migration.Description, checksum)
 
 			if err != nil {
 				return fmt.Errorf("failed to record migration %d: %w",
@@ -266,6 +387,10 @@ func (m *migrator) MigrateUpTo(ctx context.Context, targetVersion int64) (*types
 
 		if err != nil {
 			// 迁移失败
+			if errors.Is(err, ErrMigrationTimeout) {
+				timedOut := migration
+				result.TimedOutMigration = &timedOut
+			}
 			result.Error = err
 			result.CurrentVersion = currentVersion
 			result.EndVersion = currentVersion
@@ -389,17 +514,17 @@ func (m *migrator) MigrateDownTo(ctx context.Context, targetVersion int64) (*typ
 				migration.Version, migration.Name)
 		}
 
-		// 在事务中执行回滚
-		err := m.db.InTx(ctx, func(ctx context.Context) error {
+		// 在事务中执行回滚（NonTransactional 迁移除外）
+		err := m.runMigration(ctx, migration, func(ctx context.Context) error {
 			// 执行回滚
-			if err := migration.DownFn(ctx, m.db); err != nil {
+			if err := m.callMigrateFn(ctx, migration.DownFn); err != nil {
 				return fmt.Errorf("rollback migration %d (%s) failed: %w",
 					migration.Version, migration.Name, err)
 			}
 
 			// 删除迁移记录
 			query := fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.tableName)
-			_, err = m.db.db.ExecContext(ctx, query, migration.Version)
+			_, err = m.db.execer(ctx).ExecContext(ctx, query, migration.Version)
 
 			if err != nil {
 				return fmt.Errorf("failed to delete migration record %d: %w",
@@ -411,6 +536,10 @@ func (m *migrator) MigrateDownTo(ctx context.Context, targetVersion int64) (*typ
 
 		if err != nil {
 			// 回滚失败
+			if errors.Is(err, ErrMigrationTimeout) {
+				timedOut := migration
+				result.TimedOutMigration = &timedOut
+			}
 			result.Error = err
 			result.CurrentVersion = currentVersion
 			result.EndVersion = currentVersion
@@ -436,22 +565,108 @@ func (m *migrator) MigrateDownTo(ctx context.Context, targetVersion int64) (*typ
 	return result, nil
 }
 
-// 获取已应用的迁移版本集合
-func (m *migrator) getAppliedVersions(ctx context.Context) (map[int64]struct{}, error) {
-	query := fmt.Sprintf("SELECT version FROM %s", m.tableName)
+// Redo 回滚最近一次迁移并重新应用
+// 仅重新应用被回滚的那一个迁移，其余待应用迁移不受影响
+func (m *migrator) Redo(ctx context.Context) (*types.MigrationResult, error) {
+	startTime := time.Now()
+
+	currentVersion, err := m.GetCurrentVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if currentVersion == 0 {
+		return nil, fmt.Errorf("no applied migration to redo")
+	}
+
+	downResult, err := m.MigrateDown(ctx, 1)
+	if err != nil {
+		return downResult, err
+	}
+
+	upResult, err := m.MigrateUpTo(ctx, currentVersion)
+	if err != nil {
+		return upResult, err
+	}
+
+	return &types.MigrationResult{
+		AppliedMigrations: upResult.AppliedMigrations,
+		StartVersion:      downResult.StartVersion,
+		CurrentVersion:    upResult.CurrentVersion,
+		EndVersion:        upResult.EndVersion,
+		ExecutionTime:     time.Since(startTime),
+	}, nil
+}
+
+// runMigration 执行单个迁移步骤，默认包裹在事务中
+func (m *migrator) runMigration(ctx context.Context, migration types.Migration, fn func(ctx context.Context) error) error {
+	if m.beforeMigrate != nil {
+		m.beforeMigrate(migration)
+	}
+
+	var err error
+	if migration.NonTransactional {
+		err = fn(ctx)
+	} else {
+		err = m.db.InTx(ctx, fn)
+	}
+	// 迁移可能修改任意表的结构，清除列缓存
+	invalidateAllTableColumns(m.db.db)
+
+	if m.afterMigrate != nil {
+		m.afterMigrate(migration, err)
+	}
+	return err
+}
+
+// callMigrateFn 调用迁移函数，设置了超时时间时使用带截止时间的上下文
+func (m *migrator) callMigrateFn(ctx context.Context, fn types.MigrateFn) error {
+	if m.migrationTimeout <= 0 {
+		return fn(ctx, m.db)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.migrationTimeout)
+	defer cancel()
+
+	err := fn(ctx, m.db)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", ErrMigrationTimeout, m.migrationTimeout)
+	}
+	return err
+}
+
+// verifyChecksums 比对已应用迁移记录的校验和与当前注册的定义
+// 任一方为空（Go函数迁移或旧版本记录）时跳过
+func (m *migrator) verifyChecksums(applied map[int64]string) error {
+	for _, migration := range m.migrations {
+		stored, ok := applied[migration.Version]
+		if !ok || stored == "" || migration.Checksum == "" {
+			continue
+		}
+		if stored != migration.Checksum {
+			return fmt.Errorf("%w: migration %d (%s) was modified after being applied (stored %s, current %s)",
+				ErrChecksumMismatch, migration.Version, migration.Name, stored, migration.Checksum)
+		}
+	}
+	return nil
+}
+
+// 获取已应用的迁移版本集合（版本 -> 校验和）
+func (m *migrator) getAppliedVersions(ctx context.Context) (map[int64]string, error) {
+	query := fmt.Sprintf("SELECT version, COALESCE(checksum, '') FROM %s", m.tableName)
 	rows, err := m.db.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query applied versions: %w", err)
 	}
 	defer rows.Close()
 
-	result := make(map[int64]struct{})
+	result := make(map[int64]string)
 	for rows.Next() {
 		var version int64
-		if err := rows.Scan(&version); err != nil {
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
 			return nil, fmt.Errorf("failed to scan version: %w", err)
 		}
-		result[version] = struct{}{}
+		result[version] = checksum
 	}
 
 	if err := rows.Err(); err != nil {
@@ -488,22 +703,118 @@ func DateTimeMigration(name string, description string, up types.MigrateFn, down
 // SQLMigration 从SQL字符串创建迁移
 func SQLMigration(version int64, name string, description string, upSQL string, downSQL string) types.Migration {
 	var upFn types.MigrateFn = func(ctx context.Context, db types.DB) error {
-		if upSQL == "" {
-			return nil
-		}
-		_, err := db.Query(ctx, upSQL)
-		return err
+		return execSQLStatements(ctx, db, upSQL)
 	}
 
 	var downFn types.MigrateFn = func(ctx context.Context, db types.DB) error {
-		if downSQL == "" {
-			return nil
+		return execSQLStatements(ctx, db, downSQL)
+	}
+
+	migration := NewMigration(version, name, description, upFn, downFn)
+	migration.Checksum = migrationChecksum(upSQL)
+	return migration
+}
+
+// execSQLStatements 按语句拆分SQL并依次执行，ctx 中存在迁移事务时在该事务内执行
+func execSQLStatements(ctx context.Context, db types.DB, sql string) error {
+	for i, stmt := range splitSQLStatements(sql) {
+		rows, err := db.Query(ctx, stmt)
+		if err != nil {
+			return fmt.Errorf("statement %d failed: %w", i+1, err)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("statement %d failed: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// splitSQLStatements 按分号拆分多条SQL语句
+// 字符串字面量、引号标识符、注释以及 $$/$tag$ 包裹的函数体中的分号不作为分隔符，
+// 只包含空白或注释的片段会被丢弃
+func splitSQLStatements(sql string) []string {
+	var statements []string
+	start := 0
+	hasContent := false
+
+	flush := func(end int) {
+		if hasContent {
+			statements = append(statements, strings.TrimSpace(sql[start:end]))
+		}
+		start = end + 1
+		hasContent = false
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == ';':
+			flush(i)
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			// 行注释
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			// 块注释
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+		case c == '\'' || c == '"':
+			// 字符串字面量或引号标识符，连续两个引号为转义
+			hasContent = true
+			for i++; i < len(sql); i++ {
+				if sql[i] == c {
+					if i+1 < len(sql) && sql[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case c == '$':
+			hasContent = true
+			if tag := dollarQuoteTag(sql[i:]); tag != "" {
+				end := strings.Index(sql[i+len(tag):], tag)
+				if end < 0 {
+					i = len(sql)
+				} else {
+					i += len(tag) + end + len(tag) - 1
+				}
+			}
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			hasContent = true
 		}
-		_, err := db.Query(ctx, downSQL)
-		return err
 	}
+	flush(len(sql))
+
+	return statements
+}
+
+// dollarQuoteTag 返回以 s 开头的美元引用标记（如 $$ 或 $body$），不是标记时返回空串
+func dollarQuoteTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		isLetter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && !(i > 1 && isDigit(c)) {
+			return ""
+		}
+	}
+	return ""
+}
 
-	return NewMigration(version, name, description, upFn, downFn)
+// migrationChecksum 计算迁移SQL的SHA-256校验和
+func migrationChecksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
 }
 
 // FileMigration 从SQL文件创建迁移
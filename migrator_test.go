@@ -2,10 +2,15 @@ package postgresql_helper
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/songzhibin97/postgresql_helper/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -86,7 +91,7 @@ func TestMigrator_MigrateUp(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
 	// 2. 创建表 - 使用完整的SQL匹配
-	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations \(version BIGINT PRIMARY KEY NOT NULL,name VARCHAR\(255\) NOT NULL,description TEXT,applied_at TIMESTAMP WITH TIME ZONE NOT NULL\)`).
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations \(version BIGINT PRIMARY KEY NOT NULL,name VARCHAR\(255\) NOT NULL,description TEXT,applied_at TIMESTAMP WITH TIME ZONE NOT NULL,checksum VARCHAR\(64\)\)`).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
 	// 3. 获取当前版本 - 检查表是否存在
@@ -99,20 +104,20 @@ func TestMigrator_MigrateUp(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
 
 	// 5. 获取已应用的版本
-	mock.ExpectQuery(`SELECT version FROM schema_migrations`).
-		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`SELECT version, COALESCE\(checksum, ''\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
 
 	// 6. 第一个迁移的事务
 	mock.ExpectBegin()
-	mock.ExpectExec(`INSERT INTO schema_migrations \(version, name, description\) VALUES \(\$1, \$2, \$3\)`).
-		WithArgs(20230101000001, "First migration", "First test migration").
+	mock.ExpectExec(`INSERT INTO schema_migrations \(version, name, description, checksum\) VALUES \(\$1, \$2, \$3, \$4\)`).
+		WithArgs(20230101000001, "First migration", "First test migration", nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
 	// 7. 第二个迁移的事务
 	mock.ExpectBegin()
-	mock.ExpectExec(`INSERT INTO schema_migrations \(version, name, description\) VALUES \(\$1, \$2, \$3\)`).
-		WithArgs(20230101000002, "Second migration", "Second test migration").
+	mock.ExpectExec(`INSERT INTO schema_migrations \(version, name, description, checksum\) VALUES \(\$1, \$2, \$3, \$4\)`).
+		WithArgs(20230101000002, "Second migration", "Second test migration", nil).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -137,6 +142,497 @@ func TestMigrator_MigrateUp(t *testing.T) {
 	}
 }
 
+// 测试非事务迁移
+func TestMigrator_NonTransactional(t *testing.T) {
+	m, mock, cleanup := setupMigratorTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	upCalled := false
+	err := m.Register(types.Migration{
+		Version:          20230101000001,
+		Name:             "Concurrent index",
+		Description:      "CREATE INDEX CONCURRENTLY",
+		NonTransactional: true,
+		UpFn: func(ctx context.Context, db types.DB) error {
+			upCalled = true
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum VARCHAR\(64\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
+	mock.ExpectQuery(`SELECT version, COALESCE\(checksum, ''\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+
+	// 没有 BEGIN/COMMIT，直接执行并记录版本
+	mock.ExpectExec(`INSERT INTO schema_migrations \(version, name, description, checksum\) VALUES \(\$1, \$2, \$3, \$4\)`).
+		WithArgs(20230101000001, "Concurrent index", "CREATE INDEX CONCURRENTLY", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	result, err := m.MigrateUp(ctx)
+	require.NoError(t, err)
+	assert.True(t, upCalled, "UpFn should be executed")
+	assert.Len(t, result.AppliedMigrations, 1)
+	assert.Equal(t, int64(20230101000001), result.CurrentVersion)
+
+	// 若执行了 BEGIN/COMMIT，sqlmock 会因未预期的调用而报错
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// 测试SQL迁移的语句与版本记录在同一事务中执行
+func TestMigrator_SQLMigrationTransaction(t *testing.T) {
+	expectPending := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(`SELECT EXISTS`).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT EXISTS`).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
+		mock.ExpectQuery(`SELECT version, COALESCE\(checksum, ''\) FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	}
+
+	// 只有一条连接时，未使用迁移事务的语句会一直等待直到超时
+	newMigrator := func(t *testing.T) (types.Migrator, sqlmock.Sqlmock, context.Context) {
+		mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+		require.NoError(t, err)
+		t.Cleanup(func() { mockDB.Close() })
+		sqlxDB := sqlx.NewDb(mockDB, "postgres")
+		sqlxDB.SetMaxOpenConns(1)
+
+		m, err := NewMigrator(&DB{db: sqlxDB, name: "test_db"})
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		t.Cleanup(cancel)
+		return m, mock, ctx
+	}
+
+	upSQL := "CREATE TABLE a (id INT); INSERT INTO a VALUES (1)"
+	migration := SQLMigration(1, "create a", "", upSQL, "DROP TABLE a")
+
+	t.Run("failing statement rolls back earlier statements", func(t *testing.T) {
+		m, mock, ctx := newMigrator(t)
+		require.NoError(t, m.Register(migration))
+
+		expectPending(mock)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^CREATE TABLE a \(id INT\)$`).WillReturnRows(sqlmock.NewRows(nil))
+		mock.ExpectQuery(`^INSERT INTO a VALUES \(1\)$`).WillReturnError(errors.New("duplicate key"))
+		mock.ExpectRollback()
+
+		result, err := m.MigrateUp(ctx)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "statement 2 failed")
+		assert.Empty(t, result.AppliedMigrations)
+		// 没有写入版本记录，且 CREATE TABLE 位于被回滚的事务中
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("statements and version record commit together", func(t *testing.T) {
+		m, mock, ctx := newMigrator(t)
+		require.NoError(t, m.Register(migration))
+
+		expectPending(mock)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^CREATE TABLE a \(id INT\)$`).WillReturnRows(sqlmock.NewRows(nil))
+		mock.ExpectQuery(`^INSERT INTO a VALUES \(1\)$`).WillReturnRows(sqlmock.NewRows(nil))
+		mock.ExpectExec(`INSERT INTO schema_migrations`).
+			WithArgs(1, "create a", "", migration.Checksum).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		result, err := m.MigrateUp(ctx)
+		require.NoError(t, err)
+		assert.Len(t, result.AppliedMigrations, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// 测试已应用迁移的校验和验证
+func TestMigrator_Checksum(t *testing.T) {
+	upSQL := "CREATE TABLE t (id INT)"
+	migration := SQLMigration(20230101000001, "create t", "", upSQL, "DROP TABLE t")
+	require.Equal(t, migrationChecksum(upSQL), migration.Checksum)
+
+	expectApplied := func(mock sqlmock.Sqlmock, checksum string) {
+		mock.ExpectQuery(`SELECT EXISTS`).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT EXISTS`).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(20230101000001))
+		mock.ExpectQuery(`SELECT version, COALESCE\(checksum, ''\) FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(20230101000001, checksum))
+	}
+
+	t.Run("matching checksum", func(t *testing.T) {
+		m, mock, cleanup := setupMigratorTest(t)
+		defer cleanup()
+		require.NoError(t, m.Register(migration))
+
+		expectApplied(mock, migration.Checksum)
+
+		result, err := m.MigrateUp(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, result.AppliedMigrations)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("mismatching checksum", func(t *testing.T) {
+		m, mock, cleanup := setupMigratorTest(t)
+		defer cleanup()
+		require.NoError(t, m.Register(migration))
+
+		expectApplied(mock, migrationChecksum("CREATE TABLE t (id BIGINT)"))
+
+		_, err := m.MigrateUp(context.Background())
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("mismatch allowed by option", func(t *testing.T) {
+		m, mock, cleanup := setupMigratorTest(t)
+		defer cleanup()
+		WithAllowChecksumMismatch()(m.(*migrator))
+		require.NoError(t, m.Register(migration))
+
+		expectApplied(mock, migrationChecksum("CREATE TABLE t (id BIGINT)"))
+
+		_, err := m.MigrateUp(context.Background())
+		require.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// 测试按版本区间获取已应用迁移
+func TestMigrator_GetAppliedMigrationsRange(t *testing.T) {
+	m, mock, cleanup := setupMigratorTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	appliedAt := time.Now()
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, name, description, applied_at, COALESCE\(checksum, ''\) FROM schema_migrations WHERE version BETWEEN \$1 AND \$2 ORDER BY version`).
+		WithArgs(int64(20230101000002), int64(20230101000003)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "description", "applied_at", "checksum"}).
+			AddRow(20230101000002, "second", "", appliedAt, "").
+			AddRow(20230101000003, "third", "", appliedAt, "abc"))
+
+	migrations, err := m.GetAppliedMigrationsRange(ctx, 20230101000002, 20230101000003)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, int64(20230101000002), migrations[0].Version)
+	assert.Equal(t, "third", migrations[1].Name)
+	assert.Equal(t, "abc", migrations[1].Checksum)
+	assert.NotNil(t, migrations[1].AppliedAt)
+
+	// 非法区间不访问数据库
+	_, err = m.GetAppliedMigrationsRange(ctx, 10, 1)
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// 测试回滚并重新应用最近一次迁移
+func TestMigrator_Redo(t *testing.T) {
+	m, mock, cleanup := setupMigratorTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	appliedAt := time.Now()
+
+	var calls []string
+	for _, v := range []int64{20230101000001, 20230101000002} {
+		version := v
+		require.NoError(t, m.Register(types.Migration{
+			Version: version,
+			Name:    "migration",
+			UpFn: func(ctx context.Context, db types.DB) error {
+				calls = append(calls, "up")
+				return nil
+			},
+			DownFn: func(ctx context.Context, db types.DB) error {
+				calls = append(calls, "down")
+				return nil
+			},
+		}))
+	}
+
+	expectExists := func() {
+		mock.ExpectQuery(`SELECT EXISTS`).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	}
+	appliedRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"version", "name", "description", "applied_at", "checksum"}).
+			AddRow(20230101000001, "migration", "", appliedAt, "").
+			AddRow(20230101000002, "migration", "", appliedAt, "")
+	}
+
+	// Redo: 获取当前版本
+	expectExists()
+	mock.ExpectExec(`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(20230101000002))
+
+	// MigrateDown(1)
+	expectExists()
+	mock.ExpectQuery(`SELECT version, name, description, applied_at`).WillReturnRows(appliedRows())
+	expectExists()
+	expectExists()
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(20230101000002))
+	expectExists()
+	mock.ExpectQuery(`SELECT version, name, description, applied_at`).WillReturnRows(appliedRows())
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM schema_migrations WHERE version = \$1`).
+		WithArgs(20230101000002).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectExists()
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(20230101000001))
+
+	// MigrateUpTo(20230101000002)
+	expectExists()
+	expectExists()
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(20230101000001))
+	mock.ExpectQuery(`SELECT version, COALESCE\(checksum, ''\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(20230101000001, ""))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO schema_migrations`).
+		WithArgs(20230101000002, "migration", "", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	result, err := m.Redo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"down", "up"}, calls)
+	assert.Equal(t, int64(20230101000002), result.StartVersion)
+	assert.Equal(t, int64(20230101000002), result.EndVersion)
+	require.Len(t, result.AppliedMigrations, 1)
+	assert.Equal(t, int64(20230101000002), result.AppliedMigrations[0].Version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// 测试没有已应用迁移时 Redo 返回错误
+func TestMigrator_RedoNothingApplied(t *testing.T) {
+	m, mock, cleanup := setupMigratorTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec(`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
+
+	_, err := m.Redo(context.Background())
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// 测试迁移前后回调
+func TestMigrator_Hooks(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	var events []string
+	var afterErrs []error
+	m, err := NewMigrator(&DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"},
+		WithBeforeMigrate(func(migration types.Migration) {
+			events = append(events, "before:"+migration.Name)
+		}),
+		WithAfterMigrate(func(migration types.Migration, err error) {
+			events = append(events, "after:"+migration.Name)
+			afterErrs = append(afterErrs, err)
+		}),
+	)
+	require.NoError(t, err)
+
+	upErr := errors.New("boom")
+	require.NoError(t, m.Register(types.Migration{
+		Version: 1,
+		Name:    "first",
+		UpFn: func(ctx context.Context, db types.DB) error {
+			events = append(events, "up:first")
+			return nil
+		},
+	}))
+	require.NoError(t, m.Register(types.Migration{
+		Version: 2,
+		Name:    "second",
+		UpFn: func(ctx context.Context, db types.DB) error {
+			events = append(events, "up:second")
+			return upErr
+		},
+	}))
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
+	mock.ExpectQuery(`SELECT version, COALESCE\(checksum, ''\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO schema_migrations`).
+		WithArgs(1, "first", "", nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	_, err = m.MigrateUp(context.Background())
+	require.ErrorIs(t, err, upErr)
+
+	assert.Equal(t, []string{
+		"before:first", "up:first", "after:first",
+		"before:second", "up:second", "after:second",
+	}, events)
+	require.Len(t, afterErrs, 2)
+	assert.NoError(t, afterErrs[0])
+	assert.ErrorIs(t, afterErrs[1], upErr)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// 测试迁移超时
+func TestMigrator_MigrationTimeout(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	// 只有一条连接时，未使用迁移事务的语句会一直等待，无法在超时前执行
+	sqlxDB := sqlx.NewDb(mockDB, "postgres")
+	sqlxDB.SetMaxOpenConns(1)
+	m, err := NewMigrator(&DB{db: sqlxDB, name: "test_db"},
+		WithMigrationTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+
+	require.NoError(t, m.Register(types.Migration{
+		Version: 1,
+		Name:    "stuck",
+		UpFn: func(ctx context.Context, db types.DB) error {
+			// 超时前已执行的语句
+			rows, err := db.Query(ctx, "CREATE TABLE partial (id INT)")
+			if err != nil {
+				return err
+			}
+			rows.Close()
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+				return nil
+			}
+		},
+	}))
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
+	mock.ExpectQuery(`SELECT version, COALESCE\(checksum, ''\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^CREATE TABLE partial \(id INT\)$`).WillReturnRows(sqlmock.NewRows(nil))
+	// CREATE TABLE 在迁移事务内执行，随超时回滚一并撤销；不写入版本记录
+	mock.ExpectRollback()
+
+	start := time.Now()
+	result, err := m.MigrateUp(context.Background())
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrMigrationTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+	require.NotNil(t, result)
+	require.NotNil(t, result.TimedOutMigration)
+	assert.Equal(t, int64(1), result.TimedOutMigration.Version)
+	assert.Empty(t, result.AppliedMigrations)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// 测试未注册迁移时的行为
+func TestMigrator_RequireMigrations(t *testing.T) {
+	t.Run("required", func(t *testing.T) {
+		mockDB, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer mockDB.Close()
+
+		m, err := NewMigrator(&DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}, WithRequireMigrations())
+		require.NoError(t, err)
+
+		result, err := m.MigrateUp(context.Background())
+		assert.ErrorIs(t, err, ErrNoMigrationsRegistered)
+		assert.Nil(t, result)
+		// 不访问数据库
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("default", func(t *testing.T) {
+		m, mock, cleanup := setupMigratorTest(t)
+		defer cleanup()
+
+		mock.ExpectQuery(`SELECT EXISTS`).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectExec(`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT EXISTS`).
+			WithArgs("schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(0))
+		mock.ExpectQuery(`SELECT version, COALESCE\(checksum, ''\) FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+
+		result, err := m.MigrateUp(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, result.AppliedMigrations)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
 // 测试创建迁移表功能
 func TestMigrator_CreateMigrationsTable(t *testing.T) {
 	// 设置测试环境
@@ -151,7 +647,7 @@ func TestMigrator_CreateMigrationsTable(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 
 	// 创建表 - 需要匹配确切的SQL，使用ExpectExec而不是ExpectQuery
-	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations \(version BIGINT PRIMARY KEY NOT NULL,name VARCHAR\(255\) NOT NULL,description TEXT,applied_at TIMESTAMP WITH TIME ZONE NOT NULL\)`).
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations \(version BIGINT PRIMARY KEY NOT NULL,name VARCHAR\(255\) NOT NULL,description TEXT,applied_at TIMESTAMP WITH TIME ZONE NOT NULL,checksum VARCHAR\(64\)\)`).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
 	err := m.CreateMigrationsTable(ctx)
@@ -171,6 +667,54 @@ func TestMigrator_CreateMigrationsTable(t *testing.T) {
 	}
 }
 
+// 并发迁移器抢先建表时，42P07 视为成功
+func TestMigrator_CreateMigrationsTableConcurrent(t *testing.T) {
+	m, mock, cleanup := setupMigratorTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnError(&pq.Error{Code: "42P07", Message: `relation "schema_migrations" already exists`})
+
+	err := m.CreateMigrationsTable(ctx)
+	assert.NoError(t, err)
+
+	// 并发执行 IF NOT EXISTS 时通常报告的是行类型的唯一冲突
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "pg_type_typname_nsp_index",
+			Message: `duplicate key value violates unique constraint "pg_type_typname_nsp_index"`})
+
+	err = m.CreateMigrationsTable(ctx)
+	assert.NoError(t, err)
+
+	// 其他唯一冲突与其他错误仍然返回
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "some_other_key"})
+
+	err = m.CreateMigrationsTable(ctx)
+	assert.Error(t, err)
+
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).
+		WillReturnError(&pq.Error{Code: "42501", Message: "permission denied for schema public"})
+
+	err = m.CreateMigrationsTable(ctx)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // 测试获取当前版本功能
 func TestMigrator_GetCurrentVersion(t *testing.T) {
 	// 设置测试环境
@@ -184,6 +728,10 @@ func TestMigrator_GetCurrentVersion(t *testing.T) {
 		WithArgs("schema_migrations").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
+	// 已存在的旧版迁移表补充 checksum 列（每个迁移器实例仅一次）
+	mock.ExpectExec(`ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS checksum VARCHAR\(64\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
 	// 获取当前版本
 	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
 		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(20230101000001))
@@ -237,3 +785,86 @@ func TestMigrationHelperFunctions(t *testing.T) {
 	assert.NotNil(t, sqlMigration.UpFn)
 	assert.NotNil(t, sqlMigration.DownFn)
 }
+
+// 测试多语句SQL拆分
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "single statement without semicolon",
+			sql:  "SELECT 1",
+			want: []string{"SELECT 1"},
+		},
+		{
+			name: "multiple statements",
+			sql:  "CREATE TABLE a (id INT);\nCREATE INDEX idx_a ON a (id);\n",
+			want: []string{"CREATE TABLE a (id INT)", "CREATE INDEX idx_a ON a (id)"},
+		},
+		{
+			name: "semicolons inside literals and identifiers",
+			sql:  `INSERT INTO "odd;name" VALUES ('a;b', 'it''s;ok'); SELECT 2`,
+			want: []string{`INSERT INTO "odd;name" VALUES ('a;b', 'it''s;ok')`, "SELECT 2"},
+		},
+		{
+			name: "comments and empty statements",
+			sql:  "-- leading; comment\nSELECT 1; /* block; */ ;\n-- trailing;",
+			want: []string{"-- leading; comment\nSELECT 1"},
+		},
+		{
+			name: "dollar quoted function body",
+			sql: `CREATE FUNCTION f() RETURNS trigger AS $body$
+BEGIN
+  NEW.updated_at = NOW(); RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+SELECT $1, $$a;b$$`,
+			want: []string{
+				"CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n  NEW.updated_at = NOW(); RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql",
+				"SELECT $1, $$a;b$$",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitSQLStatements(tt.sql))
+		})
+	}
+}
+
+// 测试多语句SQL文件迁移逐条执行
+func TestFileMigration_MultiStatement(t *testing.T) {
+	upFile := filepath.Join(t.TempDir(), "up.sql")
+	upSQL := `CREATE TABLE items (id SERIAL PRIMARY KEY, updated_at TIMESTAMPTZ);
+CREATE FUNCTION touch() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at = NOW();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+CREATE INDEX idx_items_updated_at ON items (updated_at);
+`
+	require.NoError(t, os.WriteFile(upFile, []byte(upSQL), 0o644))
+
+	migration, err := FileMigration(1, "items", "", upFile, filepath.Join(t.TempDir(), "missing.sql"))
+	require.NoError(t, err)
+
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db := &DB{db: sqlx.NewDb(mockDB, "postgres"), name: "test_db"}
+
+	mock.ExpectQuery("CREATE TABLE items (id SERIAL PRIMARY KEY, updated_at TIMESTAMPTZ)").
+		WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectQuery("CREATE FUNCTION touch() RETURNS trigger AS $$\nBEGIN\n  NEW.updated_at = NOW();\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql").
+		WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectQuery("CREATE INDEX idx_items_updated_at ON items (updated_at)").
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	require.NoError(t, migration.UpFn(context.Background(), db))
+	require.NoError(t, migration.DownFn(context.Background(), db))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,11 +3,19 @@ package postgresql_helper
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/songzhibin97/postgresql_helper/types"
 )
 
@@ -18,14 +26,70 @@ type Query struct {
 	table  string
 	config types.QueryConfig
 	args   []interface{}
+
+	cacheKey string        // 结果缓存键，为空表示不缓存
+	cacheTTL time.Duration // 结果缓存有效期
+
+	err error // 构建阶段的参数错误，在执行时返回
+
+	softDeleteColumn string          // 软删除标记列，为空表示不过滤
+	softDeleteScope  softDeleteScope // 软删除记录的可见范围
+
+	source     string        // FROM 子查询（如 UNION 结果），非空时以 table 作为别名；占位符已编号为 $N
+	sourceArgs []interface{} // source 的参数，位于 WHERE 等条件参数之前
+
+	comment string // 已清理的SQL注释内容，非空时以 /* comment */ 前缀写入查询
 }
 
+// unionAlias 是 Union / UnionAll 结果子查询的别名，外层条件与排序直接引用合并后的列名
+const unionAlias = "union_result"
+
+// softDeleteScope 控制软删除记录是否出现在查询结果中
+type softDeleteScope int
+
+const (
+	excludeDeleted softDeleteScope = iota // 默认：排除已删除记录
+	includeDeleted                        // 包含已删除记录
+	onlyDeleted                           // 只返回已删除记录
+)
+
+// Select 设置查询字段，空白字段会被忽略，全部为空时查询 *
 func (q Query) Select(fields ...string) types.Query {
 	newQuery := q.clone()
-	newQuery.config.SelectFields = fields
+	selected := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			selected = append(selected, field)
+		}
+	}
+	newQuery.config.SelectFields = selected
 	return newQuery
 }
 
+// SelectAs 以 表达式 -> 别名 的映射设置查询字段，生成 expr AS alias，按表达式排序以保证SQL稳定
+// 与 Select 相同会替换已有的查询字段；别名必须是合法标识符，否则执行查询时返回错误
+func (q Query) SelectAs(aliases map[string]string) types.Query {
+	newQuery := q.clone()
+	exprs := make([]string, 0, len(aliases))
+	for expr := range aliases {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+
+	selected := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		alias := strings.TrimSpace(aliases[expr])
+		if strings.TrimSpace(expr) == "" || !isColumnIdentifier(alias) || strings.Contains(alias, ".") {
+			newQuery.err = fmt.Errorf("%w: invalid select alias %q for expression %q", types.ErrInvalidStructure, alias, expr)
+			return newQuery
+		}
+		selected = append(selected, strings.TrimSpace(expr)+" AS "+alias)
+	}
+	newQuery.config.SelectFields = selected
+	return newQuery
+}
+
+// Where 设置查询条件，占位符可以写作 ? 或 $N；jsonb 的 ?、?| 与 ?& 运算符需写作 ??、??| 与 ??&
 func (q Query) Where(conditions string, args ...interface{}) types.Query {
 	newQuery := q.clone()
 	newQuery.config.WhereClause = conditions
@@ -39,6 +103,57 @@ func (q Query) OrderBy(fields string) types.Query {
 	return newQuery
 }
 
+// OrderByFields 按结构化字段排序，校验字段名与方向，无效时记录错误并在执行时返回
+func (q Query) OrderByFields(fields []types.OrderField) types.Query {
+	newQuery := q.clone()
+	orderBy, err := buildOrderByFields(fields)
+	if err != nil {
+		newQuery.err = err
+		return newQuery
+	}
+	newQuery.config.OrderBy = orderBy
+	return newQuery
+}
+
+// buildOrderByFields 将排序字段转换为 ORDER BY 子句内容
+func buildOrderByFields(fields []types.OrderField) (string, error) {
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%w: at least one order field is required", types.ErrInvalidStructure)
+	}
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		if !isColumnIdentifier(field.Name) {
+			return "", fmt.Errorf("%w: invalid order field %q", types.ErrInvalidStructure, field.Name)
+		}
+		direction := strings.ToUpper(strings.TrimSpace(field.Direction))
+		if direction != "ASC" && direction != "DESC" {
+			return "", fmt.Errorf("%w: invalid order direction %q for %s, must be ASC or DESC",
+				types.ErrInvalidStructure, field.Direction, field.Name)
+		}
+		parts[i] = field.Name + " " + direction
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// isColumnIdentifier 判断是否为普通列名或 表.列 形式，防止排序字段注入任意SQL
+func isColumnIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, part := range strings.Split(name, ".") {
+		if part == "" {
+			return false
+		}
+		for i, r := range part {
+			if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') {
+				continue
+			}
+			return false
+		}
+	}
+	return true
+}
+
 func (q Query) Limit(n int) types.Query {
 	newQuery := q.clone()
 	newQuery.config.Limit = n
@@ -63,6 +178,32 @@ func (q Query) GroupBy(fields string) types.Query {
 	return newQuery
 }
 
+// GroupByRollup 生成 GROUP BY ROLLUP (a, b)，在分组结果之外追加逐级小计和总计行
+func (q Query) GroupByRollup(fields ...string) types.Query {
+	newQuery := q.clone()
+	if len(fields) == 0 {
+		newQuery.err = fmt.Errorf("%w: at least one rollup field is required", types.ErrInvalidStructure)
+		return newQuery
+	}
+	newQuery.config.GroupBy = fmt.Sprintf("ROLLUP (%s)", strings.Join(fields, ", "))
+	return newQuery
+}
+
+// GroupByGroupingSets 生成 GROUP BY GROUPING SETS ((a, b), (a), ())，空集合表示总计行
+func (q Query) GroupByGroupingSets(sets [][]string) types.Query {
+	newQuery := q.clone()
+	if len(sets) == 0 {
+		newQuery.err = fmt.Errorf("%w: at least one grouping set is required", types.ErrInvalidStructure)
+		return newQuery
+	}
+	parts := make([]string, len(sets))
+	for i, set := range sets {
+		parts[i] = "(" + strings.Join(set, ", ") + ")"
+	}
+	newQuery.config.GroupBy = fmt.Sprintf("GROUPING SETS (%s)", strings.Join(parts, ", "))
+	return newQuery
+}
+
 func (q Query) Having(conditions string) types.Query {
 	newQuery := q.clone()
 	newQuery.config.Having = conditions
@@ -72,32 +213,564 @@ func (q Query) Having(conditions string) types.Query {
 func (q Query) ForUpdate() types.Query {
 	newQuery := q.clone()
 	newQuery.config.ForUpdate = true
+	newQuery.config.LockMode = ""
+	newQuery.config.LockTables = nil
+	return newQuery
+}
+
+// ForUpdateOf 添加 FOR UPDATE OF a, b，只锁定指定表（或别名）的行，常用于 JOIN 查询
+// 未指定表时等同于 ForUpdate
+func (q Query) ForUpdateOf(tables ...string) types.Query {
+	newQuery := q.ForUpdate().(*Query)
+	for _, table := range tables {
+		if table = strings.TrimSpace(table); table != "" {
+			newQuery.config.LockTables = append(newQuery.config.LockTables, table)
+		}
+	}
+	return newQuery
+}
+
+// ForShare 添加 FOR SHARE 行锁
+func (q Query) ForShare() types.Query {
+	return q.lock("SHARE")
+}
+
+// ForNoKeyUpdate 添加 FOR NO KEY UPDATE 行锁
+func (q Query) ForNoKeyUpdate() types.Query {
+	return q.lock("NO KEY UPDATE")
+}
+
+// ForKeyShare 添加 FOR KEY SHARE 行锁
+func (q Query) ForKeyShare() types.Query {
+	return q.lock("KEY SHARE")
+}
+
+// lock 设置行锁模式并清除 FOR UPDATE，保证只渲染一个锁子句
+func (q Query) lock(mode string) types.Query {
+	newQuery := q.clone()
+	newQuery.config.ForUpdate = false
+	newQuery.config.LockMode = mode
+	newQuery.config.LockTables = nil
+	return newQuery
+}
+
+// WhereExists 添加 EXISTS 子查询条件
+// 子查询参数追加在已有参数之后
+func (q Query) WhereExists(subquery string, args ...interface{}) types.Query {
+	newQuery := q.clone()
+	newQuery.andWhere(fmt.Sprintf("EXISTS (%s)", subquery), args...)
+	return newQuery
+}
+
+// WhereNotExists 添加 NOT EXISTS 子查询条件
+func (q Query) WhereNotExists(subquery string, args ...interface{}) types.Query {
+	newQuery := q.clone()
+	newQuery.andWhere(fmt.Sprintf("NOT EXISTS (%s)", subquery), args...)
+	return newQuery
+}
+
+// WhereRaw 原样追加一个已构建好的条件
+// 条件文本不做任何改写，$N 按已有参数之后的绝对位置编写，例如已有两个参数时使用 $3、$4；
+// 也可使用 ?，由构建阶段统一编号
+func (q Query) WhereRaw(clause string, args ...interface{}) types.Query {
+	newQuery := q.clone()
+	newQuery.andWhere(clause, args...)
+	return newQuery
+}
+
+// WhereNamed 使用 :name 命名参数追加条件（与 Table.Update/Delete 一致），与已有条件以AND组合
+// 命名参数经 sqlx.Named 转换后与其他条件统一编号为 $N；参数缺失时执行查询返回错误
+func (q Query) WhereNamed(clause string, args map[string]interface{}) types.Query {
+	newQuery := q.clone()
+	condition, positional, err := sqlx.Named(clause, args)
+	if err != nil {
+		newQuery.err = fmt.Errorf("%w: bind named where clause: %v", types.ErrInvalidStructure, err)
+		return newQuery
+	}
+	newQuery.andWhere(condition, positional...)
+	return newQuery
+}
+
+// WhereNullSafeEq 追加 column IS NOT DISTINCT FROM value 条件，与已有条件以AND组合
+// 与 = 不同，value 为 nil 时匹配 column 为 NULL 的行
+func (q Query) WhereNullSafeEq(column string, value interface{}) types.Query {
+	newQuery := q.clone()
+	newQuery.andWhere(column+" IS NOT DISTINCT FROM ?", value)
+	return newQuery
+}
+
+// WhereFullText 追加 column @@ plainto_tsquery(query) 全文检索条件，与已有条件以AND组合
+// column 为 tsvector 列或表达式（如 to_tsvector('english', body)），query 作为参数绑定；
+// language 指定文本搜索配置（如 "english"），省略时使用服务端的 default_text_search_config
+func (q Query) WhereFullText(column, query string, language ...string) types.Query {
+	newQuery := q.clone()
+	tsQuery, err := plainToTSQuery("?", language)
+	if err != nil {
+		newQuery.err = err
+		return newQuery
+	}
+	newQuery.andWhere(column+" @@ "+tsQuery, query)
+	return newQuery
+}
+
+// OrderByRank 按 ts_rank(column, plainto_tsquery(query)) 降序排序，替换已有的排序
+// 通常与相同参数的 WhereFullText 配合使用；query 以转义后的字面量写入 ORDER BY
+func (q Query) OrderByRank(column, query string, language ...string) types.Query {
+	newQuery := q.clone()
+	tsQuery, err := plainToTSQuery(pq.QuoteLiteral(query), language)
+	if err != nil {
+		newQuery.err = err
+		return newQuery
+	}
+	newQuery.config.OrderBy = "ts_rank(" + column + ", " + tsQuery + ") DESC"
+	return newQuery
+}
+
+// plainToTSQuery 生成 plainto_tsquery 调用，language 只能是标识符，防止注入
+func plainToTSQuery(arg string, language []string) (string, error) {
+	if len(language) == 0 || language[0] == "" {
+		return "plainto_tsquery(" + arg + ")", nil
+	}
+	if !isColumnIdentifier(language[0]) {
+		return "", fmt.Errorf("%w: invalid text search configuration %q", types.ErrInvalidStructure, language[0])
+	}
+	return "plainto_tsquery('" + language[0] + "', " + arg + ")", nil
+}
+
+// WhereIn 追加 column IN (...) 条件，values 必须是非空切片或数组，与已有条件以AND组合
+// 超过 1000 个值时改为 column = ANY($n)，整个列表作为一个数组参数绑定
+func (q Query) WhereIn(column string, values interface{}) types.Query {
+	newQuery := q.clone()
+	newQuery.whereInList(column, "IN", values)
+	return newQuery
+}
+
+// WhereNotIn 追加 column NOT IN (...) 条件，values 必须是非空切片或数组，与已有条件以AND组合
+// 超过 1000 个值时改为 column <> ALL($n)
+func (q Query) WhereNotIn(column string, values interface{}) types.Query {
+	newQuery := q.clone()
+	newQuery.whereInList(column, "NOT IN", values)
+	return newQuery
+}
+
+// whereInArrayThreshold WhereIn / WhereNotIn 展开为逐个占位符的最大值数量，超过时改用数组参数
+const whereInArrayThreshold = 1000
+
+// whereInList 将切片展开为占位符列表，值数量超过 whereInArrayThreshold 时生成 = ANY(?) / <> ALL(?)；
+// 参数无效时记录错误，在执行时返回
+func (q *Query) whereInList(column, op string, values interface{}) {
+	val := reflect.ValueOf(values)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		q.err = fmt.Errorf("%w: %s %s requires a slice, got %T", types.ErrInvalidStructure, column, op, values)
+		return
+	}
+	if val.Len() == 0 {
+		q.err = fmt.Errorf("%w: %s %s requires at least one value", types.ErrInvalidStructure, column, op)
+		return
+	}
+
+	// 值较多时绑定为单个数组参数，避免超出 PostgreSQL 单条语句 65535 个参数的上限
+	if val.Len() > whereInArrayThreshold {
+		if op == "IN" {
+			q.andWhere(column+" = ANY(?)", pq.Array(values))
+		} else {
+			q.andWhere(column+" <> ALL(?)", pq.Array(values))
+		}
+		return
+	}
+
+	placeholders := make([]string, val.Len())
+	args := make([]interface{}, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		placeholders[i] = "?"
+		args[i] = val.Index(i).Interface()
+	}
+	q.andWhere(fmt.Sprintf("%s %s (%s)", column, op, strings.Join(placeholders, ", ")), args...)
+}
+
+// andWhere 将条件以AND方式合并到已有WHERE子句，并追加对应参数
+func (q *Query) andWhere(condition string, args ...interface{}) {
+	if q.config.WhereClause != "" {
+		q.config.WhereClause = fmt.Sprintf("(%s) AND (%s)", q.config.WhereClause, condition)
+	} else {
+		q.config.WhereClause = condition
+	}
+	q.args = append(q.args, args...)
+}
+
+// ClearWhere 返回清除 WHERE 条件及其参数的副本，用于在同一基础查询上重新设置过滤条件
+// 查询参数都来自 WHERE 类条件（Where、WhereRaw、WhereIn、WithCursor 等），因此一并清空；
+// 软删除过滤在构建时追加，不受影响
+func (q Query) ClearWhere() types.Query {
+	newQuery := q.clone()
+	newQuery.config.WhereClause = ""
+	newQuery.args = nil
+	return newQuery
+}
+
+// ClearOrder 返回清除 ORDER BY 的副本
+func (q Query) ClearOrder() types.Query {
+	newQuery := q.clone()
+	newQuery.config.OrderBy = ""
+	return newQuery
+}
+
+// Cached 启用结果缓存，仅对 GetAll 生效；未配置 DBConfig.Cache 时无效果
+func (q Query) Cached(key string, ttl time.Duration) types.Query {
+	newQuery := q.clone()
+	newQuery.cacheKey = key
+	newQuery.cacheTTL = ttl
 	return newQuery
 }
 
 func (q Query) clone() *Query {
 	return &Query{
-		DB:     q.DB,
-		table:  q.table,
-		config: q.config,
-		args:   append([]interface{}{}, q.args...),
+		DB:       q.DB,
+		table:    q.table,
+		config:   q.config,
+		args:     append([]interface{}{}, q.args...),
+		cacheKey: q.cacheKey,
+		cacheTTL: q.cacheTTL,
+		err:      q.err,
+
+		softDeleteColumn: q.softDeleteColumn,
+		softDeleteScope:  q.softDeleteScope,
+
+		source:     q.source,
+		sourceArgs: q.sourceArgs,
+
+		comment: q.comment,
+	}
+}
+
+// Comment 在生成的查询前添加 /* tag */ 注释，便于在 pg_stat_activity 和慢查询日志中识别来源，
+// 例如 Comment("app:checkout handler:submit")；多次调用以最后一次为准，tag 为空时移除注释。
+// tag 中的 /*、*/ 与控制字符会被移除，防止提前结束注释而注入SQL
+func (q Query) Comment(tag string) types.Query {
+	newQuery := q.clone()
+	newQuery.comment = sanitizeComment(tag)
+	return newQuery
+}
+
+// sanitizeComment 移除注释定界符与控制字符，PostgreSQL 的块注释可以嵌套，因此 /* 同样需要移除
+func sanitizeComment(tag string) string {
+	tag = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, tag)
+	for strings.Contains(tag, "*/") || strings.Contains(tag, "/*") {
+		tag = strings.ReplaceAll(strings.ReplaceAll(tag, "*/", ""), "/*", "")
+	}
+	return strings.TrimSpace(tag)
+}
+
+// commentPrefix 返回查询的注释前缀，未设置注释时为空
+func (q Query) commentPrefix() string {
+	if q.comment == "" {
+		return ""
+	}
+	return "/* " + q.comment + " */ "
+}
+
+// Union 返回 (q) UNION (other) 的合并查询，合并结果作为子查询，
+// 之后的 Where、OrderBy、WithCursor、Limit 等作用于合并后的结果，例如对两张表的记录按时间键集分页
+// 两个查询的选择列数量与类型须一致；各自的参数按顺序合并，占位符重新编号
+func (q Query) Union(other types.Query) types.Query {
+	return q.union("UNION", other)
+}
+
+// UnionAll 与 Union 相同，但使用 UNION ALL 保留重复行
+func (q Query) UnionAll(other types.Query) types.Query {
+	return q.union("UNION ALL", other)
+}
+
+func (q Query) union(op string, other types.Query) types.Query {
+	newQuery := &Query{DB: q.DB, table: unionAlias}
+	if q.err != nil {
+		newQuery.err = q.err
+		return newQuery
+	}
+	if other == nil {
+		newQuery.err = fmt.Errorf("%w: %s requires another query", types.ErrInvalidStructure, strings.ToLower(op))
+		return newQuery
+	}
+	if o, ok := other.(*Query); ok && o.err != nil {
+		newQuery.err = o.err
+		return newQuery
+	}
+
+	leftSQL, leftArgs := q.ToSQL()
+	rightSQL, rightArgs := other.ToSQL()
+	rightSQL = shiftPlaceholders(rightSQL, len(leftArgs)+1)
+
+	newQuery.source = "(" + leftSQL + ") " + op + " (" + rightSQL + ")"
+	newQuery.sourceArgs = append(leftArgs, rightArgs...)
+	return newQuery
+}
+
+// queryArgs 返回执行时的完整参数：FROM 子查询参数在前，条件参数在后
+func (q Query) queryArgs() []interface{} {
+	if len(q.sourceArgs) == 0 {
+		return q.args
+	}
+	return append(append([]interface{}{}, q.sourceArgs...), q.args...)
+}
+
+// WithDeleted 查询结果包含已软删除的记录
+func (q Query) WithDeleted() types.Query {
+	newQuery := q.clone()
+	newQuery.softDeleteScope = includeDeleted
+	return newQuery
+}
+
+// OnlyDeleted 只查询已软删除的记录
+func (q Query) OnlyDeleted() types.Query {
+	newQuery := q.clone()
+	newQuery.softDeleteScope = onlyDeleted
+	return newQuery
+}
+
+// softDeleteCondition 返回软删除过滤条件，未启用或包含已删除记录时为空
+func (q Query) softDeleteCondition() string {
+	if q.softDeleteColumn == "" {
+		return ""
+	}
+	switch q.softDeleteScope {
+	case includeDeleted:
+		return ""
+	case onlyDeleted:
+		return q.softDeleteColumn + " IS NOT NULL"
+	default:
+		return q.softDeleteColumn + " IS NULL"
+	}
+}
+
+// Raw 执行手写的查询并将结果扫描到 dest：切片指针接收多行，其他类型接收单行（没有结果返回 ErrRecordNotFound）
+// 不使用构建器的条件、排序等设置，但与构建器查询一样计入本表的指标，
+// 并在上下文中存在事务（InTx）时在该事务内执行，错误经过统一包装
+func (q Query) Raw(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return q.withMetrics(ctx, q.table, queryOper, func(ctx context.Context) error {
+		destType := reflect.TypeOf(dest)
+		if destType == nil || destType.Kind() != reflect.Ptr {
+			return q.wrapError(fmt.Errorf("%w: destination must be a non-nil pointer", types.ErrInvalidStructure), "execute raw query")
+		}
+		if destType.Elem().Kind() == reflect.Slice && !destType.Implements(scannerType) &&
+			destType.Elem().Elem().Kind() != reflect.Uint8 {
+			return q.wrapError(sqlx.SelectContext(ctx, q.queryer(ctx), dest, query, args...), "execute raw query")
+		}
+		return q.wrapError(sqlx.GetContext(ctx, q.queryer(ctx), dest, query, args...), "execute raw query")
+	})
+}
+
+// GetJSON 查询单个JSON列并反序列化到 dest
+// 适用于 json_agg、row_to_json 等在数据库端组装嵌套结构的查询
+func (q Query) GetJSON(ctx context.Context, dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	var raw []byte
+	query := q.buildSelectQuery()
+	if err := q.db.QueryRowxContext(ctx, query, q.queryArgs()...).Scan(&raw); err != nil {
+		return q.wrapError(err, "execute json query")
+	}
+	if raw == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return q.wrapError(err, "decode json result")
 	}
+	return nil
+}
+
+// ToSQL 返回 Get/GetAll 将要执行的SQL及参数副本，便于日志与测试
+func (q Query) ToSQL() (string, []interface{}) {
+	return q.buildSelectQuery(), append([]interface{}{}, q.queryArgs()...)
 }
 
 func (q Query) Get(ctx context.Context, dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
 	query := q.buildSelectQuery()
-	err := q.db.GetContext(ctx, dest, query, q.args...)
+	row := q.db.QueryRowxContext(ctx, query, q.queryArgs()...)
+	if !isStructDest(dest) {
+		return q.wrapError(row.Scan(dest), "execute get query")
+	}
+
+	columns, err := row.Columns()
+	if err == nil {
+		err = checkDuplicateColumns(columns)
+	}
+	if err == nil {
+		err = row.StructScan(dest)
+	}
 	return q.wrapError(err, "execute get query")
 }
 
 func (q Query) GetAll(ctx context.Context, dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	useCache := q.cacheKey != "" && q.cache != nil
+	if useCache {
+		if cached, ok := q.cache.Get(q.cacheKey); ok && loadCachedResult(dest, cached) {
+			return nil
+		}
+	}
+
+	// 未设置 LIMIT 时附加安全上限，多取一行用于判断是否超限
+	guarded := q.maxRowsWithoutLimit > 0 && q.config.Limit <= 0
+	if guarded {
+		q.config.Limit = q.maxRowsWithoutLimit + 1
+	}
+
 	query := q.buildSelectQuery()
-	err := q.db.SelectContext(ctx, dest, query, q.args...)
-	return q.wrapError(err, "execute get all query")
+	if err := q.selectContext(ctx, dest, query); err != nil {
+		return q.wrapError(err, "execute get all query")
+	}
+
+	if guarded {
+		if rows := reflect.ValueOf(dest).Elem(); rows.Len() > q.maxRowsWithoutLimit {
+			rows.Set(rows.Slice(0, q.maxRowsWithoutLimit))
+			return fmt.Errorf("%w: query on %s returned more than %d rows without LIMIT",
+				ErrRowLimitExceeded, q.table, q.maxRowsWithoutLimit)
+		}
+	}
+
+	if useCache {
+		q.cache.Set(q.cacheKey, copySliceValue(reflect.ValueOf(dest).Elem()).Interface(), q.cacheTTL)
+	}
+	return nil
+}
+
+// GetAllInto 将查询结果追加到 dest 指向的切片（*[]T）末尾，不清空已有元素，也不读写结果缓存
+// 容量足够时直接复用底层数组，循环中可通过 buf = buf[:0] 重置长度后再次传入以避免重复分配；
+// 若不需要保留上一次的结果，调用方必须先截断，否则新结果会接在旧结果之后
+func (q Query) GetAllInto(ctx context.Context, dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() || destValue.Elem().Kind() != reflect.Slice {
+		return q.wrapError(fmt.Errorf("%w: destination must be a non-nil pointer to a slice", types.ErrInvalidStructure), "get all into")
+	}
+	rows := destValue.Elem()
+
+	// sqlx 扫描前会将切片长度置零，因此扫描到从末尾开始的零长度子切片，共享剩余容量
+	tail := reflect.New(rows.Type())
+	tail.Elem().Set(rows.Slice(rows.Len(), rows.Len()))
+
+	// 与 GetAll 相同的安全上限，只统计本次追加的行
+	guarded := q.maxRowsWithoutLimit > 0 && q.config.Limit <= 0
+	if guarded {
+		q.config.Limit = q.maxRowsWithoutLimit + 1
+	}
+
+	if err := q.selectContext(ctx, tail.Interface(), q.buildSelectQuery()); err != nil {
+		return q.wrapError(err, "execute get all query")
+	}
+
+	var err error
+	if appended := tail.Elem(); guarded && appended.Len() > q.maxRowsWithoutLimit {
+		tail.Elem().Set(appended.Slice(0, q.maxRowsWithoutLimit))
+		err = fmt.Errorf("%w: query on %s returned more than %d rows without LIMIT",
+			ErrRowLimitExceeded, q.table, q.maxRowsWithoutLimit)
+	}
+	rows.Set(reflect.AppendSlice(rows, tail.Elem()))
+	return err
+}
+
+// selectContext 与 sqlx.SelectContext 相同，但结构体切片在扫描前检查结果集中的重复列名
+func (q Query) selectContext(ctx context.Context, dest interface{}, query string) error {
+	destType := reflect.TypeOf(dest)
+	if destType == nil || destType.Kind() != reflect.Ptr || destType.Elem().Kind() != reflect.Slice ||
+		!isStructDest(reflect.New(derefType(destType.Elem().Elem())).Interface()) {
+		return q.db.SelectContext(ctx, dest, query, q.queryArgs()...)
+	}
+
+	rows, err := q.db.QueryxContext(ctx, query, q.queryArgs()...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if err := checkDuplicateColumns(columns); err != nil {
+		return err
+	}
+	return sqlx.StructScan(rows, dest)
+}
+
+// checkDuplicateColumns 检查结果集中是否有重名列（常见于 JOIN 后未加别名的 SELECT）
+// sqlx 会将同名列扫描到同一字段，结果取决于列顺序，因此直接报错并提示使用别名
+func checkDuplicateColumns(columns []string) error {
+	seen := make(map[string]struct{}, len(columns))
+	for _, column := range columns {
+		if _, ok := seen[column]; ok {
+			return fmt.Errorf("%w: ambiguous column %q appears more than once in the result set, "+
+				"select it with an alias (e.g. table.%s AS table_%s)", types.ErrInvalidStructure, column, column, column)
+		}
+		seen[column] = struct{}{}
+	}
+	return nil
+}
+
+// isStructDest 判断 dest 是否需要按结构体字段扫描（排除 time.Time 等实现了 sql.Scanner 的类型）
+func isStructDest(dest interface{}) bool {
+	t := reflect.TypeOf(dest)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return false
+	}
+	if t.Implements(scannerType) {
+		return false
+	}
+	elem := t.Elem()
+	return elem.Kind() == reflect.Struct && elem != timeType
+}
+
+// derefType 返回指针类型指向的基础类型
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// loadCachedResult 将缓存值复制到 dest，类型不匹配时返回 false（按未命中处理）
+func loadCachedResult(dest interface{}, cached interface{}) bool {
+	destValue := reflect.ValueOf(dest)
+	cachedValue := reflect.ValueOf(cached)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() || !cachedValue.IsValid() ||
+		cachedValue.Type() != destValue.Elem().Type() {
+		return false
+	}
+	destValue.Elem().Set(copySliceValue(cachedValue))
+	return true
+}
+
+// copySliceValue 浅拷贝切片，避免调用方修改结果时影响缓存内容
+func copySliceValue(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Slice || v.IsNil() {
+		return v
+	}
+	copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(copied, v)
+	return copied
 }
 
 func (q Query) buildSelectQuery() string {
 	var sb strings.Builder
+	sb.WriteString(q.commentPrefix())
 
 	// SELECT
 	sb.WriteString("SELECT ")
@@ -107,18 +780,9 @@ func (q Query) buildSelectQuery() string {
 		sb.WriteString("*")
 	}
 
-	// FROM
-	sb.WriteString(" FROM " + q.table)
-
-	// JOINS
-	for _, join := range q.config.JoinClauses {
-		sb.WriteString(" " + join)
-	}
-
-	// WHERE
-	if q.config.WhereClause != "" {
-		sb.WriteString(" WHERE " + q.config.WhereClause)
-	}
+	// FROM / JOIN / WHERE
+	from, argIndex := q.buildFromClause()
+	sb.WriteString(from)
 
 	// GROUP BY
 	if q.config.GroupBy != "" {
@@ -127,7 +791,8 @@ func (q Query) buildSelectQuery() string {
 
 	// HAVING
 	if q.config.Having != "" {
-		sb.WriteString(" HAVING " + q.config.Having)
+		having, _ := renumberPlaceholders(q.config.Having, argIndex)
+		sb.WriteString(" HAVING " + having)
 	}
 
 	// ORDER BY
@@ -145,25 +810,113 @@ func (q Query) buildSelectQuery() string {
 		sb.WriteString(fmt.Sprintf(" OFFSET %d", q.config.Offset))
 	}
 
-	// FOR UPDATE
-	if q.config.ForUpdate {
+	// FOR UPDATE / FOR SHARE 等行锁
+	if q.config.LockMode != "" {
+		sb.WriteString(" FOR " + q.config.LockMode)
+	} else if q.config.ForUpdate {
 		sb.WriteString(" FOR UPDATE")
+		if len(q.config.LockTables) > 0 {
+			sb.WriteString(" OF " + strings.Join(q.config.LockTables, ", "))
+		}
 	}
 
 	return sb.String()
 }
 
-func (q Query) Count(ctx context.Context) (int64, error) {
-	var count int64
-	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", q.table)
+// buildFromClause 构建 FROM、JOIN 和 WHERE 部分，返回SQL片段及下一个可用的参数编号
+// 占位符按子句出现顺序统一编号
+func (q Query) buildFromClause() (string, int) {
+	var sb strings.Builder
+	argIndex := 1
+	if q.source != "" {
+		sb.WriteString(" FROM (" + q.source + ") AS " + q.table)
+		argIndex += len(q.sourceArgs)
+	} else {
+		sb.WriteString(" FROM " + q.table)
+	}
+
+	// JOINS
+	for _, join := range q.config.JoinClauses {
+		join, argIndex = renumberPlaceholders(join, argIndex)
+		sb.WriteString(" " + join)
+	}
+
+	// WHERE
+	var where string
 	if q.config.WhereClause != "" {
-		query += " WHERE " + q.config.WhereClause
+		where, argIndex = renumberPlaceholders(q.config.WhereClause, argIndex)
+	}
+	if cond := q.softDeleteCondition(); cond != "" {
+		if where != "" {
+			where = "(" + where + ") AND " + cond
+		} else {
+			where = cond
+		}
+	}
+	if where != "" {
+		sb.WriteString(" WHERE " + where)
+	}
+
+	return sb.String(), argIndex
+}
+
+// Count 统计满足条件的记录数
+// 包含 JOIN；设置了 GROUP BY 或 SELECT DISTINCT 时统计分组/去重后的行数
+func (q Query) Count(ctx context.Context) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
 	}
-	err := q.db.GetContext(ctx, &count, query, q.args...)
+	var count int64
+	err := q.db.GetContext(ctx, &count, q.buildCountQuery(), q.queryArgs()...)
 	return count, q.wrapError(err, "execute count query")
 }
 
+func (q Query) buildCountQuery() string {
+	if q.config.GroupBy != "" || q.isDistinct() {
+		// 分组或去重后的行数需要以子查询方式统计，排序与分页不影响总数
+		inner := q.clone()
+		inner.config.OrderBy = ""
+		inner.config.Limit = 0
+		inner.config.Offset = 0
+		inner.config.ForUpdate = false
+		inner.config.LockMode = ""
+		inner.config.LockTables = nil
+		inner.comment = ""
+		return fmt.Sprintf("%sSELECT COUNT(*) FROM (%s) AS sub", q.commentPrefix(), inner.buildSelectQuery())
+	}
+
+	from, _ := q.buildFromClause()
+	return q.commentPrefix() + "SELECT COUNT(*)" + from
+}
+
+// CountDistinct 统计满足 WHERE / JOIN 条件的记录中 column 的不同非 NULL 值个数
+// 生成 SELECT COUNT(DISTINCT column) FROM ...；SELECT 字段、GROUP BY、HAVING、排序与分页不参与统计
+func (q Query) CountDistinct(ctx context.Context, column string) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	if column = strings.TrimSpace(column); column == "" {
+		return 0, q.wrapError(fmt.Errorf("%w: column is required", types.ErrInvalidStructure), "count distinct")
+	}
+	var count int64
+	from, _ := q.buildFromClause()
+	err := q.db.GetContext(ctx, &count, q.commentPrefix()+"SELECT COUNT(DISTINCT "+column+")"+from, q.queryArgs()...)
+	return count, q.wrapError(err, "execute count distinct query")
+}
+
+// isDistinct 查询字段是否以 DISTINCT 开头
+func (q Query) isDistinct() bool {
+	if len(q.config.SelectFields) == 0 {
+		return false
+	}
+	first := strings.ToUpper(strings.TrimSpace(q.config.SelectFields[0]))
+	return strings.HasPrefix(first, "DISTINCT ") || strings.HasPrefix(first, "DISTINCT(")
+}
+
 func (q Query) Exists(ctx context.Context) (bool, error) {
+	if q.err != nil {
+		return false, q.err
+	}
 	// 构建优化查询
 	tmpQuery := q.clone()
 	tmpQuery.config.SelectFields = []string{"1"}
@@ -172,7 +925,7 @@ func (q Query) Exists(ctx context.Context) (bool, error) {
 	queryStr := tmpQuery.buildSelectQuery()
 
 	// 执行查询
-	row := tmpQuery.db.QueryRowContext(ctx, queryStr, tmpQuery.args...)
+	row := tmpQuery.db.QueryRowContext(ctx, queryStr, tmpQuery.queryArgs()...)
 
 	var result int
 	err := row.Scan(&result)
@@ -187,6 +940,27 @@ func (q Query) Exists(ctx context.Context) (bool, error) {
 	}
 }
 
+// FindDuplicates 查找 columns 取值重复的分组，并将结果扫描到 dest 切片
+// 生成 SELECT columns, COUNT(*) AS count ... GROUP BY columns HAVING COUNT(*) > 1，
+// 已设置的 WHERE / JOIN 条件仍然生效，结构体可通过 db:"count" 字段接收重复次数
+func (q Query) FindDuplicates(ctx context.Context, columns []string, dest interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	if len(columns) == 0 {
+		return q.wrapError(fmt.Errorf("%w: at least one column is required", types.ErrInvalidStructure), "find duplicates")
+	}
+
+	tmpQuery := q.clone()
+	tmpQuery.config.SelectFields = append(append([]string{}, columns...), "COUNT(*) AS count")
+	tmpQuery.config.GroupBy = strings.Join(columns, ", ")
+	tmpQuery.config.Having = "COUNT(*) > 1"
+	if tmpQuery.config.OrderBy == "" {
+		tmpQuery.config.OrderBy = "count DESC"
+	}
+	return tmpQuery.GetAll(ctx, dest)
+}
+
 // WithCursor 实现基于游标的分页
 func (q Query) WithCursor(keyField string, cursor *types.Cursor) types.Query {
 	newQuery := q.clone()
@@ -201,17 +975,16 @@ func (q Query) WithCursor(keyField string, cursor *types.Cursor) types.Query {
 		newQuery = newQuery.Limit(cursor.Limit + 1).(*Query) // 获取比需要多一条记录以检查是否有更多页
 	}
 
-	// 如果没有键值，只应用限制
-	if cursor.KeyValue == nil {
-		return newQuery
-	}
-
-	// 解析查询的排序规则，以确定游标条件
+	// 未设置排序时按键字段和默认方向排序，首页（无键值）同样需要稳定的顺序
 	orderBy := newQuery.config.OrderBy
 	if orderBy == "" {
-		// 默认按键字段升序排序
-		orderBy = keyField + " ASC"
-		newQuery = newQuery.OrderBy(orderBy).(*Query)
+		orderBy = newQuery.defaultCursorOrder(keyField)
+		newQuery.config.OrderBy = orderBy
+	}
+
+	// 如果没有键值，只应用限制和排序
+	if cursor.KeyValue == nil {
+		return newQuery
 	}
 
 	// 分析排序规则
@@ -242,23 +1015,28 @@ func (q Query) WithCursor(keyField string, cursor *types.Cursor) types.Query {
 		}
 	}
 
-	// 构建WHERE子句
-	whereClause := fmt.Sprintf("%s %s ?", keyField, compareOp)
+	// 构建WHERE子句并添加到现有条件
+	// 使用 ? 占位符，构建阶段与已有条件中的 $N 统一编号
+	newQuery.andWhere(fmt.Sprintf("%s %s ?", keyField, compareOp), cursor.KeyValue)
 
-	// 添加到现有条件
-	if newQuery.config.WhereClause != "" {
-		newQuery.config.WhereClause = fmt.Sprintf("(%s) AND (%s)",
-			newQuery.config.WhereClause, whereClause)
-		newQuery.args = append(newQuery.args, cursor.KeyValue)
-	} else {
-		newQuery.config.WhereClause = whereClause
-		newQuery.args = []interface{}{cursor.KeyValue}
-	}
+	return newQuery
+}
 
+// DefaultCursorDirection 设置未指定 OrderBy 时游标分页的默认排序方向，无法识别的值按 ASC 处理
+func (q Query) DefaultCursorDirection(direction string) types.Query {
+	newQuery := q.clone()
+	newQuery.config.CursorDirection = strings.ToUpper(strings.TrimSpace(direction))
 	return newQuery
 }
 
-// GetPage 执行分页查询并返回结果
+// defaultCursorOrder 返回按键字段和默认方向构造的排序子句
+func (q Query) defaultCursorOrder(keyField string) string {
+	if q.config.CursorDirection == "DESC" {
+		return keyField + " DESC"
+	}
+	return keyField + " ASC"
+}
+
 // GetPage 执行分页查询并返回结果
 func (q Query) GetPage(ctx context.Context, dest interface{}, withCount bool) (*types.PageResult, error) {
 	// 验证目标是否为切片指针
@@ -297,20 +1075,7 @@ func (q Query) GetPage(ctx context.Context, dest interface{}, withCount bool) (*
 		result.HasNext = true
 
 		// 创建下一页游标
-		lastItem := resultSlice.Index(resultSlice.Len() - 1)
-
-		// 获取键字段值
-		// 注意：这里假设我们知道键字段的位置，实际实现中需要通过反射提取对应字段
-		// 此处简化实现，在实际代码中需要按字段名或标签查找
-		var keyValue interface{}
-
-		// 这里简化为取第一个字段作为键值
-		// 实际代码需要根据字段名查找
-		if lastItem.Kind() == reflect.Struct && lastItem.NumField() > 0 {
-			keyValue = lastItem.Field(0).Interface()
-		}
-
-		if keyValue != nil {
+		if keyValue := pageItemKey(resultSlice.Index(resultSlice.Len() - 1)); keyValue != nil {
 			result.NextCursor = &types.Cursor{
 				KeyValue: keyValue,
 				Forward:  true,
@@ -326,15 +1091,7 @@ func (q Query) GetPage(ctx context.Context, dest interface{}, withCount bool) (*
 		result.HasPrev = true
 
 		// 创建上一页游标
-		firstItem := resultSlice.Index(0)
-
-		// 获取键字段值（同样简化实现）
-		var keyValue interface{}
-		if firstItem.Kind() == reflect.Struct && firstItem.NumField() > 0 {
-			keyValue = firstItem.Field(0).Interface()
-		}
-
-		if keyValue != nil {
+		if keyValue := pageItemKey(resultSlice.Index(0)); keyValue != nil {
 			result.PrevCursor = &types.Cursor{
 				KeyValue: keyValue,
 				Forward:  false,
@@ -343,15 +1100,24 @@ func (q Query) GetPage(ctx context.Context, dest interface{}, withCount bool) (*
 		}
 	}
 
+	// 当前页的首尾游标与页大小，客户端可据此从页首向前或从页尾向后翻页
+	result.PageSize = originalLimit
+	if result.PageSize <= 0 {
+		result.PageSize = resultSlice.Len()
+	}
+	if n := resultSlice.Len(); n > 0 {
+		if keyValue := pageItemKey(resultSlice.Index(0)); keyValue != nil {
+			result.StartCursor = &types.Cursor{KeyValue: keyValue, Forward: false, Limit: result.PageSize}
+		}
+		if keyValue := pageItemKey(resultSlice.Index(n - 1)); keyValue != nil {
+			result.EndCursor = &types.Cursor{KeyValue: keyValue, Forward: true, Limit: result.PageSize}
+		}
+	}
+
 	// 如果需要，计算总记录数
 	if withCount {
 		// 创建一个新的查询对象，避免修改原始查询
-		tempQuery := Query{
-			DB:     q.DB,
-			table:  q.table,
-			config: q.config,                           // 拷贝原始配置
-			args:   append([]interface{}{}, q.args...), // 拷贝参数
-		}
+		tempQuery := q.clone()
 
 		// 重置LIMIT设置
 		tempQuery.config.Limit = 0
@@ -367,6 +1133,16 @@ func (q Query) GetPage(ctx context.Context, dest interface{}, withCount bool) (*
 	return result, nil
 }
 
+// pageItemKey 返回分页结果中一行的键值，简化为取结构体的第一个字段
+// []*T 的元素先解引用，nil 元素或非结构体返回 nil
+func pageItemKey(item reflect.Value) interface{} {
+	item = reflect.Indirect(item)
+	if item.Kind() != reflect.Struct || item.NumField() == 0 || !item.Field(0).CanInterface() {
+		return nil
+	}
+	return item.Field(0).Interface()
+}
+
 // PageByKeySince 基于指定键值进行分页，并返回从该键值开始的记录
 func (q Query) PageByKeySince(ctx context.Context, dest interface{}, keyField string, keyValue interface{}, limit int, withCount bool) (*types.PageResult, error) {
 	cursor := &types.Cursor{
@@ -389,6 +1165,235 @@ func (q Query) PageByKeyBefore(ctx context.Context, dest interface{}, keyField s
 	return q.WithCursor(keyField, cursor).GetPage(ctx, dest, withCount)
 }
 
+// Paginate 基于 keyField 的键集分页，返回可直接序列化给客户端的前后页 token
+// 排序方向取自 OrderBy 的第一个字段（未设置时见 DefaultCursorDirection），实际按 keyField 排序；
+// 向前翻页时按相反方向读取后再反转，保证 dest 中始终是正常顺序
+func (q Query) Paginate(ctx context.Context, dest interface{}, keyField string, token string, limit int) (*types.PageResult, error) {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() || destValue.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("%w: destination must be a pointer to slice", types.ErrInvalidStructure)
+	}
+	if keyField == "" || limit <= 0 {
+		return nil, fmt.Errorf("%w: keyField and a positive limit are required", types.ErrInvalidStructure)
+	}
+
+	cursor := &types.Cursor{Forward: true}
+	if token != "" {
+		decoded, err := DecodeCursor(token)
+		if err != nil {
+			return nil, err
+		}
+		cursor = decoded
+	}
+	cursor.Limit = limit
+
+	ascending := q.cursorAscending()
+	pageQuery := q.clone()
+	pageQuery.cacheKey = ""
+	if cursor.KeyValue != nil {
+		op := ">"
+		if ascending != cursor.Forward {
+			op = "<"
+		}
+		pageQuery.andWhere(fmt.Sprintf("%s %s ?", keyField, op), cursor.KeyValue)
+	}
+	// 向前翻页时反向读取，取紧邻游标的 limit 条
+	if ascending == cursor.Forward {
+		pageQuery.config.OrderBy = keyField + " ASC"
+	} else {
+		pageQuery.config.OrderBy = keyField + " DESC"
+	}
+	pageQuery.config.Limit = limit + 1
+
+	if err := pageQuery.GetAll(ctx, dest); err != nil {
+		return nil, q.wrapError(err, "execute page query")
+	}
+
+	rows := destValue.Elem()
+	hasMore := rows.Len() > limit
+	if hasMore {
+		rows.Set(rows.Slice(0, limit))
+	}
+	if !cursor.Forward {
+		swap := reflect.Swapper(rows.Interface())
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	result := &types.PageResult{Data: dest}
+	if cursor.Forward {
+		result.HasNext = hasMore
+		result.HasPrev = cursor.KeyValue != nil
+	} else {
+		result.HasNext = true
+		result.HasPrev = hasMore
+	}
+	if rows.Len() == 0 {
+		result.HasNext, result.HasPrev = false, false
+		return result, nil
+	}
+
+	if result.HasNext {
+		keyValue, err := rowKeyValue(rows.Index(rows.Len()-1), keyField, q.fieldMapper)
+		if err != nil {
+			return nil, err
+		}
+		result.NextCursor = &types.Cursor{KeyValue: keyValue, Forward: true, Limit: limit}
+		if result.NextToken, err = EncodeCursor(result.NextCursor); err != nil {
+			return nil, err
+		}
+	}
+	if result.HasPrev {
+		keyValue, err := rowKeyValue(rows.Index(0), keyField, q.fieldMapper)
+		if err != nil {
+			return nil, err
+		}
+		result.PrevCursor = &types.Cursor{KeyValue: keyValue, Forward: false, Limit: limit}
+		if result.PrevToken, err = EncodeCursor(result.PrevCursor); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// cursorAscending 判断游标分页的排序方向，规则与 WithCursor 相同
+func (q Query) cursorAscending() bool {
+	if q.config.OrderBy == "" {
+		return q.config.CursorDirection != "DESC"
+	}
+	first := strings.Fields(strings.Split(q.config.OrderBy, ",")[0])
+	return len(first) < 2 || strings.ToUpper(first[1]) != "DESC"
+}
+
+// EncodeCursor 将游标编码为 URL 安全的不透明字符串
+func EncodeCursor(cursor *types.Cursor) (string, error) {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// DecodeCursor 解码 EncodeCursor 生成的字符串
+// 整数键值解码为 int64，其余数字与时间等类型以字符串形式传给数据库，由数据库按列类型转换
+func DecodeCursor(token string) (*types.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid page token", types.ErrInvalidStructure)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	var cursor types.Cursor
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, fmt.Errorf("%w: invalid page token", types.ErrInvalidStructure)
+	}
+	if n, ok := cursor.KeyValue.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			cursor.KeyValue = i
+		} else {
+			cursor.KeyValue = n.String()
+		}
+	}
+	return &cursor, nil
+}
+
+// GetMapT 执行 GetAll 并按 keyFn 返回的键构建映射，键重复时后出现的行覆盖先出现的行
+func GetMapT[K comparable, V any](ctx context.Context, q types.Query, keyFn func(V) K) (map[K]V, error) {
+	var rows []V
+	if err := q.GetAll(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	result := make(map[K]V, len(rows))
+	for _, row := range rows {
+		result[keyFn(row)] = row
+	}
+	return result, nil
+}
+
+// ForEachPage 基于键集分页（WithCursor）逐页读取数据，并对每一页调用 fn
+// dest 为切片指针，仅用于确定元素类型；每一页都会新建切片传给 fn（类型为 []T），
+// fn 可以安全地持有该切片。fn 返回错误或 ctx 被取消时立即停止
+func (q Query) ForEachPage(ctx context.Context, dest interface{}, keyField string, pageSize int, fn func(batch interface{}) error) error {
+	destType := reflect.TypeOf(dest)
+	if destType == nil || destType.Kind() != reflect.Ptr || destType.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w: destination must be a pointer to slice", types.ErrInvalidStructure)
+	}
+	if keyField == "" || pageSize <= 0 {
+		return fmt.Errorf("%w: keyField and a positive pageSize are required", types.ErrInvalidStructure)
+	}
+
+	// 每一页的条件不同，不能共用同一个缓存键
+	base := q.clone()
+	base.cacheKey = ""
+	if base.config.OrderBy == "" {
+		base.config.OrderBy = base.defaultCursorOrder(keyField)
+	}
+
+	cursor := &types.Cursor{Forward: true, Limit: pageSize}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page := reflect.New(destType.Elem())
+		if err := base.WithCursor(keyField, cursor).GetAll(ctx, page.Interface()); err != nil {
+			return err
+		}
+
+		rows := page.Elem()
+		hasMore := rows.Len() > pageSize
+		if hasMore {
+			rows.Set(rows.Slice(0, pageSize))
+		}
+		if rows.Len() == 0 {
+			return nil
+		}
+
+		if err := fn(rows.Interface()); err != nil {
+			return err
+		}
+		if !hasMore {
+			return nil
+		}
+
+		keyValue, err := rowKeyValue(rows.Index(rows.Len()-1), keyField, q.fieldMapper)
+		if err != nil {
+			return err
+		}
+		cursor = &types.Cursor{KeyValue: keyValue, Forward: true, Limit: pageSize}
+	}
+}
+
+// rowKeyValue 从一行结果（结构体或 map）中取出键字段的值，keyField 可带表名前缀
+func rowKeyValue(row reflect.Value, keyField string, mapper func(string) string) (interface{}, error) {
+	if idx := strings.LastIndex(keyField, "."); idx >= 0 {
+		keyField = keyField[idx+1:]
+	}
+
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+
+	switch row.Kind() {
+	case reflect.Struct:
+		for i := 0; i < row.NumField(); i++ {
+			name, _, ok := fieldColumn(row.Type().Field(i), mapper)
+			if ok && name == keyField {
+				return row.Field(i).Interface(), nil
+			}
+		}
+	case reflect.Map:
+		if v := row.MapIndex(reflect.ValueOf(keyField)); v.IsValid() {
+			return v.Interface(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: key field %s not found in result row", types.ErrInvalidStructure, keyField)
+}
+
 // WithCompositeCursor 实现基于复合游标的分页
 // 这对于按多个字段排序的场景很有用
 func (q Query) WithCompositeCursor(cursor *types.CompositeCursor) types.Query {
@@ -396,13 +1401,8 @@ func (q Query) WithCompositeCursor(cursor *types.CompositeCursor) types.Query {
 		return q
 	}
 
-	// 创建新的Query实例作为拷贝，而不是使用类型断言
-	newQuery := Query{
-		DB:     q.DB,
-		table:  q.table,
-		config: q.config,                           // 拷贝配置
-		args:   append([]interface{}{}, q.args...), // 拷贝参数
-	}
+	// 创建新的Query实例作为拷贝，保留构建错误、软删除范围等全部状态
+	newQuery := q.clone()
 
 	// 设置分页大小
 	if cursor.Limit > 0 {
@@ -453,14 +1453,71 @@ func (q Query) WithCompositeCursor(cursor *types.CompositeCursor) types.Query {
 		strings.Join(fieldPlaceholders, ", "))
 
 	// 添加到现有条件
-	if newQuery.config.WhereClause != "" {
-		newQuery.config.WhereClause = fmt.Sprintf("(%s) AND (%s)",
-			newQuery.config.WhereClause, whereClause)
-		newQuery.args = append(newQuery.args, fieldValues...)
-	} else {
-		newQuery.config.WhereClause = whereClause
-		newQuery.args = fieldValues
+	newQuery.andWhere(whereClause, fieldValues...)
+
+	return newQuery
+}
+
+// renumberPlaceholders 将SQL片段中的占位符统一改写为从 startIndex 开始的 $N 形式
+// ? 依次分配下一个编号；$k 视为片段内第k个参数，映射为 $(startIndex+k-1)，
+// 因此同一片段中重复引用的 $k 保持一致。引号内的内容不做处理。
+// ?? 转义为字面量 ?，用于 jsonb 的 ?、?| 与 ?& 运算符，如 Where("data ?? 'k'")、Where("tags ??| ?", pq.Array(keys))。
+// 返回改写后的SQL以及下一个可用编号。
+func renumberPlaceholders(sql string, startIndex int) (string, int) {
+	return rewritePlaceholders(sql, startIndex, true)
+}
+
+// shiftPlaceholders 只将已生成SQL中的 $k 平移为 $(startIndex+k-1)，? 原样保留（已是字面量运算符）
+func shiftPlaceholders(sql string, startIndex int) string {
+	shifted, _ := rewritePlaceholders(sql, startIndex, false)
+	return shifted
+}
+
+// rewritePlaceholders 为 renumberPlaceholders 与 shiftPlaceholders 的实现，bindQuestion 为 false 时不处理 ?
+func rewritePlaceholders(sql string, startIndex int, bindQuestion bool) (string, int) {
+	var sb strings.Builder
+	sb.Grow(len(sql))
+
+	next := startIndex
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"':
+			// 原样复制引号内的内容（'' 与 "" 转义会被视为相邻的两段引号，结果一致）
+			end := strings.IndexByte(sql[i+1:], c)
+			if end == -1 {
+				sb.WriteString(sql[i:])
+				return sb.String(), next
+			}
+			sb.WriteString(sql[i : i+end+2])
+			i += end + 1
+		case c == '?' && bindQuestion:
+			if i+1 < len(sql) && sql[i+1] == '?' {
+				sb.WriteByte('?')
+				i++
+				continue
+			}
+			sb.WriteString("$" + strconv.Itoa(next))
+			next++
+		case c == '$' && i+1 < len(sql) && isDigit(sql[i+1]):
+			j := i + 1
+			for j < len(sql) && isDigit(sql[j]) {
+				j++
+			}
+			n, _ := strconv.Atoi(sql[i+1 : j])
+			mapped := startIndex + n - 1
+			sb.WriteString("$" + strconv.Itoa(mapped))
+			if mapped >= next {
+				next = mapped + 1
+			}
+			i = j - 1
+		default:
+			sb.WriteByte(c)
+		}
 	}
+	return sb.String(), next
+}
 
-	return &newQuery
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
 }
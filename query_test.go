@@ -4,10 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"regexp"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/songzhibin97/postgresql_helper/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -63,6 +69,16 @@ func TestQuery_BuildMethods(t *testing.T) {
 		assert.Empty(t, query.config.SelectFields)
 	})
 
+	t.Run("Select ignores empty fields", func(t *testing.T) {
+		q := query.Select("id", "", "  ", "name").(*Query)
+		assert.Equal(t, []string{"id", "name"}, q.config.SelectFields)
+		assert.Equal(t, "SELECT id, name FROM users", q.buildSelectQuery())
+
+		q = query.Select("", " ").(*Query)
+		assert.Empty(t, q.config.SelectFields)
+		assert.Equal(t, "SELECT * FROM users", q.buildSelectQuery())
+	})
+
 	t.Run("Where", func(t *testing.T) {
 		q := query.Where("age > $1", 18)
 
@@ -260,12 +276,83 @@ func TestQuery_BuildSelectQuery(t *testing.T) {
 		assert.Equal(t, "SELECT * FROM users GROUP BY department HAVING COUNT(*) > 5", sql)
 	})
 
+	t.Run("With group by rollup", func(t *testing.T) {
+		q := query.Select("region", "product", "SUM(amount) AS total").GroupByRollup("region", "product")
+		sql := q.(*Query).buildSelectQuery()
+		assert.Equal(t, "SELECT region, product, SUM(amount) AS total FROM users GROUP BY ROLLUP (region, product)", sql)
+	})
+
+	t.Run("With grouping sets", func(t *testing.T) {
+		q := query.Select("region", "product", "SUM(amount) AS total").
+			GroupByGroupingSets([][]string{{"region", "product"}, {"region"}, {}}).
+			Having("SUM(amount) > 0")
+		sql := q.(*Query).buildSelectQuery()
+		assert.Equal(t, "SELECT region, product, SUM(amount) AS total FROM users"+
+			" GROUP BY GROUPING SETS ((region, product), (region), ())"+
+			" HAVING SUM(amount) > 0", sql)
+	})
+
+	t.Run("Empty rollup or grouping sets", func(t *testing.T) {
+		var users []User
+		err := query.GroupByRollup().GetAll(context.Background(), &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+
+		err = query.GroupByGroupingSets(nil).GetAll(context.Background(), &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+
 	t.Run("With for update", func(t *testing.T) {
 		q := query.ForUpdate()
 		sql := q.(*Query).buildSelectQuery()
 		assert.Equal(t, "SELECT * FROM users FOR UPDATE", sql)
 	})
 
+	t.Run("With lock modes", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			q        types.Query
+			expected string
+		}{
+			{"for share", query.ForShare(), "SELECT * FROM users FOR SHARE"},
+			{"for no key update", query.ForNoKeyUpdate(), "SELECT * FROM users FOR NO KEY UPDATE"},
+			{"for key share", query.ForKeyShare(), "SELECT * FROM users FOR KEY SHARE"},
+			{"last lock wins over for update", query.ForUpdate().ForShare(), "SELECT * FROM users FOR SHARE"},
+			{"for update replaces lock mode", query.ForKeyShare().ForUpdate(), "SELECT * FROM users FOR UPDATE"},
+			{"with limit", query.Where("id = $1", 1).Limit(1).ForNoKeyUpdate(),
+				"SELECT * FROM users WHERE id = $1 LIMIT 1 FOR NO KEY UPDATE"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.expected, tt.q.(*Query).buildSelectQuery())
+			})
+		}
+	})
+
+	t.Run("With for update of", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			q        types.Query
+			expected string
+		}{
+			{"single table in join", query.Join("JOIN orders o ON o.user_id = users.id").Where("o.status = $1", "open").ForUpdateOf("users"),
+				"SELECT * FROM users JOIN orders o ON o.user_id = users.id WHERE o.status = $1 FOR UPDATE OF users"},
+			{"multiple tables", query.ForUpdateOf("users", "o"), "SELECT * FROM users FOR UPDATE OF users, o"},
+			{"no tables", query.ForUpdateOf(), "SELECT * FROM users FOR UPDATE"},
+			{"lock mode replaces of", query.ForUpdateOf("users").ForShare(), "SELECT * FROM users FOR SHARE"},
+			{"for update clears of", query.ForUpdateOf("users").ForUpdate(), "SELECT * FROM users FOR UPDATE"},
+			{"with limit", query.Limit(5).ForUpdateOf("users"), "SELECT * FROM users LIMIT 5 FOR UPDATE OF users"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.expected, tt.q.(*Query).buildSelectQuery())
+			})
+		}
+
+		// 统计子查询不携带行锁
+		assert.Equal(t, "SELECT COUNT(*) FROM (SELECT DISTINCT name FROM users) AS sub",
+			query.Select("DISTINCT name").ForUpdateOf("users").(*Query).buildCountQuery())
+	})
+
 	t.Run("Complex query", func(t *testing.T) {
 		q := query.Select("u.id", "u.name", "p.bio").
 			Join("INNER JOIN profiles p ON u.id = p.user_id").
@@ -292,6 +379,229 @@ func TestQuery_BuildSelectQuery(t *testing.T) {
 	})
 }
 
+func TestQuery_OrderByFields(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("multiple fields", func(t *testing.T) {
+		q := query.OrderByFields([]types.OrderField{
+			{Name: "created_at", Direction: "desc"},
+			{Name: "users.id", Direction: "ASC"},
+		})
+		sql, _ := q.ToSQL()
+
+		assert.Equal(t, "SELECT * FROM users ORDER BY created_at DESC, users.id ASC", sql)
+	})
+
+	t.Run("invalid direction", func(t *testing.T) {
+		var users []User
+		err := query.OrderByFields([]types.OrderField{{Name: "id", Direction: "DESC; DROP TABLE users"}}).
+			GetAll(context.Background(), &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "must be ASC or DESC")
+	})
+
+	t.Run("empty direction rejected", func(t *testing.T) {
+		_, err := query.OrderByFields([]types.OrderField{{Name: "id"}}).Count(context.Background())
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+
+	t.Run("invalid field name", func(t *testing.T) {
+		for _, name := range []string{"", "id desc", "lower(name)", "users.", "1id"} {
+			_, err := query.OrderByFields([]types.OrderField{{Name: name, Direction: "ASC"}}).Exists(context.Background())
+			assert.ErrorIs(t, err, types.ErrInvalidStructure, "field %q should be rejected", name)
+		}
+	})
+
+	t.Run("no fields", func(t *testing.T) {
+		_, err := query.OrderByFields(nil).Exists(context.Background())
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "Invalid ordering should not execute queries")
+}
+
+// TestQuery_WhereExists 测试EXISTS子查询条件
+func TestQuery_WhereExists(t *testing.T) {
+	query, _, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("WhereExists only", func(t *testing.T) {
+		q := query.WhereExists("SELECT 1 FROM orders WHERE orders.user_id = users.id")
+		queryImpl := q.(*Query)
+
+		assert.Equal(t, "SELECT * FROM users WHERE EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.id)",
+			queryImpl.buildSelectQuery())
+		assert.Empty(t, queryImpl.args)
+	})
+
+	t.Run("WhereNotExists combined with Where", func(t *testing.T) {
+		q := query.Where("status = $1", "active").
+			WhereNotExists("SELECT 1 FROM bans WHERE bans.user_id = users.id AND bans.reason = $2", "spam")
+		queryImpl := q.(*Query)
+
+		assert.Equal(t, "SELECT * FROM users WHERE (status = $1) AND "+
+			"(NOT EXISTS (SELECT 1 FROM bans WHERE bans.user_id = users.id AND bans.reason = $2))",
+			queryImpl.buildSelectQuery())
+		assert.Equal(t, []interface{}{"active", "spam"}, queryImpl.args, "Subquery args should follow existing args")
+	})
+
+	t.Run("Multiple subqueries keep arg order", func(t *testing.T) {
+		q := query.WhereExists("SELECT 1 FROM orders WHERE orders.user_id = users.id AND orders.total > $1", 100).
+			WhereNotExists("SELECT 1 FROM refunds WHERE refunds.user_id = users.id AND refunds.year = $2", 2024)
+		queryImpl := q.(*Query)
+
+		assert.Contains(t, queryImpl.config.WhereClause, "(EXISTS (")
+		assert.Contains(t, queryImpl.config.WhereClause, ") AND (NOT EXISTS (")
+		assert.Equal(t, []interface{}{100, 2024}, queryImpl.args)
+	})
+
+	t.Run("Original query unchanged", func(t *testing.T) {
+		_ = query.WhereExists("SELECT 1 FROM orders", 1)
+		assert.Empty(t, query.config.WhereClause)
+		assert.Empty(t, query.args)
+	})
+}
+
+func TestQuery_WhereNotIn(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("int slice combined with Where", func(t *testing.T) {
+		q := query.Where("status = $1", "active").WhereNotIn("id", []int{1, 2, 3})
+		queryImpl := q.(*Query)
+
+		assert.Equal(t, "SELECT * FROM users WHERE (status = $1) AND (id NOT IN ($2, $3, $4))",
+			queryImpl.buildSelectQuery())
+		assert.Equal(t, []interface{}{"active", 1, 2, 3}, queryImpl.args)
+	})
+
+	t.Run("string slice", func(t *testing.T) {
+		q := query.WhereNotIn("status", []string{"banned", "deleted"})
+		sql, args := q.ToSQL()
+
+		assert.Equal(t, "SELECT * FROM users WHERE status NOT IN ($1, $2)", sql)
+		assert.Equal(t, []interface{}{"banned", "deleted"}, args)
+	})
+
+	t.Run("WhereIn and WhereNotIn", func(t *testing.T) {
+		sql, args := query.WhereIn("role", []string{"admin", "owner"}).WhereNotIn("id", []int64{9}).ToSQL()
+
+		assert.Equal(t, "SELECT * FROM users WHERE (role IN ($1, $2)) AND (id NOT IN ($3))", sql)
+		assert.Equal(t, []interface{}{"admin", "owner", int64(9)}, args)
+	})
+
+	t.Run("empty slice returns error on execution", func(t *testing.T) {
+		var users []User
+		err := query.WhereNotIn("id", []int{}).GetAll(context.Background(), &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "requires at least one value")
+
+		_, err = query.WhereNotIn("id", []int{}).OrderBy("id").Count(context.Background())
+		assert.ErrorIs(t, err, types.ErrInvalidStructure, "Error should survive later builder calls")
+		assert.NoError(t, mock.ExpectationsWereMet(), "No query should be executed")
+	})
+
+	t.Run("non-slice returns error on execution", func(t *testing.T) {
+		_, err := query.WhereNotIn("id", 5).Exists(context.Background())
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "requires a slice")
+	})
+
+	t.Run("large lists bind a single array parameter", func(t *testing.T) {
+		small := make([]int64, whereInArrayThreshold)
+		large := make([]int64, whereInArrayThreshold+1)
+		for i := range large {
+			large[i] = int64(i + 1)
+		}
+		copy(small, large)
+
+		sql, args := query.WhereIn("id", small).ToSQL()
+		assert.Len(t, args, whereInArrayThreshold, "Lists up to the threshold are expanded")
+		assert.Contains(t, sql, fmt.Sprintf("$%d)", whereInArrayThreshold))
+
+		sql, args = query.Where("status = $1", "active").WhereIn("id", large).ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE (status = $1) AND (id = ANY($2))", sql)
+		require.Len(t, args, 2)
+		assert.Equal(t, pq.Array(large), args[1])
+
+		sql, args = query.WhereNotIn("id", large).ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE id <> ALL($1)", sql)
+		assert.Len(t, args, 1)
+
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE id = ANY\(\$1\)$`).
+			WithArgs(pq.Array(large)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a"))
+
+		var users []User
+		err := query.WhereIn("id", large).GetAll(context.Background(), &users)
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestQuery_WhereNamed(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("named params become positional", func(t *testing.T) {
+		sql, args := query.WhereNamed("status = :status AND age > :min_age", map[string]interface{}{
+			"status":  "active",
+			"min_age": 18,
+		}).ToSQL()
+
+		assert.Equal(t, "SELECT * FROM users WHERE status = $1 AND age > $2", sql)
+		assert.Equal(t, []interface{}{"active", 18}, args)
+	})
+
+	t.Run("combined with positional Where", func(t *testing.T) {
+		sql, args := query.Where("tenant_id = $1", 7).
+			WhereNamed("name = :name OR email = :name", map[string]interface{}{"name": "john"}).
+			OrderBy("id").
+			ToSQL()
+
+		assert.Equal(t, "SELECT * FROM users WHERE (tenant_id = $1) AND (name = $2 OR email = $3) ORDER BY id", sql)
+		assert.Equal(t, []interface{}{7, "john", "john"}, args)
+	})
+
+	t.Run("missing param returns error on execution", func(t *testing.T) {
+		var users []User
+		err := query.WhereNamed("status = :status", map[string]interface{}{}).GetAll(context.Background(), &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.NoError(t, mock.ExpectationsWereMet(), "No query should be executed")
+	})
+}
+
+// TestQuery_WhereRaw 测试原样追加条件
+func TestQuery_WhereRaw(t *testing.T) {
+	query, _, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("WhereRaw after Where", func(t *testing.T) {
+		q := query.Where("tenant_id = $1 AND status = $2", 7, "active").
+			WhereRaw("created_at BETWEEN $3 AND $4", "2024-01-01", "2024-12-31")
+		queryImpl := q.(*Query)
+
+		assert.Equal(t, "(tenant_id = $1 AND status = $2) AND (created_at BETWEEN $3 AND $4)", queryImpl.config.WhereClause,
+			"Clause should be appended verbatim")
+		assert.Equal(t, "SELECT * FROM users WHERE (tenant_id = $1 AND status = $2) AND (created_at BETWEEN $3 AND $4)",
+			queryImpl.buildSelectQuery())
+		assert.Equal(t, []interface{}{7, "active", "2024-01-01", "2024-12-31"}, queryImpl.args)
+	})
+
+	t.Run("WhereRaw with cursor and exists", func(t *testing.T) {
+		q := query.WhereRaw("score > $1", 10).
+			WhereExists("SELECT 1 FROM orders WHERE orders.user_id = users.id").
+			WithCursor("id", &types.Cursor{KeyValue: 5, Forward: true, Limit: 20})
+		queryImpl := q.(*Query)
+
+		assert.Equal(t, "SELECT * FROM users WHERE ((score > $1) AND (EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.id)))"+
+			" AND (id > $2) ORDER BY id ASC LIMIT 21", queryImpl.buildSelectQuery())
+		assert.Equal(t, []interface{}{10, 5}, queryImpl.args)
+	})
+}
+
 // TestQuery_Get 测试Get方法
 func TestQuery_Get(t *testing.T) {
 	query, mock, cleanup := setupQueryTest(t)
@@ -463,6 +773,104 @@ func TestQuery_GetAll(t *testing.T) {
 	})
 }
 
+func TestQuery_MaxRowsWithoutLimit(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	guarded := *query.DB
+	guarded.maxRowsWithoutLimit = 2
+	guardedQuery := &Query{DB: &guarded, table: "users"}
+
+	t.Run("limit injected", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM users WHERE age > \$1 LIMIT 3$`).
+			WithArgs(18).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "age"}).
+				AddRow(1, "A", "a@example.com", 20).
+				AddRow(2, "B", "b@example.com", 30))
+
+		var users []User
+		require.NoError(t, guardedQuery.Where("age > $1", 18).GetAll(ctx, &users))
+		assert.Len(t, users, 2)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("over limit signalled", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM users LIMIT 3$`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "age"}).
+				AddRow(1, "A", "a@example.com", 20).
+				AddRow(2, "B", "b@example.com", 30).
+				AddRow(3, "C", "c@example.com", 40))
+
+		var users []User
+		err := guardedQuery.GetAll(ctx, &users)
+		assert.ErrorIs(t, err, ErrRowLimitExceeded)
+		assert.Len(t, users, 2, "Result should be truncated to the safety limit")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("explicit limit untouched", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM users LIMIT 10$`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "age"}))
+
+		var users []User
+		require.NoError(t, guardedQuery.Limit(10).GetAll(ctx, &users))
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM users$`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "age"}))
+
+		var users []User
+		require.NoError(t, query.GetAll(ctx, &users))
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+}
+
+func TestQuery_DuplicateColumns(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	joined := query.Select("users.*", "orders.*").Join("JOIN orders ON orders.user_id = users.id")
+
+	t.Run("GetAll with duplicate id from join", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT users\.\*, orders\.\* FROM users JOIN orders`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "id", "total"}).
+				AddRow(1, "John", 10, 99))
+
+		var users []User
+		err := joined.GetAll(ctx, &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), `ambiguous column "id"`)
+		assert.Contains(t, err.Error(), "alias")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("Get with duplicate id from join", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT users\.\*, orders\.\* FROM users JOIN orders`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "id", "total"}).
+				AddRow(1, "John", 10, 99))
+
+		var user User
+		err := joined.Get(ctx, &user)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), `ambiguous column "id"`)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("scalar destinations are unaffected", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT id FROM users`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+		var ids []int
+		require.NoError(t, query.Select("id").GetAll(ctx, &ids))
+		assert.Equal(t, []int{1, 2}, ids)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+}
+
 // TestQuery_Count 测试Count方法
 func TestQuery_Count(t *testing.T) {
 	query, mock, cleanup := setupQueryTest(t)
@@ -516,6 +924,50 @@ func TestQuery_Count(t *testing.T) {
 		assert.Equal(t, int64(0), count, "Count should be 0 on error")
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
+
+	t.Run("Count with join", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM users JOIN orders ON orders\.user_id = users\.id WHERE orders\.total > \$1$`).
+			WithArgs(100).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		count, err := query.Join("JOIN orders ON orders.user_id = users.id").
+			Where("orders.total > ?", 100).
+			OrderBy("users.id").
+			Limit(10).
+			Count(ctx)
+		assert.NoError(t, err, "Count should not return error")
+		assert.Equal(t, int64(3), count)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("Count with group by", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM \(SELECT country, COUNT\(\*\) FROM users WHERE age > \$1 GROUP BY country HAVING COUNT\(\*\) > \$2\) AS sub$`).
+			WithArgs(18, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+		q := query.Select("country", "COUNT(*)").
+			Where("age > ?", 18).
+			GroupBy("country").
+			Having("COUNT(*) > ?").
+			OrderBy("country").
+			Limit(2).(*Query)
+		q.args = append(q.args, 5)
+
+		count, err := q.Count(ctx)
+		assert.NoError(t, err, "Count should not return error")
+		assert.Equal(t, int64(4), count, "Count should return number of groups")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("Count with distinct", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM \(SELECT DISTINCT email FROM users\) AS sub$`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+		count, err := query.Select("DISTINCT email").Count(ctx)
+		assert.NoError(t, err, "Count should not return error")
+		assert.Equal(t, int64(7), count)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
 }
 
 // TestQuery_Exists 测试Exists方法
@@ -753,6 +1205,76 @@ func TestQuery_WithCursor(t *testing.T) {
 	})
 }
 
+// TestQuery_DefaultCursorDirection 测试游标分页的默认排序方向
+func TestQuery_DefaultCursorDirection(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("Forward cursor with default DESC", func(t *testing.T) {
+		cursor := &types.Cursor{KeyValue: 100, Forward: true, Limit: 10}
+
+		q := query.DefaultCursorDirection("desc").WithCursor("id", cursor)
+		queryImpl, ok := q.(*Query)
+		require.True(t, ok, "Should return a *Query")
+
+		assert.Equal(t, "id DESC", queryImpl.config.OrderBy, "OrderBy should default to DESC")
+		assert.Equal(t, "id < ?", queryImpl.config.WhereClause, "Forward cursor with DESC should use < operator")
+	})
+
+	t.Run("Backward cursor with default DESC", func(t *testing.T) {
+		cursor := &types.Cursor{KeyValue: 100, Forward: false, Limit: 10}
+
+		q := query.DefaultCursorDirection("DESC").WithCursor("id", cursor)
+		queryImpl := q.(*Query)
+
+		assert.Equal(t, "id DESC", queryImpl.config.OrderBy)
+		assert.Equal(t, "id > ?", queryImpl.config.WhereClause, "Backward cursor with DESC should use > operator")
+	})
+
+	t.Run("First page is ordered by default direction", func(t *testing.T) {
+		cursor := &types.Cursor{Forward: true, Limit: 10}
+
+		queryImpl := query.DefaultCursorDirection("DESC").WithCursor("id", cursor).(*Query)
+		assert.Equal(t, "id DESC", queryImpl.config.OrderBy)
+		assert.Empty(t, queryImpl.config.WhereClause)
+
+		queryImpl = query.WithCursor("id", cursor).(*Query)
+		assert.Equal(t, "id ASC", queryImpl.config.OrderBy, "Default direction should be ASC")
+	})
+
+	t.Run("Explicit OrderBy takes precedence", func(t *testing.T) {
+		cursor := &types.Cursor{KeyValue: 100, Forward: true, Limit: 10}
+
+		queryImpl := query.DefaultCursorDirection("DESC").OrderBy("id ASC").WithCursor("id", cursor).(*Query)
+		assert.Equal(t, "id ASC", queryImpl.config.OrderBy)
+		assert.Equal(t, "id > ?", queryImpl.config.WhereClause)
+	})
+
+	t.Run("Unknown direction falls back to ASC", func(t *testing.T) {
+		cursor := &types.Cursor{KeyValue: 100, Forward: true, Limit: 10}
+
+		queryImpl := query.DefaultCursorDirection("sideways").WithCursor("id", cursor).(*Query)
+		assert.Equal(t, "id ASC", queryImpl.config.OrderBy)
+		assert.Equal(t, "id > ?", queryImpl.config.WhereClause)
+	})
+
+	t.Run("PageByKeySince newest first", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"id", "name", "email", "age"}).
+			AddRow(9, "User 9", "user9@example.com", 29).
+			AddRow(8, "User 8", "user8@example.com", 28)
+
+		mock.ExpectQuery(`SELECT \* FROM users WHERE id < \$1 ORDER BY id DESC LIMIT 3`).
+			WithArgs(10).
+			WillReturnRows(rows)
+
+		var users []*User
+		_, err := query.DefaultCursorDirection("DESC").PageByKeySince(context.Background(), &users, "id", 10, 2, false)
+		require.NoError(t, err)
+		assert.Len(t, users, 2)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
 // TestQuery_GetPage 测试GetPage方法
 func TestQuery_GetPage(t *testing.T) {
 	query, mock, cleanup := setupQueryTest(t)
@@ -935,6 +1457,93 @@ func TestQuery_GetPage(t *testing.T) {
 	})
 }
 
+// TestQuery_GetPageMetadata 测试GetPage返回的首尾游标与页大小
+func TestQuery_GetPageMetadata(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	columns := []string{"id", "name", "email", "age"}
+
+	t.Run("full page", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT \* FROM users ORDER BY id LIMIT 3$`).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, "a", "a@example.com", 20).
+				AddRow(2, "b", "b@example.com", 21).
+				AddRow(3, "c", "c@example.com", 22).
+				AddRow(4, "d", "d@example.com", 23))
+
+		var users []User
+		result, err := query.OrderBy("id").Limit(3).GetPage(ctx, &users, false)
+		require.NoError(t, err)
+		require.Len(t, users, 3)
+		assert.True(t, result.HasNext)
+		assert.Equal(t, 3, result.PageSize)
+		assert.Equal(t, &types.Cursor{KeyValue: 1, Forward: false, Limit: 3}, result.StartCursor)
+		assert.Equal(t, &types.Cursor{KeyValue: 3, Forward: true, Limit: 3}, result.EndCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("partial last page", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE id > \$1 ORDER BY id LIMIT 3$`).
+			WithArgs(6).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(7, "g", "g@example.com", 26).
+				AddRow(8, "h", "h@example.com", 27))
+
+		var users []*User
+		result, err := query.Where("id > $1", 6).OrderBy("id").Limit(3).GetPage(ctx, &users, false)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		assert.False(t, result.HasNext)
+		assert.Nil(t, result.NextCursor)
+		assert.Equal(t, 3, result.PageSize, "Page size stays the requested size on a partial page")
+		assert.Equal(t, &types.Cursor{KeyValue: 7, Forward: false, Limit: 3}, result.StartCursor)
+		assert.Equal(t, &types.Cursor{KeyValue: 8, Forward: true, Limit: 3}, result.EndCursor)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("empty page", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE id > \$1 ORDER BY id LIMIT 3$`).
+			WithArgs(100).
+			WillReturnRows(sqlmock.NewRows(columns))
+
+		var users []User
+		result, err := query.Where("id > $1", 100).OrderBy("id").Limit(3).GetPage(ctx, &users, false)
+		require.NoError(t, err)
+		assert.Nil(t, result.StartCursor)
+		assert.Nil(t, result.EndCursor)
+		assert.Equal(t, 3, result.PageSize)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestQuery_GetPagePointerElements 测试 dest 为 []*T 时生成游标
+func TestQuery_GetPagePointerElements(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`^SELECT \* FROM users WHERE id > \$1 LIMIT 2$`).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "age"}).
+			AddRow(11, "User 11", "user11@example.com", 21).
+			AddRow(12, "User 12", "user12@example.com", 22).
+			AddRow(13, "User 13", "user13@example.com", 23))
+
+	var users []*User
+	result, err := query.Where("id > $1", 10).Limit(2).GetPage(context.Background(), &users, false)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, 12, users[1].ID)
+
+	assert.True(t, result.HasNext)
+	require.NotNil(t, result.NextCursor, "Pointer elements should be dereferenced for the cursor key")
+	assert.Equal(t, 12, result.NextCursor.KeyValue)
+	require.NotNil(t, result.PrevCursor)
+	assert.Equal(t, 11, result.PrevCursor.KeyValue)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestQuery_PageByKeySince 测试PageByKeySince方法
 func TestQuery_PageByKeySince(t *testing.T) {
 	query, mock, cleanup := setupQueryTest(t)
@@ -1250,4 +1859,1060 @@ func TestQuery_WithCompositeCursor(t *testing.T) {
 		assert.Contains(t, queryImpl.args, "active", "Args should contain original arg")
 		assert.Contains(t, queryImpl.args, 100, "Args should contain cursor key value")
 	})
+
+	t.Run("Builder error is preserved", func(t *testing.T) {
+		cursor := &types.CompositeCursor{
+			KeyValues: map[string]interface{}{"id": 100},
+			OrderFields: []struct {
+				Name      string `json:"name"`
+				Direction string `json:"direction"`
+			}{
+				{Name: "id", Direction: "ASC"},
+			},
+			Forward: true,
+			Limit:   10,
+		}
+
+		// 被拒绝的 IN 条件没有加入 WHERE，错误丢失会导致查询不带过滤条件执行
+		var users []User
+		err := query.WhereNotIn("id", []int{}).WithCompositeCursor(cursor).GetAll(context.Background(), &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+
+		_, err = query.WhereIn("id", 42).WithCompositeCursor(cursor).Count(context.Background())
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+func TestQuery_JSONBQuestionOperator(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("escaped operator does not consume an argument", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE age > \$1 AND data \? 'vip' AND name = \$2$`).
+			WithArgs(18, "a").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a"))
+
+		var users []User
+		err := query.Where("age > ? AND data ?? 'vip' AND name = ?", 18, "a").GetAll(context.Background(), &users)
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("operator kept in union right side", func(t *testing.T) {
+		other := query.Where("data ?? 'vip' AND age > ?", 30)
+		sql, args := query.Where("age < ?", 18).Union(other).ToSQL()
+		assert.Equal(t, "SELECT * FROM ((SELECT * FROM users WHERE age < $1) UNION "+
+			"(SELECT * FROM users WHERE data ? 'vip' AND age > $2)) AS union_result", sql)
+		assert.Equal(t, []interface{}{18, 30}, args)
+	})
+}
+
+// TestRenumberPlaceholders 测试占位符统一编号
+func TestRenumberPlaceholders(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       string
+		start     int
+		expected  string
+		nextIndex int
+	}{
+		{
+			name:      "question marks",
+			sql:       "a = ? AND b = ?",
+			start:     1,
+			expected:  "a = $1 AND b = $2",
+			nextIndex: 3,
+		},
+		{
+			name:      "dollar placeholders kept",
+			sql:       "a = $1 AND b = $2",
+			start:     1,
+			expected:  "a = $1 AND b = $2",
+			nextIndex: 3,
+		},
+		{
+			name:      "dollar placeholders shifted",
+			sql:       "a = $1 OR b = $1",
+			start:     3,
+			expected:  "a = $3 OR b = $3",
+			nextIndex: 4,
+		},
+		{
+			name:      "mixed placeholders",
+			sql:       "(status = $1) AND (id > ?)",
+			start:     1,
+			expected:  "(status = $1) AND (id > $2)",
+			nextIndex: 3,
+		},
+		{
+			name:      "quoted text untouched",
+			sql:       "name = 'what?' AND note <> '$1' AND id = ?",
+			start:     1,
+			expected:  "name = 'what?' AND note <> '$1' AND id = $1",
+			nextIndex: 2,
+		},
+		{
+			name:      "no placeholders",
+			sql:       "deleted_at IS NULL",
+			start:     5,
+			expected:  "deleted_at IS NULL",
+			nextIndex: 5,
+		},
+		{
+			name:      "escaped jsonb operators",
+			sql:       "data ?? 'k' AND tags ??| ? AND attrs ??& $1",
+			start:     2,
+			expected:  "data ? 'k' AND tags ?| $2 AND attrs ?& $2",
+			nextIndex: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, next := renumberPlaceholders(tt.sql, tt.start)
+			assert.Equal(t, tt.expected, result)
+			assert.Equal(t, tt.nextIndex, next)
+		})
+	}
+
+	t.Run("buildSelectQuery with cursor", func(t *testing.T) {
+		query, _, cleanup := setupQueryTest(t)
+		defer cleanup()
+
+		q := query.Where("status = $1", "active").
+			WithCursor("id", &types.Cursor{KeyValue: 100, Forward: true, Limit: 10})
+		assert.Equal(t, "SELECT * FROM users WHERE (status = $1) AND (id > $2) ORDER BY id ASC LIMIT 11",
+			q.(*Query).buildSelectQuery())
+	})
+}
+
+// TestQuery_ForEachPage 测试按键集分页逐页处理
+func TestQuery_ForEachPage(t *testing.T) {
+	type user struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+
+	t.Run("iterates all pages", func(t *testing.T) {
+		query, mock, cleanup := setupQueryTest(t)
+		defer cleanup()
+
+		cols := []string{"id", "name"}
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE active = \$1 ORDER BY id ASC LIMIT 3$`).
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "a").AddRow(2, "b").AddRow(3, "c"))
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE \(active = \$1\) AND \(id > \$2\) ORDER BY id ASC LIMIT 3$`).
+			WithArgs(true, 2).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(3, "c").AddRow(4, "d").AddRow(5, "e"))
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE \(active = \$1\) AND \(id > \$2\) ORDER BY id ASC LIMIT 3$`).
+			WithArgs(true, 4).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(5, "e"))
+
+		var batches [][]user
+		err := query.Where("active = ?", true).ForEachPage(context.Background(), &[]user{}, "id", 2, func(batch interface{}) error {
+			batches = append(batches, batch.([]user))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Len(t, batches, 3)
+		assert.Equal(t, []user{{1, "a"}, {2, "b"}}, batches[0])
+		assert.Equal(t, []user{{3, "c"}, {4, "d"}}, batches[1])
+		assert.Equal(t, []user{{5, "e"}}, batches[2])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("stops on callback error", func(t *testing.T) {
+		query, mock, cleanup := setupQueryTest(t)
+		defer cleanup()
+
+		mock.ExpectQuery(`SELECT \* FROM users ORDER BY id ASC LIMIT 3`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b").AddRow(3, "c"))
+
+		stop := errors.New("stop")
+		calls := 0
+		err := query.ForEachPage(context.Background(), &[]user{}, "id", 2, func(batch interface{}) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("stops on context cancellation", func(t *testing.T) {
+		query, mock, cleanup := setupQueryTest(t)
+		defer cleanup()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := query.ForEachPage(ctx, &[]user{}, "id", 2, func(batch interface{}) error {
+			t.Fatal("callback should not be called")
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		query, _, cleanup := setupQueryTest(t)
+		defer cleanup()
+
+		err := query.ForEachPage(context.Background(), []user{}, "id", 2, func(interface{}) error { return nil })
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestGetMapT 测试按键构建结果映射
+func TestGetMapT(t *testing.T) {
+	type user struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT id, name FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "alice").AddRow(2, "bob"))
+
+	users, err := GetMapT(context.Background(), query.Select("id", "name"), func(u user) int64 { return u.ID })
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]user{
+		1: {ID: 1, Name: "alice"},
+		2: {ID: 2, Name: "bob"},
+	}, users)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectQuery(`SELECT \* FROM users`).WillReturnError(errors.New("boom"))
+	_, err = GetMapT(context.Background(), query, func(u user) int64 { return u.ID })
+	assert.Error(t, err)
+}
+
+// TestQuery_WhereWithCursorPlaceholders 测试 $N 条件与游标条件合并后的参数编号
+func TestQuery_WhereWithCursorPlaceholders(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("single cursor", func(t *testing.T) {
+		q := query.Where("status = $1", "active").
+			WithCursor("id", &types.Cursor{KeyValue: 10, Forward: true, Limit: 5}).(*Query)
+
+		assert.Equal(t, "SELECT * FROM users WHERE (status = $1) AND (id > $2) ORDER BY id ASC LIMIT 6",
+			q.buildSelectQuery())
+		assert.Equal(t, []interface{}{"active", 10}, q.args)
+
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE \(status = \$1\) AND \(id > \$2\) ORDER BY id ASC LIMIT 6$`).
+			WithArgs("active", 10).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+
+		var ids []int
+		require.NoError(t, q.GetAll(context.Background(), &ids))
+		assert.Equal(t, []int{11}, ids)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("composite cursor keeps existing args", func(t *testing.T) {
+		cursor := &types.CompositeCursor{
+			KeyValues: map[string]interface{}{"created_at": "2024-01-01", "id": 10},
+			Forward:   true,
+			Limit:     5,
+		}
+		cursor.OrderFields = append(cursor.OrderFields,
+			struct {
+				Name      string `json:"name"`
+				Direction string `json:"direction"`
+			}{Name: "created_at", Direction: "ASC"},
+			struct {
+				Name      string `json:"name"`
+				Direction string `json:"direction"`
+			}{Name: "id", Direction: "ASC"},
+		)
+
+		q := query.Where("status = $1 OR owner = $1", "active").WithCompositeCursor(cursor).(*Query)
+		assert.Equal(t, "SELECT * FROM users WHERE (status = $1 OR owner = $1) AND ((created_at, id) > ($2, $3))"+
+			" ORDER BY created_at ASC, id ASC LIMIT 6", q.buildSelectQuery())
+		assert.Equal(t, []interface{}{"active", "2024-01-01", 10}, q.args)
+	})
+}
+
+// memoryCache 测试用内存缓存
+type memoryCache struct {
+	mu    sync.Mutex
+	items map[string]interface{}
+	ttls  map[string]time.Duration
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{items: map[string]interface{}{}, ttls: map[string]time.Duration{}}
+}
+
+func (c *memoryCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.items[key]
+	return v, ok
+}
+
+func (c *memoryCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = value
+	c.ttls[key] = ttl
+}
+
+// TestQuery_Cached 测试查询结果缓存
+func TestQuery_Cached(t *testing.T) {
+	type country struct {
+		Code string `db:"code"`
+		Name string `db:"name"`
+	}
+
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	cache := newMemoryCache()
+	query.DB.cache = cache
+	ctx := context.Background()
+
+	// 第一次查询访问数据库并写入缓存
+	mock.ExpectQuery(`SELECT code, name FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"code", "name"}).AddRow("CN", "China").AddRow("FR", "France"))
+
+	q := query.Select("code", "name").Cached("countries", time.Minute)
+	var first []country
+	require.NoError(t, q.GetAll(ctx, &first))
+	assert.Len(t, first, 2)
+	assert.Equal(t, time.Minute, cache.ttls["countries"])
+
+	// 修改返回结果不影响缓存
+	first[0].Name = "changed"
+
+	// 第二次查询命中缓存，没有新的mock期望
+	var second []country
+	require.NoError(t, q.GetAll(ctx, &second))
+	assert.Equal(t, []country{{"CN", "China"}, {"FR", "France"}}, second)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// 未调用 Cached 的查询不使用缓存
+	mock.ExpectQuery(`SELECT code, name FROM users`).
+		WillReturnRows(sqlmock.NewRows([]string{"code", "name"}).AddRow("CN", "China"))
+	var uncached []country
+	require.NoError(t, query.Select("code", "name").GetAll(ctx, &uncached))
+	assert.Len(t, uncached, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestQuery_ToSQL 测试ToSQL方法
+func TestQuery_ToSQL(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		query    types.Query
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "plain select",
+			query:    query,
+			wantSQL:  "SELECT * FROM users",
+			wantArgs: []interface{}{},
+		},
+		{
+			name:     "fields where order limit",
+			query:    query.Select("id", "name").Where("age > ? AND status = ?", 18, "active").OrderBy("id DESC").Limit(10).Offset(20),
+			wantSQL:  "SELECT id, name FROM users WHERE age > $1 AND status = $2 ORDER BY id DESC LIMIT 10 OFFSET 20",
+			wantArgs: []interface{}{18, "active"},
+		},
+		{
+			name: "join exists and cursor",
+			query: query.Join("JOIN orders o ON o.user_id = users.id").
+				Where("o.total > $1", 100).
+				WhereExists("SELECT 1 FROM bans b WHERE b.user_id = users.id AND b.reason = ?", "spam").
+				WithCursor("users.id", &types.Cursor{KeyValue: 5, Forward: true, Limit: 10}),
+			wantSQL: "SELECT * FROM users JOIN orders o ON o.user_id = users.id" +
+				" WHERE ((o.total > $1) AND (EXISTS (SELECT 1 FROM bans b WHERE b.user_id = users.id AND b.reason = $2)))" +
+				" AND (users.id > $3) ORDER BY users.id ASC LIMIT 11",
+			wantArgs: []interface{}{100, "spam", 5},
+		},
+		{
+			name:     "for update",
+			query:    query.Where("id = ?", 1).ForUpdate(),
+			wantSQL:  "SELECT * FROM users WHERE id = $1 FOR UPDATE",
+			wantArgs: []interface{}{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := tt.query.ToSQL()
+			assert.Equal(t, tt.wantSQL, sql)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+
+	// ToSQL 不执行查询，返回的参数修改不影响查询本身
+	q := query.Where("id = ?", 1)
+	_, args := q.ToSQL()
+	args[0] = 2
+	_, args = q.ToSQL()
+	assert.Equal(t, []interface{}{1}, args)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestQuery_GetJSON 测试GetJSON方法
+func TestQuery_GetJSON(t *testing.T) {
+	type order struct {
+		ID    int     `json:"id"`
+		Total float64 `json:"total"`
+	}
+	type userWithOrders struct {
+		ID     int     `json:"id"`
+		Name   string  `json:"name"`
+		Orders []order `json:"orders"`
+	}
+
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("json_agg into slice of structs", func(t *testing.T) {
+		payload := `[{"id":1,"name":"alice","orders":[{"id":10,"total":9.5}]},{"id":2,"name":"bob","orders":[]}]`
+		mock.ExpectQuery(`SELECT json_agg\(u\) AS users FROM users WHERE active = \$1`).
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows([]string{"users"}).AddRow([]byte(payload)))
+
+		var users []userWithOrders
+		err := query.Select("json_agg(u) AS users").Where("active = ?", true).GetJSON(ctx, &users)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		assert.Equal(t, "alice", users[0].Name)
+		assert.Equal(t, []order{{ID: 10, Total: 9.5}}, users[0].Orders)
+		assert.Empty(t, users[1].Orders)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("null result leaves dest unchanged", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT json_agg\(u\) AS users FROM users`).
+			WillReturnRows(sqlmock.NewRows([]string{"users"}).AddRow(nil))
+
+		var users []userWithOrders
+		err := query.Select("json_agg(u) AS users").GetJSON(ctx, &users)
+		require.NoError(t, err)
+		assert.Nil(t, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT row_to_json\(u\) FROM users`).
+			WillReturnRows(sqlmock.NewRows([]string{"row_to_json"}).AddRow([]byte("{")))
+
+		var user userWithOrders
+		err := query.Select("row_to_json(u)").GetJSON(ctx, &user)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "decode json result")
+	})
+}
+
+func TestQuery_FindDuplicates(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	type duplicate struct {
+		Email    string `db:"email"`
+		TenantID int    `db:"tenant_id"`
+		Count    int64  `db:"count"`
+	}
+
+	t.Run("scan duplicate groups", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT email, tenant_id, COUNT\(\*\) AS count FROM users WHERE active = \$1 ` +
+			`GROUP BY email, tenant_id HAVING COUNT\(\*\) > 1 ORDER BY count DESC$`).
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows([]string{"email", "tenant_id", "count"}).
+				AddRow("a@example.com", 1, 3).
+				AddRow("b@example.com", 2, 2))
+
+		var dups []duplicate
+		err := query.Where("active = $1", true).FindDuplicates(context.Background(), []string{"email", "tenant_id"}, &dups)
+		assert.NoError(t, err)
+		assert.Equal(t, []duplicate{
+			{Email: "a@example.com", TenantID: 1, Count: 3},
+			{Email: "b@example.com", TenantID: 2, Count: 2},
+		}, dups)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("columns required", func(t *testing.T) {
+		var dups []duplicate
+		err := query.FindDuplicates(context.Background(), nil, &dups)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+func TestQuery_GetAllInto(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("reuse backing array across iterations", func(t *testing.T) {
+		buf := make([]User, 0, 8)
+		backing := &buf[:1][0]
+
+		for i := 0; i < 3; i++ {
+			mock.ExpectQuery(`SELECT \* FROM users WHERE age > \$1`).
+				WithArgs(i).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+					AddRow(i*10+1, "a").
+					AddRow(i*10+2, "b"))
+
+			buf = buf[:0]
+			err := query.Where("age > $1", i).GetAllInto(ctx, &buf)
+			require.NoError(t, err)
+			require.Len(t, buf, 2)
+			assert.Equal(t, i*10+1, buf[0].ID)
+			assert.Same(t, backing, &buf[0], "Backing array should be reused when capacity suffices")
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("appends after existing elements", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM users`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Bob"))
+
+		users := []User{{ID: 1, Name: "Alice"}}
+		err := query.GetAllInto(ctx, &users)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, []int{users[0].ID, users[1].ID})
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		var users []User
+		err := query.GetAllInto(ctx, users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+func TestQuery_CountDistinct(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("distinct count with filter", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(DISTINCT email\) FROM users WHERE age > \$1$`).
+			WithArgs(18).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+		count, err := query.Where("age > $1", 18).OrderBy("id").Limit(10).CountDistinct(ctx, "email")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("with join", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(DISTINCT users.id\) FROM users JOIN orders ON orders.user_id = users.id WHERE orders.total > \$1$`).
+			WithArgs(100).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		count, err := query.Join("JOIN orders ON orders.user_id = users.id").
+			Where("orders.total > $1", 100).
+			CountDistinct(ctx, "users.id")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("column required", func(t *testing.T) {
+		_, err := query.CountDistinct(ctx, " ")
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+func TestQuery_Paginate(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	columns := []string{"id", "name"}
+
+	// 第一页：空 token
+	mock.ExpectQuery(`^SELECT \* FROM users WHERE active = \$1 ORDER BY id ASC LIMIT 3$`).
+		WithArgs(true).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "a").AddRow(2, "b").AddRow(3, "c"))
+
+	var first []User
+	page, err := query.Where("active = $1", true).Paginate(ctx, &first, "id", "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, []int{first[0].ID, first[1].ID})
+	assert.True(t, page.HasNext)
+	assert.False(t, page.HasPrev)
+	assert.Empty(t, page.PrevToken)
+	require.NotEmpty(t, page.NextToken)
+
+	// 下一页：token 解码为 id > 2
+	mock.ExpectQuery(`^SELECT \* FROM users WHERE \(active = \$1\) AND \(id > \$2\) ORDER BY id ASC LIMIT 3$`).
+		WithArgs(true, int64(2)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "c").AddRow(4, "d"))
+
+	var second []User
+	page, err = query.Where("active = $1", true).Paginate(ctx, &second, "id", page.NextToken, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 4}, []int{second[0].ID, second[1].ID})
+	assert.False(t, page.HasNext, "Last page should not have a next token")
+	assert.Empty(t, page.NextToken)
+	assert.True(t, page.HasPrev)
+	require.NotEmpty(t, page.PrevToken)
+
+	// 上一页：反向读取 id < 3 后恢复正常顺序
+	mock.ExpectQuery(`^SELECT \* FROM users WHERE \(active = \$1\) AND \(id < \$2\) ORDER BY id DESC LIMIT 3$`).
+		WithArgs(true, int64(3)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(2, "b").AddRow(1, "a"))
+
+	var prev []User
+	page, err = query.Where("active = $1", true).Paginate(ctx, &prev, "id", page.PrevToken, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, []int{prev[0].ID, prev[1].ID})
+	assert.True(t, page.HasNext)
+	assert.False(t, page.HasPrev, "Reached the first page")
+	assert.Empty(t, page.PrevToken)
+
+	cursor, err := DecodeCursor(page.NextToken)
+	require.NoError(t, err)
+	assert.Equal(t, &types.Cursor{KeyValue: int64(2), Forward: true, Limit: 2}, cursor)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	t.Run("descending order", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE id < \$1 ORDER BY id DESC LIMIT 2$`).
+			WithArgs(int64(10)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(9, "i"))
+
+		token, err := EncodeCursor(&types.Cursor{KeyValue: 10, Forward: true})
+		require.NoError(t, err)
+
+		var users []User
+		page, err := query.DefaultCursorDirection("DESC").Paginate(ctx, &users, "id", token, 1)
+		require.NoError(t, err)
+		assert.Len(t, users, 1)
+		assert.False(t, page.HasNext)
+		assert.True(t, page.HasPrev)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		var users []User
+		_, err := query.Paginate(ctx, &users, "id", "not a token!", 10)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+func TestQuery_SelectAs(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("aliased select list", func(t *testing.T) {
+		sql, _ := query.SelectAs(map[string]string{
+			"users.id":         "user_id",
+			"COUNT(orders.id)": "order_count",
+			"users.name":       "display_name",
+		}).ToSQL()
+
+		assert.Equal(t, "SELECT COUNT(orders.id) AS order_count, users.id AS user_id, users.name AS display_name FROM users", sql)
+	})
+
+	t.Run("scan into DTO", func(t *testing.T) {
+		type dto struct {
+			UserID      int    `db:"user_id"`
+			DisplayName string `db:"display_name"`
+		}
+
+		mock.ExpectQuery(`^SELECT id AS user_id, name AS display_name FROM users WHERE id = \$1$`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "display_name"}).AddRow(1, "Alice"))
+
+		var result dto
+		err := query.SelectAs(map[string]string{"id": "user_id", "name": "display_name"}).
+			Where("id = $1", 1).
+			Get(context.Background(), &result)
+		assert.NoError(t, err)
+		assert.Equal(t, dto{UserID: 1, DisplayName: "Alice"}, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid alias", func(t *testing.T) {
+		var result []User
+		err := query.SelectAs(map[string]string{"id": "user id; DROP TABLE users"}).GetAll(context.Background(), &result)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.NoError(t, mock.ExpectationsWereMet(), "No query should be executed")
+	})
+}
+
+func TestQuery_ClearWhereAndOrder(t *testing.T) {
+	query, _, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	base := query.Select("id", "name").
+		Join("JOIN orders o ON o.user_id = users.id").
+		Where("age > $1", 18).
+		WhereIn("status", []string{"active", "pending"}).
+		OrderBy("name ASC").
+		Limit(10)
+
+	t.Run("clear where", func(t *testing.T) {
+		sql, args := base.ClearWhere().ToSQL()
+		assert.Equal(t, "SELECT id, name FROM users JOIN orders o ON o.user_id = users.id ORDER BY name ASC LIMIT 10", sql)
+		assert.Empty(t, args)
+	})
+
+	t.Run("re-filter after clear", func(t *testing.T) {
+		sql, args := base.ClearWhere().Where("o.total > $1", 100).WhereIn("o.region", []string{"eu"}).ToSQL()
+		assert.Equal(t, "SELECT id, name FROM users JOIN orders o ON o.user_id = users.id "+
+			"WHERE (o.total > $1) AND (o.region IN ($2)) ORDER BY name ASC LIMIT 10", sql)
+		assert.Equal(t, []interface{}{100, "eu"}, args)
+	})
+
+	t.Run("clear order", func(t *testing.T) {
+		sql, args := base.ClearOrder().ToSQL()
+		assert.Equal(t, "SELECT id, name FROM users JOIN orders o ON o.user_id = users.id "+
+			"WHERE (age > $1) AND (status IN ($2, $3)) LIMIT 10", sql)
+		assert.Equal(t, []interface{}{18, "active", "pending"}, args)
+	})
+
+	t.Run("base query unchanged", func(t *testing.T) {
+		_, args := base.ToSQL()
+		assert.Equal(t, []interface{}{18, "active", "pending"}, args)
+	})
+
+	t.Run("soft delete filter kept", func(t *testing.T) {
+		table := (&Table{DB: query.DB, name: "users"}).SetSoftDeleteColumn("deleted_at")
+		sql, _ := table.Query().Where("id = $1", 1).ClearWhere().ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE deleted_at IS NULL", sql)
+	})
+}
+
+func TestQuery_SoftDeletePaging(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	table := (&Table{DB: query.DB, name: "users"}).SetSoftDeleteColumn("deleted_at")
+	cursor := &types.CompositeCursor{
+		KeyValues: map[string]interface{}{"id": 100},
+		OrderFields: []struct {
+			Name      string `json:"name"`
+			Direction string `json:"direction"`
+		}{
+			{Name: "id", Direction: "ASC"},
+		},
+		Forward: true,
+		Limit:   2,
+	}
+
+	t.Run("composite cursor keeps soft delete filter", func(t *testing.T) {
+		sql, args := table.Query().WithCompositeCursor(cursor).ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE ((id) > ($1)) AND deleted_at IS NULL ORDER BY id ASC LIMIT 3", sql)
+		assert.Equal(t, []interface{}{100}, args)
+
+		sql, _ = table.Query().OnlyDeleted().WithCompositeCursor(cursor).ToSQL()
+		assert.Contains(t, sql, "deleted_at IS NOT NULL", "OnlyDeleted should survive the cursor copy")
+
+		sql, _ = table.Query().WithDeleted().WithCompositeCursor(cursor).ToSQL()
+		assert.NotContains(t, sql, "deleted_at", "WithDeleted should survive the cursor copy")
+	})
+
+	t.Run("total count excludes soft deleted rows", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE \(\(id\) > \(\$1\)\) AND deleted_at IS NULL ORDER BY id ASC LIMIT 3$`).
+			WithArgs(100).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(101, "a").AddRow(102, "b"))
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM users WHERE \(\(id\) > \(\$1\)\) AND deleted_at IS NULL$`).
+			WithArgs(100).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+		var users []User
+		page, err := table.Query().WithCompositeCursor(cursor).GetPage(ctx, &users, true)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), page.TotalCount)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestQuery_WhereNullSafeEq(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("NULL value", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE manager_id IS NOT DISTINCT FROM \$1$`).
+			WithArgs(nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Root"))
+
+		var users []User
+		err := query.WhereNullSafeEq("manager_id", nil).GetAll(context.Background(), &users)
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("non-NULL value combined with Where", func(t *testing.T) {
+		sql, args := query.Where("age > $1", 18).WhereNullSafeEq("manager_id", 7).ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE (age > $1) AND (manager_id IS NOT DISTINCT FROM $2)", sql)
+		assert.Equal(t, []interface{}{18, 7}, args)
+	})
+}
+
+func TestQuery_Union(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	posts := &Query{DB: query.DB, table: "posts"}
+	comments := &Query{DB: query.DB, table: "comments"}
+
+	type feedItem struct {
+		ID        int       `db:"id"`
+		Kind      string    `db:"kind"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+
+	feed := posts.Select("id", "'post' AS kind", "created_at").Where("author_id = $1", 7).
+		UnionAll(comments.Select("id", "'comment' AS kind", "created_at").Where("author_id = $1 AND NOT hidden", 7))
+
+	t.Run("cursor over union", func(t *testing.T) {
+		since := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(`^SELECT \* FROM \(\(SELECT id, 'post' AS kind, created_at FROM posts WHERE author_id = \$1\) `+
+			`UNION ALL \(SELECT id, 'comment' AS kind, created_at FROM comments WHERE author_id = \$2 AND NOT hidden\)\) `+
+			`AS union_result WHERE created_at < \$3 ORDER BY created_at DESC LIMIT 3$`).
+			WithArgs(7, 7, since).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "created_at"}).
+				AddRow(5, "comment", since.Add(-time.Hour)).
+				AddRow(9, "post", since.Add(-2*time.Hour)))
+
+		var items []feedItem
+		err := feed.DefaultCursorDirection("DESC").
+			WithCursor("created_at", &types.Cursor{KeyValue: since, Forward: true, Limit: 2}).
+			GetAll(ctx, &items)
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, "comment", items[0].Kind)
+		assert.Equal(t, "post", items[1].Kind)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("paginated union", func(t *testing.T) {
+		base := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+		unionSQL := `\(\(SELECT id, 'post' AS kind, created_at FROM posts WHERE author_id = \$1\) ` +
+			`UNION ALL \(SELECT id, 'comment' AS kind, created_at FROM comments WHERE author_id = \$2 AND NOT hidden\)\) AS union_result`
+		columns := []string{"id", "kind", "created_at"}
+
+		mock.ExpectQuery(`^SELECT \* FROM `+unionSQL+` ORDER BY created_at DESC LIMIT 3$`).
+			WithArgs(7, 7).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(5, "comment", base).
+				AddRow(9, "post", base.Add(-time.Hour)).
+				AddRow(4, "comment", base.Add(-2*time.Hour)))
+
+		var first []feedItem
+		page, err := feed.DefaultCursorDirection("DESC").Paginate(ctx, &first, "created_at", "", 2)
+		require.NoError(t, err)
+		require.Len(t, first, 2)
+		assert.True(t, page.HasNext)
+		require.NotEmpty(t, page.NextToken)
+
+		// 游标条件作用于合并结果，参数编号接在两个子查询的参数之后
+		mock.ExpectQuery(`^SELECT \* FROM `+unionSQL+` WHERE created_at < \$3 ORDER BY created_at DESC LIMIT 3$`).
+			WithArgs(7, 7, base.Add(-time.Hour).Format(time.RFC3339)).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(4, "comment", base.Add(-2*time.Hour)))
+
+		var second []feedItem
+		page, err = feed.DefaultCursorDirection("DESC").Paginate(ctx, &second, "created_at", page.NextToken, 2)
+		require.NoError(t, err)
+		require.Len(t, second, 1)
+		assert.Equal(t, 4, second[0].ID)
+		assert.False(t, page.HasNext)
+		assert.True(t, page.HasPrev)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("count over union", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM \(\(SELECT .+ FROM posts WHERE author_id = \$1\) UNION ALL `+
+			`\(SELECT .+ FROM comments WHERE author_id = \$2 AND NOT hidden\)\) AS union_result WHERE kind = \$3$`).
+			WithArgs(7, 7, "post").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		count, err := feed.Where("kind = $1", "post").Count(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ClearWhere keeps union arguments", func(t *testing.T) {
+		sql, args := feed.Where("kind = $1", "post").ClearWhere().ToSQL()
+		assert.Equal(t, "SELECT * FROM ((SELECT id, 'post' AS kind, created_at FROM posts WHERE author_id = $1) UNION ALL "+
+			"(SELECT id, 'comment' AS kind, created_at FROM comments WHERE author_id = $2 AND NOT hidden)) AS union_result", sql)
+		assert.Equal(t, []interface{}{7, 7}, args)
+	})
+
+	t.Run("UNION and builder errors", func(t *testing.T) {
+		sql, _ := posts.Select("author_id").Union(comments.Select("author_id")).ToSQL()
+		assert.Equal(t, "SELECT * FROM ((SELECT author_id FROM posts) UNION (SELECT author_id FROM comments)) AS union_result", sql)
+
+		var items []feedItem
+		err := posts.Union(comments.WhereIn("id", []int{})).GetAll(ctx, &items)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+func TestQuery_WhereFullText(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("predicate with language", func(t *testing.T) {
+		sql, args := query.Where("published = $1", true).
+			WhereFullText("search_vector", "postgres tips", "english").ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE (published = $1) AND (search_vector @@ plainto_tsquery('english', $2))", sql)
+		assert.Equal(t, []interface{}{true, "postgres tips"}, args)
+	})
+
+	t.Run("default configuration", func(t *testing.T) {
+		sql, args := query.WhereFullText("to_tsvector(body)", "hello").ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE to_tsvector(body) @@ plainto_tsquery($1)", sql)
+		assert.Equal(t, []interface{}{"hello"}, args)
+	})
+
+	t.Run("ordered by rank", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT \* FROM users WHERE search_vector @@ plainto_tsquery\('english', \$1\) ` +
+			`ORDER BY ts_rank\(search_vector, plainto_tsquery\('english', 'it''s fast'\)\) DESC LIMIT 10$`).
+			WithArgs("it's fast").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "b").AddRow(1, "a"))
+
+		var users []User
+		err := query.WhereFullText("search_vector", "it's fast", "english").
+			OrderByRank("search_vector", "it's fast", "english").
+			Limit(10).
+			GetAll(context.Background(), &users)
+		assert.NoError(t, err)
+		assert.Len(t, users, 2)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid language", func(t *testing.T) {
+		var users []User
+		err := query.WhereFullText("search_vector", "x", "english'); DROP TABLE users; --").GetAll(context.Background(), &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+
+		err = query.OrderByRank("search_vector", "x", "bad language").GetAll(context.Background(), &users)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+func TestQuery_Raw(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	rawSQL := "SELECT u.id, u.name FROM users u JOIN orders o ON o.user_id = u.id WHERE o.total > $1"
+
+	t.Run("multiple rows with metrics", func(t *testing.T) {
+		before := testutil.ToFloat64(_totalOperCount.WithLabelValues("users", string(queryOper)))
+		mock.ExpectQuery("^" + regexp.QuoteMeta(rawSQL) + "$").
+			WithArgs(100).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b"))
+
+		var users []User
+		err := query.Where("ignored = $1", true).Raw(ctx, &users, rawSQL, 100)
+		assert.NoError(t, err)
+		assert.Len(t, users, 2)
+		assert.Equal(t, before+1, testutil.ToFloat64(_totalOperCount.WithLabelValues("users", string(queryOper))),
+			"Raw query should be counted under the table's collection")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("single row and not found", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT max\(id\) FROM users$`).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(42))
+		mock.ExpectQuery(`^SELECT id, name FROM users WHERE id = \$1$`).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+		var maxID int64
+		assert.NoError(t, query.Raw(ctx, &maxID, "SELECT max(id) FROM users"))
+		assert.Equal(t, int64(42), maxID)
+
+		var user User
+		err := query.Raw(ctx, &user, "SELECT id, name FROM users WHERE id = $1", 7)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("runs inside the context transaction", func(t *testing.T) {
+		txBefore := testutil.ToFloat64(_txOperCount.WithLabelValues("users", string(queryOper)))
+		mock.ExpectBegin()
+		mock.ExpectQuery(`^SELECT id, name FROM users WHERE id = \$1 FOR UPDATE$`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a"))
+		mock.ExpectRollback()
+
+		// 只有一条连接时，未使用事务连接的查询会一直等待直到超时
+		query.db.SetMaxOpenConns(1)
+		defer query.db.SetMaxOpenConns(0)
+		txCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		errAbort := errors.New("abort")
+		err := query.InTx(txCtx, func(ctx context.Context) error {
+			var user User
+			if err := query.Raw(ctx, &user, "SELECT id, name FROM users WHERE id = $1 FOR UPDATE", 1); err != nil {
+				return err
+			}
+			assert.Equal(t, "a", user.Name)
+			return errAbort
+		})
+		assert.ErrorIs(t, err, errAbort)
+		assert.Equal(t, txBefore+1, testutil.ToFloat64(_txOperCount.WithLabelValues("users", string(queryOper))))
+		assert.NoError(t, mock.ExpectationsWereMet(), "Query should run between BEGIN and ROLLBACK")
+	})
+}
+
+func TestQuery_Comment(t *testing.T) {
+	query, mock, cleanup := setupQueryTest(t)
+	defer cleanup()
+
+	t.Run("comment prefix", func(t *testing.T) {
+		sql, args := query.Comment("app:checkout handler:submit").Where("id = $1", 1).ToSQL()
+		assert.Equal(t, "/* app:checkout handler:submit */ SELECT * FROM users WHERE id = $1", sql)
+		assert.Equal(t, []interface{}{1}, args)
+	})
+
+	t.Run("count and execution", func(t *testing.T) {
+		mock.ExpectQuery(`^/\* app:report \*/ SELECT COUNT\(\*\) FROM users WHERE age > \$1$`).
+			WithArgs(18).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+		mock.ExpectQuery(`^/\* app:report \*/ SELECT COUNT\(\*\) FROM \(SELECT role FROM users GROUP BY role\) AS sub$`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+		count, err := query.Comment("app:report").Where("age > $1", 18).Count(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), count)
+
+		count, err = query.Comment("app:report").Select("role").GroupBy("role").Count(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("sanitization", func(t *testing.T) {
+		sql, _ := query.Comment("x */ DROP TABLE users; /* y").ToSQL()
+		assert.Equal(t, "/* x  DROP TABLE users;  y */ SELECT * FROM users", sql)
+
+		sql, _ = query.Comment("a**//b\n-- c").ToSQL()
+		assert.Equal(t, "/* ab -- c */ SELECT * FROM users", sql, "Delimiters formed after removal are removed too")
+
+		sql, _ = query.Comment("app:x").Comment("  */  ").ToSQL()
+		assert.Equal(t, "SELECT * FROM users", sql, "Empty tag removes the comment")
+	})
 }
@@ -3,7 +3,10 @@ package postgresql_helper
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/songzhibin97/postgresql_helper/types"
@@ -21,6 +24,7 @@ func (s Schema) CreateTable(ctx context.Context, schema types.TableSchema) error
 		for _, col := range schema.Columns {
 			columnDef := fmt.Sprintf("%s %s", col.Name, col.Type)
 
+			columnDef += generatedClause(col)
 			if col.PrimaryKey {
 				columnDef += " PRIMARY KEY"
 			}
@@ -46,17 +50,197 @@ func (s Schema) CreateTable(ctx context.Context, schema types.TableSchema) error
 			columns = append(columns, columnDef)
 		}
 
+		// 表级复合唯一约束
+		for _, uniqueCols := range schema.UniqueConstraints {
+			if len(uniqueCols) == 0 {
+				continue
+			}
+			columns = append(columns, fmt.Sprintf("UNIQUE (%s)", strings.Join(uniqueCols, ", ")))
+		}
+
+		// 表级CHECK约束（支持跨列条件，如 start_date < end_date），约束名使用不带模式前缀的表名
+		_, baseName := splitTableName(schema.Name)
+		for i, check := range schema.Checks {
+			columns = append(columns, fmt.Sprintf("CONSTRAINT %s_check_%d CHECK (%s)", baseName, i+1, check))
+		}
+
 		createSQL := "CREATE TABLE"
 		if schema.IfNotExists {
 			createSQL += " IF NOT EXISTS"
 		}
 		createSQL += fmt.Sprintf(" %s (%s)", schema.Name, strings.Join(columns, ","))
+		createSQL += storageClause(schema)
 
 		_, err := s.db.ExecContext(ctx, createSQL)
+		invalidateTableColumns(s.db, schema.Name)
 		return s.wrapError(err, "create table "+schema.Name)
 	})
 }
 
+// splitTableName 将 schema.table 形式的表名拆分为模式名与表名，未带模式时模式名为空
+func splitTableName(name string) (schemaName, tableName string) {
+	if pos := strings.LastIndex(name, "."); pos != -1 {
+		return name[:pos], name[pos+1:]
+	}
+	return "", name
+}
+
+// CreateTableFromStruct 根据结构体字段推断列定义并创建表，model 为结构体或结构体指针
+// 列名规则与写入时相同（db 标签或 DBConfig.FieldMapper），嵌入结构体的字段展开为同一张表的列；
+// 列类型按 Go 类型推断（见 columnTypeOf），也可用 pgtype 标签指定，如 `db:"price" pgtype:"NUMERIC(10,2)"`；
+// 指针与 sql.Null* 类型的列可为 NULL，其余为 NOT NULL；名为 id 的列作为主键
+func (s Schema) CreateTableFromStruct(ctx context.Context, tableName string, model interface{}) error {
+	schema, err := tableSchemaFromStruct(tableName, model, s.fieldMapper)
+	if err != nil {
+		return s.wrapError(err, "create table "+tableName)
+	}
+	return s.CreateTable(ctx, schema)
+}
+
+// tableSchemaFromStruct 由结构体生成表定义
+func tableSchemaFromStruct(tableName string, model interface{}, mapper func(string) string) (types.TableSchema, error) {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return types.TableSchema{}, fmt.Errorf("%w: expected struct, got %T", types.ErrInvalidStructure, model)
+	}
+
+	columns, err := structColumnDefinitions(t, mapper)
+	if err != nil {
+		return types.TableSchema{}, err
+	}
+	if len(columns) == 0 {
+		return types.TableSchema{}, fmt.Errorf("%w: struct %s has no mapped columns", types.ErrInvalidStructure, t)
+	}
+	return types.TableSchema{Name: tableName, Columns: columns}, nil
+}
+
+// structColumnDefinitions 按字段顺序生成列定义，pgtype 标签优先于推断的类型
+func structColumnDefinitions(t reflect.Type, mapper func(string) string) ([]types.ColumnDefinition, error) {
+	var columns []types.ColumnDefinition
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// 与 sqlx 扫描规则一致，未标记的嵌入结构体同样展开
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && !isValuerType(field.Type) &&
+			field.Tag.Get("db") != "-" {
+			embedded, err := structColumnDefinitions(field.Type, mapper)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, embedded...)
+			continue
+		}
+
+		name, _, ok := fieldColumn(field, mapper)
+		if !ok {
+			continue
+		}
+
+		colType, nullable := columnTypeOf(field.Type)
+		if override := strings.TrimSpace(field.Tag.Get("pgtype")); override != "" {
+			colType = override
+		}
+		if colType == "" {
+			return nil, fmt.Errorf("%w: cannot infer column type for field %s (%s), add a pgtype tag",
+				types.ErrInvalidStructure, field.Name, field.Type)
+		}
+
+		columns = append(columns, types.ColumnDefinition{
+			Name:       name,
+			Type:       colType,
+			Nullable:   nullable,
+			PrimaryKey: name == "id",
+		})
+	}
+	return columns, nil
+}
+
+var (
+	nullTypeColumns = map[reflect.Type]string{
+		reflect.TypeOf(sql.NullString{}):  "TEXT",
+		reflect.TypeOf(sql.NullInt64{}):   "BIGINT",
+		reflect.TypeOf(sql.NullInt32{}):   "INTEGER",
+		reflect.TypeOf(sql.NullInt16{}):   "SMALLINT",
+		reflect.TypeOf(sql.NullFloat64{}): "DOUBLE PRECISION",
+		reflect.TypeOf(sql.NullBool{}):    "BOOLEAN",
+		reflect.TypeOf(sql.NullTime{}):    "TIMESTAMP WITH TIME ZONE",
+	}
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// columnTypeOf 推断 Go 类型对应的 PostgreSQL 列类型及是否可为 NULL，无法推断时类型为空
+// 整数按位宽映射为 SMALLINT / INTEGER / BIGINT，time.Time 为 TIMESTAMP WITH TIME ZONE，
+// []byte 为 BYTEA，其余切片、映射和结构体按 JSON 存储为 JSONB
+func columnTypeOf(t reflect.Type) (string, bool) {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	if colType, ok := nullTypeColumns[t]; ok {
+		return colType, true
+	}
+	switch {
+	case t == timeType:
+		return "TIMESTAMP WITH TIME ZONE", nullable
+	case t == rawMessageType:
+		return "JSONB", true
+	case isValuerType(t):
+		return "", nullable // 自定义类型的存储格式未知，需通过 pgtype 指定
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN", nullable
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "SMALLINT", nullable
+	case reflect.Int32, reflect.Uint16:
+		return "INTEGER", nullable
+	case reflect.Int, reflect.Int64, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		return "BIGINT", nullable
+	case reflect.Float32:
+		return "REAL", nullable
+	case reflect.Float64:
+		return "DOUBLE PRECISION", nullable
+	case reflect.String:
+		return "TEXT", nullable
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BYTEA", true
+		}
+		return "JSONB", true
+	case reflect.Map:
+		return "JSONB", true
+	case reflect.Struct:
+		return "JSONB", nullable
+	}
+	return "", nullable
+}
+
+// storageClause 生成列定义之后的 WITH (...) 与 TABLESPACE 子句
+func storageClause(schema types.TableSchema) string {
+	var clause string
+	if len(schema.StorageParams) > 0 {
+		keys := make([]string, 0, len(schema.StorageParams))
+		for key := range schema.StorageParams {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		params := make([]string, len(keys))
+		for i, key := range keys {
+			params[i] = key + "=" + schema.StorageParams[key]
+		}
+		clause += " WITH (" + strings.Join(params, ", ") + ")"
+	}
+	if schema.Tablespace != "" {
+		clause += " TABLESPACE " + schema.Tablespace
+	}
+	return clause
+}
+
 func (s Schema) AlterTable(ctx context.Context, tableName string, alterations []string) error {
 	return s.withMetrics(ctx, tableName, alertOper, func(ctx context.Context) error {
 		if len(alterations) == 0 {
@@ -68,6 +252,7 @@ func (s Schema) AlterTable(ctx context.Context, tableName string, alterations []
 
 		alterSQL := fmt.Sprintf("ALTER TABLE %s %s", tableName, strings.Join(alterations, ","))
 		_, err := s.db.ExecContext(ctx, alterSQL)
+		invalidateTableColumns(s.db, tableName)
 		return s.wrapError(err, "alter table "+tableName)
 	})
 }
@@ -79,10 +264,30 @@ func (s Schema) DropTable(ctx context.Context, tableName string, cascade bool) e
 			query += " CASCADE"
 		}
 		_, err := s.db.ExecContext(ctx, query)
+		invalidateTableColumns(s.db, tableName)
 		return s.wrapError(err, "drop table "+tableName)
 	})
 }
 
+// TruncateTables 在一条语句中清空多张表，比逐表 DELETE 快得多，常用于测试数据重置
+// tables 为空时不执行任何操作
+func (s Schema) TruncateTables(ctx context.Context, tables []string, restartIdentity bool) error {
+	if len(tables) == 0 {
+		return nil
+	}
+	// 表的组合不固定，指标使用空的 collection 标签，避免标签基数随表组合无限增长
+	return s.withMetrics(ctx, "", deleteOper, func(ctx context.Context) error {
+		tableList := strings.Join(tables, ", ")
+		query := "TRUNCATE " + tableList
+		if restartIdentity {
+			query += " RESTART IDENTITY"
+		}
+		query += " CASCADE"
+		_, err := s.db.ExecContext(ctx, query)
+		return s.wrapError(err, "truncate tables "+tableList)
+	})
+}
+
 func (s Schema) TableExists(ctx context.Context, tableName string) (bool, error) {
 	var exists bool
 	err := s.withMetrics(ctx, tableName, queryOper, func(ctx context.Context) error {
@@ -126,6 +331,13 @@ func (s Schema) GetTableSchema(ctx context.Context, tableName string) (*types.Ta
 			return s.wrapError(err, "get indexes")
 		}
 
+		indexesByColumn := make(map[string][]types.IndexDefinition)
+		for _, idx := range indexes {
+			for _, col := range idx.Columns {
+				indexesByColumn[col] = append(indexesByColumn[col], idx)
+			}
+		}
+
 		// 5. 获取外键约束
 		fkConstraints, err := s.getForeignKeys(ctx, tableName)
 		if err != nil {
@@ -133,7 +345,7 @@ func (s Schema) GetTableSchema(ctx context.Context, tableName string) (*types.Ta
 		}
 
 		// 6. 获取检查约束
-		checkConstraints, err := s.getCheckConstraints(ctx, tableName)
+		checkConstraints, tableConstraints, err := s.getCheckConstraints(ctx, tableName)
 		if err != nil {
 			return s.wrapError(err, "get check constraints")
 		}
@@ -148,9 +360,9 @@ func (s Schema) GetTableSchema(ctx context.Context, tableName string) (*types.Ta
 			}
 
 			// 处理索引
-			if indexes, ok := indexes[col.Name]; ok {
-				col.Index = len(indexes) > 0
-				for _, idx := range indexes {
+			if colIndexes, ok := indexesByColumn[col.Name]; ok {
+				col.Index = len(colIndexes) > 0
+				for _, idx := range colIndexes {
 					if idx.Unique {
 						col.Unique = true
 					}
@@ -169,12 +381,33 @@ func (s Schema) GetTableSchema(ctx context.Context, tableName string) (*types.Ta
 		}
 		schema.Name = tableName
 		schema.Columns = columns
+		schema.Indexes = indexes
+		schema.Constraints = tableConstraints
 		return nil
 	})
 
 	return &schema, err
 }
 
+// GetTableStats 从系统目录读取表的估算行数和总占用空间（含索引和TOAST）
+// 行数为统计信息估算值，需 ANALYZE/autovacuum 更新；表不存在时返回 ErrRecordNotFound
+func (s Schema) GetTableStats(ctx context.Context, tableName string) (*types.TableStats, error) {
+	var stats types.TableStats
+	err := s.withMetrics(ctx, tableName, queryOper, func(ctx context.Context) error {
+		query := `SELECT GREATEST(c.reltuples, 0)::BIGINT AS estimated_rows,
+			pg_total_relation_size(c.oid) AS total_bytes
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public' AND c.relname = $1 AND c.relkind IN ('r', 'p')`
+		err := s.db.GetContext(ctx, &stats, query, tableName)
+		return s.wrapError(err, "get table stats")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
 // 列基础信息查询
 func (s Schema) getColumns(ctx context.Context, tableName string) ([]types.ColumnDefinition, error) {
 	query := `
@@ -182,23 +415,34 @@ func (s Schema) getColumns(ctx context.Context, tableName string) ([]types.Colum
 			column_name,
 			udt_name as data_type,
 			is_nullable,
-			column_default
+			column_default,
+			data_type as type_category,
+			udt_schema
 		FROM information_schema.columns
-		WHERE table_name = $1
-		ORDER BY ordinal_position`
+		WHERE table_name = $1`
+	// schema.table 形式的表名按模式过滤，information_schema 中的 table_name 不带模式前缀
+	args := []interface{}{tableName}
+	if schemaName, name := splitTableName(tableName); schemaName != "" {
+		query += " AND table_schema = $2"
+		args = []interface{}{name, schemaName}
+	}
+	query += "\n\t\tORDER BY ordinal_position"
 
 	var columns []struct {
-		Name     string         `db:"column_name"`
-		Type     string         `db:"data_type"`
-		Nullable string         `db:"is_nullable"`
-		Default  sql.NullString `db:"column_default"`
+		Name      string         `db:"column_name"`
+		Type      string         `db:"data_type"`
+		Nullable  string         `db:"is_nullable"`
+		Default   sql.NullString `db:"column_default"`
+		Category  sql.NullString `db:"type_category"`
+		UdtSchema sql.NullString `db:"udt_schema"`
 	}
 
-	if err := s.db.SelectContext(ctx, &columns, query, tableName); err != nil {
+	if err := s.db.SelectContext(ctx, &columns, query, args...); err != nil {
 		return nil, fmt.Errorf("get columns failed: %w", err)
 	}
 
 	result := make([]types.ColumnDefinition, 0, len(columns))
+	enums := make(map[string][]string) // 同一枚举类型只查询一次
 	for _, c := range columns {
 		col := types.ColumnDefinition{
 			Name:     c.Name,
@@ -210,6 +454,23 @@ func (s Schema) getColumns(ctx context.Context, tableName string) ([]types.Colum
 			col.Default = c.Default.String
 		}
 
+		// 用户自定义类型可能是枚举，从 pg_enum 读取取值；枚举类型名区分大小写，保留原样
+		if c.Category.String == "USER-DEFINED" {
+			key := c.UdtSchema.String + "." + c.Type
+			values, ok := enums[key]
+			if !ok {
+				var err error
+				if values, err = s.getEnumValues(ctx, c.UdtSchema.String, c.Type); err != nil {
+					return nil, err
+				}
+				enums[key] = values
+			}
+			if len(values) > 0 {
+				col.Type = c.Type
+				col.EnumValues = values
+			}
+		}
+
 		// 处理特殊类型映射
 		switch col.Type {
 		case "text":
@@ -237,6 +498,23 @@ func (s Schema) getColumns(ctx context.Context, tableName string) ([]types.Colum
 	return result, nil
 }
 
+// getEnumValues 按定义顺序返回枚举类型的取值，类型不是枚举时返回空
+func (s Schema) getEnumValues(ctx context.Context, typeSchema, typeName string) ([]string, error) {
+	query := `
+		SELECT e.enumlabel
+		FROM pg_enum e
+		JOIN pg_type t ON t.oid = e.enumtypid
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE t.typname = $1 AND n.nspname = $2
+		ORDER BY e.enumsortorder`
+
+	var values []string
+	if err := s.db.SelectContext(ctx, &values, query, typeName, typeSchema); err != nil {
+		return nil, fmt.Errorf("get enum values failed: %w", err)
+	}
+	return values, nil
+}
+
 // 主键查询
 func (s Schema) getPrimaryKeys(ctx context.Context, tableName string) (map[string]struct{}, error) {
 	query := `
@@ -264,36 +542,43 @@ func (s Schema) getPrimaryKeys(ctx context.Context, tableName string) (map[strin
 	return pkMap, nil
 }
 
+// GetIndexes 获取表上的全部索引定义（名称、列、唯一性、索引方法及部分索引条件）
+func (s Schema) GetIndexes(ctx context.Context, tableName string) ([]types.IndexDefinition, error) {
+	var indexes []types.IndexDefinition
+	err := s.withMetrics(ctx, tableName, queryOper, func(ctx context.Context) error {
+		var err error
+		indexes, err = s.getIndexes(ctx, tableName)
+		return s.wrapError(err, "get indexes")
+	})
+	return indexes, err
+}
+
 // 索引查询
-func (s Schema) getIndexes(ctx context.Context, tableName string) (map[string][]indexInfo, error) {
+func (s Schema) getIndexes(ctx context.Context, tableName string) ([]types.IndexDefinition, error) {
 	query := `
 		SELECT
 			indexname,
-			indexdef,
-			indisunique
+			indexdef
 		FROM pg_indexes
-		WHERE tablename = $1`
+		WHERE tablename = $1
+		ORDER BY indexname`
 
 	var indexes []struct {
-		Name     string `db:"indexname"`
-		Def      string `db:"indexdef"`
-		IsUnique bool   `db:"indisunique"`
+		Name string         `db:"indexname"`
+		Def  sql.NullString `db:"indexdef"`
 	}
 
 	if err := s.db.SelectContext(ctx, &indexes, query, tableName); err != nil {
 		return nil, fmt.Errorf("get indexes failed: %w", err)
 	}
 
-	result := make(map[string][]indexInfo)
+	result := make([]types.IndexDefinition, 0, len(indexes))
 	for _, idx := range indexes {
-		// 解析索引涉及的列
-		cols := extractColumnsFromIndexDef(idx.Def)
-		for _, col := range cols {
-			result[col] = append(result[col], indexInfo{
-				Name:   idx.Name,
-				Unique: idx.IsUnique,
-			})
+		// 没有定义的索引无法解析列和方法，直接跳过
+		if !idx.Def.Valid {
+			continue
 		}
+		result = append(result, parseIndexDef(idx.Name, idx.Def.String))
 	}
 	return result, nil
 }
@@ -314,12 +599,13 @@ func (s Schema) getForeignKeys(ctx context.Context, tableName string) (map[strin
 			ON rc.unique_constraint_name = cc.constraint_name
 		WHERE kc.table_name = $1`
 
+	// 引用表/列和动作规则对部分约束类型可能为 NULL
 	var fks []struct {
-		Column    string `db:"column_name"`
-		RefTable  string `db:"ref_table"`
-		RefColumn string `db:"ref_column"`
-		OnDelete  string `db:"delete_rule"`
-		OnUpdate  string `db:"update_rule"`
+		Column    string         `db:"column_name"`
+		RefTable  sql.NullString `db:"ref_table"`
+		RefColumn sql.NullString `db:"ref_column"`
+		OnDelete  sql.NullString `db:"delete_rule"`
+		OnUpdate  sql.NullString `db:"update_rule"`
 	}
 
 	if err := s.db.SelectContext(ctx, &fks, query, tableName); err != nil {
@@ -329,10 +615,10 @@ func (s Schema) getForeignKeys(ctx context.Context, tableName string) (map[strin
 	result := make(map[string]*types.ForeignKey)
 	for _, fk := range fks {
 		result[fk.Column] = &types.ForeignKey{
-			ReferenceTable:  fk.RefTable,
-			ReferenceColumn: fk.RefColumn,
-			OnDelete:        normalizeAction(fk.OnDelete),
-			OnUpdate:        normalizeAction(fk.OnUpdate),
+			ReferenceTable:  fk.RefTable.String,
+			ReferenceColumn: fk.RefColumn.String,
+			OnDelete:        normalizeAction(fk.OnDelete.String),
+			OnUpdate:        normalizeAction(fk.OnUpdate.String),
 		}
 	}
 	return result, nil
@@ -348,56 +634,160 @@ func normalizeAction(action string) string {
 	}
 }
 
-// 检查约束查询
-func (s Schema) getCheckConstraints(ctx context.Context, tableName string) (map[string]string, error) {
+// 检查约束及唯一约束查询
+// 只涉及单列的CHECK按列返回；涉及多列或不涉及列的CHECK及多列UNIQUE作为表级约束返回
+func (s Schema) getCheckConstraints(ctx context.Context, tableName string) (map[string]string, []types.TableConstraint, error) {
 	query := `
 		SELECT
 			pgc.conname AS constraint_name,
-			pg_get_constraintdef(pgc.oid) AS check_clause
+			pgc.contype AS constraint_type,
+			pg_get_constraintdef(pgc.oid) AS check_clause,
+			array_to_string(ARRAY(
+				SELECT att.attname
+				FROM pg_attribute att
+				WHERE att.attrelid = pgc.conrelid AND att.attnum = ANY(pgc.conkey)
+				ORDER BY att.attnum
+			), ',') AS column_names
 		FROM pg_constraint pgc
 		JOIN pg_class cls
 			ON pgc.conrelid = cls.oid
 		WHERE 
 			cls.relname = $1
-			AND pgc.contype = 'c'`
+			AND pgc.contype IN ('c', 'u')
+		ORDER BY pgc.conname`
 
 	var checks []struct {
-		Name        string `db:"constraint_name"`
-		CheckClause string `db:"check_clause"`
+		Name        string         `db:"constraint_name"`
+		Type        sql.NullString `db:"constraint_type"`
+		CheckClause sql.NullString `db:"check_clause"`
+		ColumnNames sql.NullString `db:"column_names"`
 	}
 
 	if err := s.db.SelectContext(ctx, &checks, query, tableName); err != nil {
-		return nil, fmt.Errorf("get check constraints failed: %w", err)
+		return nil, nil, fmt.Errorf("get check constraints failed: %w", err)
 	}
 
 	result := make(map[string]string)
+	var constraints []types.TableConstraint
 	for _, c := range checks {
-		// 解析涉及列（简化处理）
-		if cols := parseColumnsFromCheck(c.CheckClause); len(cols) > 0 {
-			for _, col := range cols {
-				result[col] = c.CheckClause
+		if !c.CheckClause.Valid {
+			continue
+		}
+
+		// 优先使用约束记录的列，缺失时从表达式中解析（简化处理）
+		var cols []string
+		if c.ColumnNames.String != "" {
+			cols = strings.Split(c.ColumnNames.String, ",")
+		} else if c.Type.String != "u" {
+			cols = parseColumnsFromCheck(c.CheckClause.String)
+		}
+
+		if c.Type.String == "u" {
+			// 单列唯一约束已通过索引标记在列上
+			if len(cols) > 1 {
+				constraints = append(constraints, types.TableConstraint{
+					Name: c.Name, Type: "UNIQUE", Columns: cols, Definition: c.CheckClause.String,
+				})
 			}
+			continue
+		}
+
+		if len(cols) == 1 {
+			result[cols[0]] = c.CheckClause.String
+			continue
 		}
+		constraints = append(constraints, types.TableConstraint{
+			Name: c.Name, Type: "CHECK", Columns: cols, Definition: c.CheckClause.String,
+		})
 	}
-	return result, nil
+	return result, constraints, nil
+}
+
+// 辅助函数
+
+// generatedClause 生成列子句，非生成列返回空字符串
+func generatedClause(col types.ColumnDefinition) string {
+	if col.Generated == "" {
+		return ""
+	}
+	clause := " GENERATED ALWAYS AS (" + col.Generated + ")"
+	if col.GeneratedStored {
+		clause += " STORED"
+	}
+	return clause
 }
 
-// 辅助结构体和函数
-type indexInfo struct {
-	Name   string
-	Unique bool
+// parseIndexDef 解析 pg_indexes.indexdef 为结构化索引定义
+// 示例: CREATE UNIQUE INDEX idx ON public.users USING btree (tenant_id, email) WHERE (deleted_at IS NULL)
+func parseIndexDef(name, def string) types.IndexDefinition {
+	idx := types.IndexDefinition{
+		Name:    name,
+		Unique:  strings.HasPrefix(strings.ToUpper(def), "CREATE UNIQUE INDEX"),
+		Method:  "btree",
+		Columns: extractColumnsFromIndexDef(def),
+	}
+
+	if pos := strings.Index(def, " USING "); pos != -1 {
+		if fields := strings.Fields(def[pos+len(" USING "):]); len(fields) > 0 {
+			idx.Method = fields[0]
+		}
+	}
+
+	if pos := strings.LastIndex(def, " WHERE "); pos != -1 {
+		idx.Predicate = trimOuterParens(strings.TrimSpace(def[pos+len(" WHERE "):]))
+	}
+
+	return idx
 }
 
 func extractColumnsFromIndexDef(def string) []string {
 	// 示例索引定义: CREATE INDEX idx_name ON table (col1, col2)
 	start := strings.Index(def, "(")
-	end := strings.Index(def, ")")
-	if start == -1 || end == -1 {
+	if start == -1 {
 		return nil
 	}
 
-	colsPart := def[start+1 : end]
-	return strings.Split(strings.ReplaceAll(colsPart, " ", ""), ",")
+	// 按括号深度查找列清单的结束位置，并按顶层逗号拆分（兼容 lower(email) 等表达式）
+	var cols []string
+	depth := 0
+	last := start + 1
+	for i := start; i < len(def); i++ {
+		switch def[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return append(cols, strings.TrimSpace(def[last:i]))
+			}
+		case ',':
+			if depth == 1 {
+				cols = append(cols, strings.TrimSpace(def[last:i]))
+				last = i + 1
+			}
+		}
+	}
+	return nil
+}
+
+// trimOuterParens 去掉包裹整个表达式的一对括号
+func trimOuterParens(expr string) string {
+	if !strings.HasPrefix(expr, "(") || !strings.HasSuffix(expr, ")") {
+		return expr
+	}
+	depth := 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i != len(expr)-1 {
+				return expr // 首个括号在末尾之前已闭合，说明不是整体包裹
+			}
+		}
+	}
+	return expr[1 : len(expr)-1]
 }
 
 func parseColumnsFromCheck(clause string) []string {
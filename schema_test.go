@@ -2,12 +2,16 @@ package postgresql_helper
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/songzhibin97/postgresql_helper/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -74,6 +78,24 @@ func TestSchema_CreateTable(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
+	t.Run("create table with storage parameters and tablespace", func(t *testing.T) {
+		mock.ExpectExec(`^CREATE TABLE events \(id BIGSERIAL PRIMARY KEY NOT NULL\) ` +
+			`WITH \(autovacuum_enabled=false, fillfactor=70\) TABLESPACE fast_ssd$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := schema.CreateTable(ctx, types.TableSchema{
+			Name:    "events",
+			Columns: []types.ColumnDefinition{{Name: "id", Type: "BIGSERIAL", PrimaryKey: true}},
+			StorageParams: map[string]string{
+				"fillfactor":         "70",
+				"autovacuum_enabled": "false",
+			},
+			Tablespace: "fast_ssd",
+		})
+		assert.NoError(t, err, "CreateTable should not return error")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
 	t.Run("create table with if not exists", func(t *testing.T) {
 		// 设置期望
 		mock.ExpectExec("CREATE TABLE IF NOT EXISTS").
@@ -141,6 +163,125 @@ func TestSchema_CreateTable(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
+	t.Run("create table with table-level checks", func(t *testing.T) {
+		// 设置期望 - 表级约束位于列定义之后
+		mock.ExpectExec(`CREATE TABLE bookings \(id SERIAL PRIMARY KEY NOT NULL,start_date DATE NOT NULL,end_date DATE NOT NULL,` +
+			`CONSTRAINT bookings_check_1 CHECK \(start_date < end_date\),CONSTRAINT bookings_check_2 CHECK \(end_date - start_date <= 30\)\)`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// 准备测试数据
+		tableSchema := types.TableSchema{
+			Name: "bookings",
+			Columns: []types.ColumnDefinition{
+				{Name: "id", Type: "SERIAL", PrimaryKey: true},
+				{Name: "start_date", Type: "DATE"},
+				{Name: "end_date", Type: "DATE"},
+			},
+			Checks: []string{
+				"start_date < end_date",
+				"end_date - start_date <= 30",
+			},
+		}
+
+		// 执行测试
+		err := schema.CreateTable(ctx, tableSchema)
+		assert.NoError(t, err, "CreateTable with table-level checks should not return error")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("create schema-qualified table with checks", func(t *testing.T) {
+		// 设置期望 - 约束名不能带模式前缀
+		mock.ExpectExec(`^CREATE TABLE public\.orders \(id SERIAL PRIMARY KEY NOT NULL,total INTEGER NOT NULL,` +
+			`CONSTRAINT orders_check_1 CHECK \(total >= 0\)\)$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		tableSchema := types.TableSchema{
+			Name: "public.orders",
+			Columns: []types.ColumnDefinition{
+				{Name: "id", Type: "SERIAL", PrimaryKey: true},
+				{Name: "total", Type: "INTEGER"},
+			},
+			Checks: []string{"total >= 0"},
+		}
+
+		err := schema.CreateTable(ctx, tableSchema)
+		assert.NoError(t, err, "CreateTable with a schema-qualified name should not return error")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("create table with composite unique", func(t *testing.T) {
+		// 设置期望 - 列级UNIQUE与表级复合UNIQUE共存
+		mock.ExpectExec(`CREATE TABLE members \(id SERIAL PRIMARY KEY NOT NULL,tenant_id INTEGER NOT NULL,email VARCHAR\(255\) NOT NULL UNIQUE,` +
+			`UNIQUE \(tenant_id, email\)\)`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// 准备测试数据
+		tableSchema := types.TableSchema{
+			Name: "members",
+			Columns: []types.ColumnDefinition{
+				{Name: "id", Type: "SERIAL", PrimaryKey: true},
+				{Name: "tenant_id", Type: "INTEGER"},
+				{Name: "email", Type: "VARCHAR(255)", Unique: true},
+			},
+			UniqueConstraints: [][]string{
+				{"tenant_id", "email"},
+			},
+		}
+
+		// 执行测试
+		err := schema.CreateTable(ctx, tableSchema)
+		assert.NoError(t, err, "CreateTable with composite unique should not return error")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("create table with multiple composite uniques", func(t *testing.T) {
+		// 设置期望
+		mock.ExpectExec(`CREATE TABLE members \(tenant_id INTEGER NOT NULL,email VARCHAR\(255\) NOT NULL,username VARCHAR\(64\) NOT NULL,` +
+			`UNIQUE \(tenant_id, email\),UNIQUE \(tenant_id, username\)\)`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// 准备测试数据
+		tableSchema := types.TableSchema{
+			Name: "members",
+			Columns: []types.ColumnDefinition{
+				{Name: "tenant_id", Type: "INTEGER"},
+				{Name: "email", Type: "VARCHAR(255)"},
+				{Name: "username", Type: "VARCHAR(64)"},
+			},
+			UniqueConstraints: [][]string{
+				{"tenant_id", "email"},
+				{"tenant_id", "username"},
+			},
+		}
+
+		// 执行测试
+		err := schema.CreateTable(ctx, tableSchema)
+		assert.NoError(t, err, "CreateTable with multiple composite uniques should not return error")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("create table with generated column", func(t *testing.T) {
+		// 设置期望
+		mock.ExpectExec(`CREATE TABLE order_items \(price DECIMAL\(10,2\) NOT NULL,quantity INTEGER NOT NULL,` +
+			`total DECIMAL\(10,2\) GENERATED ALWAYS AS \(price \* quantity\) STORED NOT NULL\)`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// 准备测试数据
+		tableSchema := types.TableSchema{
+			Name: "order_items",
+			Columns: []types.ColumnDefinition{
+				{Name: "price", Type: "DECIMAL(10,2)"},
+				{Name: "quantity", Type: "INTEGER"},
+				{Name: "total", Type: "DECIMAL(10,2)", Generated: "price * quantity", GeneratedStored: true},
+			},
+		}
+
+		// 执行测试
+		err := schema.CreateTable(ctx, tableSchema)
+		assert.NoError(t, err, "CreateTable with generated column should not return error")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
 	t.Run("create table error", func(t *testing.T) {
 		// 设置期望
 		mock.ExpectExec("CREATE TABLE").
@@ -167,6 +308,72 @@ func TestSchema_CreateTable(t *testing.T) {
 	})
 }
 
+func TestSchema_CreateTableFromStruct(t *testing.T) {
+	schema, mock, cleanup := setupSchemaTest(t)
+	defer cleanup()
+
+	type Audit struct {
+		CreatedAt time.Time  `db:"created_at"`
+		DeletedAt *time.Time `db:"deleted_at"`
+	}
+	type Product struct {
+		ID       int64           `db:"id"`
+		Name     string          `db:"name" pgtype:"VARCHAR(200)"`
+		Price    float64         `db:"price" pgtype:"NUMERIC(10,2)"`
+		Stock    int32           `db:"stock"`
+		Note     sql.NullString  `db:"note"`
+		Attrs    json.RawMessage `db:"attrs"`
+		internal string
+		Audit
+	}
+
+	t.Run("pgtype overrides inferred types", func(t *testing.T) {
+		mock.ExpectExec(`^CREATE TABLE products \(` +
+			`id BIGINT PRIMARY KEY NOT NULL,` +
+			`name VARCHAR\(200\) NOT NULL,` +
+			`price NUMERIC\(10,2\) NOT NULL,` +
+			`stock INTEGER NOT NULL,` +
+			`note TEXT,` +
+			`attrs JSONB,` +
+			`created_at TIMESTAMP WITH TIME ZONE NOT NULL,` +
+			`deleted_at TIMESTAMP WITH TIME ZONE\)$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := schema.CreateTableFromStruct(context.Background(), "products", &Product{})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("default mapping without override", func(t *testing.T) {
+		tableSchema, err := tableSchemaFromStruct("products", Product{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "NUMERIC(10,2)", tableSchema.Columns[2].Type)
+
+		type plain struct {
+			Price float64 `db:"price"`
+		}
+		tableSchema, err = tableSchemaFromStruct("plain", plain{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "DOUBLE PRECISION", tableSchema.Columns[0].Type)
+	})
+
+	t.Run("custom valuer requires pgtype", func(t *testing.T) {
+		type withArray struct {
+			Tags pq.StringArray `db:"tags"`
+		}
+		_, err := tableSchemaFromStruct("items", withArray{}, nil)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "add a pgtype tag")
+
+		type taggedArray struct {
+			Tags pq.StringArray `db:"tags" pgtype:"TEXT[]"`
+		}
+		tableSchema, err := tableSchemaFromStruct("items", taggedArray{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "TEXT[]", tableSchema.Columns[0].Type)
+	})
+}
+
 // 测试AlterTable方法
 func TestSchema_AlterTable(t *testing.T) {
 	schema, mock, cleanup := setupSchemaTest(t)
@@ -276,6 +483,39 @@ func TestSchema_DropTable(t *testing.T) {
 	})
 }
 
+func TestSchema_TruncateTables(t *testing.T) {
+	schema, mock, cleanup := setupSchemaTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("combined truncate with restart identity", func(t *testing.T) {
+		before := testutil.ToFloat64(_totalOperCount.WithLabelValues("", string(deleteOper)))
+		mock.ExpectExec(`^TRUNCATE users, orders, order_items RESTART IDENTITY CASCADE$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := schema.TruncateTables(ctx, []string{"users", "orders", "order_items"}, true)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+		assert.Equal(t, before+1, testutil.ToFloat64(_totalOperCount.WithLabelValues("", string(deleteOper))),
+			"Truncate should use a fixed collection label")
+	})
+
+	t.Run("combined truncate without restart identity", func(t *testing.T) {
+		mock.ExpectExec(`^TRUNCATE users, orders CASCADE$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := schema.TruncateTables(ctx, []string{"users", "orders"}, false)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("no tables", func(t *testing.T) {
+		assert.NoError(t, schema.TruncateTables(ctx, nil, true))
+		assert.NoError(t, mock.ExpectationsWereMet(), "No statement should be executed")
+	})
+}
+
 // 测试TableExists方法
 func TestSchema_TableExists(t *testing.T) {
 	schema, mock, cleanup := setupSchemaTest(t)
@@ -328,6 +568,83 @@ func TestSchema_TableExists(t *testing.T) {
 	})
 }
 
+// 测试GetIndexes方法
+func TestSchema_GetIndexes(t *testing.T) {
+	schema, mock, cleanup := setupSchemaTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"indexname", "indexdef"}).
+		AddRow("idx_orders_active", "CREATE INDEX idx_orders_active ON public.orders USING btree (created_at) WHERE (status = 'active'::text)").
+		AddRow("idx_orders_user_created", "CREATE INDEX idx_orders_user_created ON public.orders USING btree (user_id, created_at DESC)").
+		AddRow("orders_pkey", "CREATE UNIQUE INDEX orders_pkey ON public.orders USING btree (id)")
+	mock.ExpectQuery(`SELECT\s+indexname,\s+indexdef\s+FROM pg_indexes\s+WHERE tablename = \$1`).
+		WithArgs("orders").
+		WillReturnRows(rows)
+
+	indexes, err := schema.GetIndexes(ctx, "orders")
+	require.NoError(t, err, "GetIndexes should not return error")
+	require.Len(t, indexes, 3)
+
+	assert.Equal(t, types.IndexDefinition{
+		Name:      "idx_orders_active",
+		Columns:   []string{"created_at"},
+		Method:    "btree",
+		Predicate: "status = 'active'::text",
+	}, indexes[0], "Partial index should carry its predicate")
+
+	assert.Equal(t, types.IndexDefinition{
+		Name:    "idx_orders_user_created",
+		Columns: []string{"user_id", "created_at DESC"},
+		Method:  "btree",
+	}, indexes[1], "Composite index should keep column order")
+
+	assert.True(t, indexes[2].Unique, "Primary key index should be unique")
+	assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+
+	// 查询失败
+	mock.ExpectQuery("FROM pg_indexes").
+		WithArgs("broken").
+		WillReturnError(errors.New("query error"))
+	_, err = schema.GetIndexes(ctx, "broken")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "query error")
+}
+
+// 测试GetTableStats方法
+func TestSchema_GetTableStats(t *testing.T) {
+	schema, mock, cleanup := setupSchemaTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("stats found", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"estimated_rows", "total_bytes"}).
+			AddRow(12500, 4194304)
+		mock.ExpectQuery(`SELECT GREATEST\(c\.reltuples, 0\)::BIGINT AS estimated_rows,\s+pg_total_relation_size\(c\.oid\) AS total_bytes\s+FROM pg_class c`).
+			WithArgs("users").
+			WillReturnRows(rows)
+
+		stats, err := schema.GetTableStats(ctx, "users")
+		require.NoError(t, err, "GetTableStats should not return error")
+		assert.Equal(t, int64(12500), stats.EstimatedRows)
+		assert.Equal(t, int64(4194304), stats.TotalBytes)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("table not found", func(t *testing.T) {
+		mock.ExpectQuery("FROM pg_class c").
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows([]string{"estimated_rows", "total_bytes"}))
+
+		stats, err := schema.GetTableStats(ctx, "missing")
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+		assert.Nil(t, stats)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+}
+
 // 测试GetTableSchema方法 - 因为这个方法很复杂，所以我们只测试一些基本路径
 func TestSchema_GetTableSchema(t *testing.T) {
 	schema, mock, cleanup := setupSchemaTest(t)
@@ -351,8 +668,208 @@ func TestSchema_GetTableSchema(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
-	// 注意：完整测试GetTableSchema方法需要模拟多个查询，这里省略
-	// 在实际项目中，你应该根据需要添加更多的测试用例
+	t.Run("table with composite and unique indexes", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("members").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		mock.ExpectQuery("FROM information_schema.columns").
+			WithArgs("members").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}).
+				AddRow("id", "int4", "NO", nil).
+				AddRow("tenant_id", "int4", "NO", nil).
+				AddRow("email", "varchar", "NO", nil))
+
+		mock.ExpectQuery("FROM pg_index").
+			WithArgs("members").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+
+		mock.ExpectQuery("FROM pg_indexes").
+			WithArgs("members").
+			WillReturnRows(sqlmock.NewRows([]string{"indexname", "indexdef"}).
+				AddRow("idx_members_tenant_email", "CREATE INDEX idx_members_tenant_email ON public.members USING btree (tenant_id, email)").
+				AddRow("members_email_key", "CREATE UNIQUE INDEX members_email_key ON public.members USING btree (email)"))
+
+		mock.ExpectQuery("FROM information_schema.key_column_usage").
+			WithArgs("members").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "ref_table", "ref_column", "delete_rule", "update_rule"}))
+
+		mock.ExpectQuery("FROM pg_constraint").
+			WithArgs("members").
+			WillReturnRows(sqlmock.NewRows([]string{"constraint_name", "check_clause"}))
+
+		tableSchema, err := schema.GetTableSchema(ctx, "members")
+		require.NoError(t, err)
+
+		assert.Equal(t, []types.IndexDefinition{
+			{
+				Name:    "idx_members_tenant_email",
+				Columns: []string{"tenant_id", "email"},
+				Method:  "btree",
+			},
+			{
+				Name:    "members_email_key",
+				Columns: []string{"email"},
+				Unique:  true,
+				Method:  "btree",
+			},
+		}, tableSchema.Indexes)
+
+		// 列级标记仍然保留
+		assert.True(t, tableSchema.Columns[1].Index, "tenant_id should be indexed")
+		assert.False(t, tableSchema.Columns[1].Unique, "tenant_id should not be unique")
+		assert.True(t, tableSchema.Columns[2].Unique, "email should be unique")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("NULL introspection values", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		mock.ExpectQuery("FROM information_schema.columns").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}).
+				AddRow("id", "int4", "NO", nil).
+				AddRow("user_id", "int4", "NO", nil).
+				AddRow("amount", "numeric", "NO", nil))
+
+		mock.ExpectQuery("FROM pg_index").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+
+		mock.ExpectQuery("FROM pg_indexes").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"indexname", "indexdef"}).
+				AddRow("orders_broken_idx", nil))
+
+		mock.ExpectQuery("FROM information_schema.key_column_usage").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "ref_table", "ref_column", "delete_rule", "update_rule"}).
+				AddRow("user_id", "users", "id", nil, nil))
+
+		mock.ExpectQuery("FROM pg_constraint").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"constraint_name", "check_clause"}).
+				AddRow("orders_amount_check", nil))
+
+		tableSchema, err := schema.GetTableSchema(ctx, "orders")
+		require.NoError(t, err, "NULL introspection values should not cause scan errors")
+
+		assert.Empty(t, tableSchema.Indexes, "Index without definition should be skipped")
+		require.NotNil(t, tableSchema.Columns[1].ForeignKey, "user_id should keep its foreign key")
+		assert.Equal(t, &types.ForeignKey{ReferenceTable: "users", ReferenceColumn: "id"}, tableSchema.Columns[1].ForeignKey)
+		assert.Empty(t, tableSchema.Columns[2].Check, "NULL check clause should be ignored")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("table level constraints", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("bookings").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		mock.ExpectQuery("FROM information_schema.columns").
+			WithArgs("bookings").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}).
+				AddRow("room_id", "int4", "NO", nil).
+				AddRow("start_at", "timestamptz", "NO", nil).
+				AddRow("end_at", "timestamptz", "NO", nil).
+				AddRow("guests", "int4", "NO", nil))
+
+		mock.ExpectQuery("FROM pg_index").
+			WithArgs("bookings").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+
+		mock.ExpectQuery("FROM pg_indexes").
+			WithArgs("bookings").
+			WillReturnRows(sqlmock.NewRows([]string{"indexname", "indexdef"}))
+
+		mock.ExpectQuery("FROM information_schema.key_column_usage").
+			WithArgs("bookings").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "ref_table", "ref_column", "delete_rule", "update_rule"}))
+
+		mock.ExpectQuery("FROM pg_constraint").
+			WithArgs("bookings").
+			WillReturnRows(sqlmock.NewRows([]string{"constraint_name", "constraint_type", "check_clause", "column_names"}).
+				AddRow("bookings_guests_check", "c", "CHECK ((guests > 0))", "guests").
+				AddRow("bookings_period_check", "c", "CHECK ((start_at < end_at))", "start_at,end_at").
+				AddRow("bookings_room_start_key", "u", "UNIQUE (room_id, start_at)", "room_id,start_at"))
+
+		tableSchema, err := schema.GetTableSchema(ctx, "bookings")
+		require.NoError(t, err)
+
+		assert.Equal(t, "CHECK ((guests > 0))", tableSchema.Columns[3].Check, "Single column check stays on the column")
+		assert.Empty(t, tableSchema.Columns[1].Check, "Multi-column check should not be forced onto a column")
+		assert.Empty(t, tableSchema.Columns[2].Check, "Multi-column check should not be forced onto a column")
+		assert.Equal(t, []types.TableConstraint{
+			{
+				Name:       "bookings_period_check",
+				Type:       "CHECK",
+				Columns:    []string{"start_at", "end_at"},
+				Definition: "CHECK ((start_at < end_at))",
+			},
+			{
+				Name:       "bookings_room_start_key",
+				Type:       "UNIQUE",
+				Columns:    []string{"room_id", "start_at"},
+				Definition: "UNIQUE (room_id, start_at)",
+			},
+		}, tableSchema.Constraints)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("enum columns", func(t *testing.T) {
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		mock.ExpectQuery("FROM information_schema.columns").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default", "type_category", "udt_schema"}).
+				AddRow("id", "int4", "NO", nil, "integer", "pg_catalog").
+				AddRow("status", "order_status", "NO", "'pending'::order_status", "USER-DEFINED", "public").
+				AddRow("prev_status", "order_status", "YES", nil, "USER-DEFINED", "public").
+				AddRow("location", "geometry", "YES", nil, "USER-DEFINED", "public"))
+
+		// 同一枚举类型只查询一次
+		mock.ExpectQuery(`FROM pg_enum e`).
+			WithArgs("order_status", "public").
+			WillReturnRows(sqlmock.NewRows([]string{"enumlabel"}).
+				AddRow("pending").AddRow("paid").AddRow("shipped"))
+		// 非枚举的自定义类型没有取值
+		mock.ExpectQuery(`FROM pg_enum e`).
+			WithArgs("geometry", "public").
+			WillReturnRows(sqlmock.NewRows([]string{"enumlabel"}))
+
+		mock.ExpectQuery("FROM pg_index").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+
+		mock.ExpectQuery("FROM pg_indexes").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"indexname", "indexdef"}))
+
+		mock.ExpectQuery("FROM information_schema.key_column_usage").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "ref_table", "ref_column", "delete_rule", "update_rule"}))
+
+		mock.ExpectQuery("FROM pg_constraint").
+			WithArgs("orders").
+			WillReturnRows(sqlmock.NewRows([]string{"constraint_name", "check_clause"}))
+
+		tableSchema, err := schema.GetTableSchema(ctx, "orders")
+		require.NoError(t, err)
+		require.Len(t, tableSchema.Columns, 4)
+
+		assert.Empty(t, tableSchema.Columns[0].EnumValues)
+		assert.Equal(t, "order_status", tableSchema.Columns[1].Type)
+		assert.Equal(t, []string{"pending", "paid", "shipped"}, tableSchema.Columns[1].EnumValues)
+		assert.Equal(t, "order_status", tableSchema.Columns[2].Type)
+		assert.Equal(t, []string{"pending", "paid", "shipped"}, tableSchema.Columns[2].EnumValues)
+		assert.Equal(t, "GEOMETRY", tableSchema.Columns[3].Type, "Non-enum user-defined types keep the default mapping")
+		assert.Empty(t, tableSchema.Columns[3].EnumValues)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
 }
 
 // 测试一些辅助函数
@@ -398,6 +915,50 @@ func TestSchema_HelperFunctions(t *testing.T) {
 		}
 	})
 
+	t.Run("parseIndexDef", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			def      string
+			expected types.IndexDefinition
+		}{
+			{
+				name: "composite btree",
+				def:  "CREATE INDEX idx_a_b ON public.users USING btree (a, b DESC)",
+				expected: types.IndexDefinition{
+					Name:    "idx_a_b",
+					Columns: []string{"a", "b DESC"},
+					Method:  "btree",
+				},
+			},
+			{
+				name: "unique expression",
+				def:  "CREATE UNIQUE INDEX idx_a_b ON public.users USING btree (lower((email)::text))",
+				expected: types.IndexDefinition{
+					Name:    "idx_a_b",
+					Columns: []string{"lower((email)::text)"},
+					Unique:  true,
+					Method:  "btree",
+				},
+			},
+			{
+				name: "partial gin",
+				def:  "CREATE INDEX idx_a_b ON public.users USING gin (tags) WHERE (deleted_at IS NULL)",
+				expected: types.IndexDefinition{
+					Name:      "idx_a_b",
+					Columns:   []string{"tags"},
+					Method:    "gin",
+					Predicate: "deleted_at IS NULL",
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.expected, parseIndexDef("idx_a_b", tt.def))
+			})
+		}
+	})
+
 	t.Run("parseColumnsFromCheck", func(t *testing.T) {
 		tests := []struct {
 			name     string
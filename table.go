@@ -2,12 +2,19 @@ package postgresql_helper
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 
 	"github.com/songzhibin97/postgresql_helper/types"
 )
@@ -16,37 +23,190 @@ var _ types.Table = (*Table)(nil)
 
 type Table struct {
 	*DB
-	name string
+	name     string
+	idColumn string // 默认ID列名，为空时使用 "id"
+
+	softDeleteColumn string // 软删除标记列，非空时 Query 默认只返回该列为 NULL 的记录
+
+	omitZeroID bool // Insert / InsertAndGetID 是否从插入列中去掉零值的ID列
+
+	validateReturning bool // 执行前是否校验 RETURNING 列存在于表中
+}
+
+// WithIDColumn 返回使用指定默认ID列的表副本
+// InsertAndGetID 未显式指定列名、DeleteByIDs 的 idColumn 为空时使用该列
+func (t Table) WithIDColumn(name string) *Table {
+	t.idColumn = name
+	return &t
+}
+
+// WithOmitZeroID 返回插入时忽略零值ID列的表副本
+// 启用后 Insert、InsertStrict 与 InsertAndGetID 在ID列（见 WithIDColumn）的值为 nil 或零值时
+// 将其从插入列中去掉，由序列生成ID，避免数据中误带 id: 0 导致主键冲突
+func (t Table) WithOmitZeroID() *Table {
+	t.omitZeroID = true
+	return &t
+}
+
+// stripZeroID 启用 omitZeroID 时从插入列中去掉值为零的 idColumn
+func (t Table) stripZeroID(fields []string, values []interface{}, idColumn string) ([]string, []interface{}) {
+	if !t.omitZeroID {
+		return fields, values
+	}
+	for i, field := range fields {
+		if field != idColumn {
+			continue
+		}
+		if values[i] != nil && !reflect.ValueOf(values[i]).IsZero() {
+			return fields, values
+		}
+		keptFields := append(append([]string{}, fields[:i]...), fields[i+1:]...)
+		keptValues := append(append([]interface{}{}, values[:i]...), values[i+1:]...)
+		return keptFields, keptValues
+	}
+	return fields, values
+}
+
+// WithReturningValidation 返回在执行前校验 RETURNING 列的表副本
+// 启用后 InsertAndGetMultipleColumns、InsertAndGetTypedColumns 与 InsertAndGetObject 会先对照表的列清单
+// （首次使用时查询并缓存）检查返回列，列名拼写错误时返回指明该列的 ErrInvalidStructure；
+// 默认关闭，以避免额外的查询。本包的 DDL 操作（Table 的列变更、Schema 的建表 / 改表 / 删表以及迁移）会使缓存失效，
+// 其他途径新增的列在首次未命中时重新加载列清单后识别
+func (t Table) WithReturningValidation() *Table {
+	t.validateReturning = true
+	return &t
+}
+
+// tableColumnsCache 缓存各表的列名集合，键为 tableColumnsKey
+var tableColumnsCache sync.Map
+
+type tableColumnsKey struct {
+	db    *sqlx.DB
+	table string
+}
+
+// checkReturnColumns 启用 validateReturning 时校验返回列是否都存在于表中，* 与表达式不做检查
+func (t Table) checkReturnColumns(ctx context.Context, columns []string) error {
+	if !t.validateReturning {
+		return nil
+	}
+
+	key := tableColumnsKey{db: t.db, table: t.name}
+	cached, fromCache := tableColumnsCache.Load(key)
+	if !fromCache {
+		set, err := t.loadColumnSet(ctx, key)
+		if err != nil {
+			return err
+		}
+		cached = set
+	}
+
+	set := cached.(map[string]struct{})
+	for _, column := range columns {
+		if column == "*" || !isColumnIdentifier(column) {
+			continue
+		}
+		if _, ok := set[column]; ok {
+			continue
+		}
+		if fromCache {
+			// 缓存可能早于其他途径的 DDL，重新加载一次后再判定
+			reloaded, err := t.loadColumnSet(ctx, key)
+			if err != nil {
+				return err
+			}
+			set, fromCache = reloaded, false
+			if _, ok := set[column]; ok {
+				continue
+			}
+		}
+		return t.wrapError(fmt.Errorf("%w: unknown return column %s for table %s", types.ErrInvalidStructure, column, t.name), "validate return columns")
+	}
+	return nil
+}
+
+// loadColumnSet 查询表的列名集合并写入缓存
+func (t Table) loadColumnSet(ctx context.Context, key tableColumnsKey) (map[string]struct{}, error) {
+	cols, err := Schema{DB: t.DB}.getColumns(ctx, t.name)
+	if err != nil {
+		return nil, t.wrapError(err, "load table columns")
+	}
+	if len(cols) == 0 {
+		return nil, t.wrapError(fmt.Errorf("%w: no columns found for table %s", types.ErrInvalidStructure, t.name), "validate return columns")
+	}
+	set := make(map[string]struct{}, len(cols))
+	for _, col := range cols {
+		set[col.Name] = struct{}{}
+	}
+	tableColumnsCache.Store(key, set)
+	return set, nil
+}
+
+// invalidateColumns 清除表的列缓存
+func (t Table) invalidateColumns() {
+	invalidateTableColumns(t.db, t.name)
+}
+
+// invalidateTableColumns 清除指定连接池下某张表的列缓存
+func invalidateTableColumns(db *sqlx.DB, table string) {
+	tableColumnsCache.Delete(tableColumnsKey{db: db, table: table})
+}
+
+// invalidateAllTableColumns 清除指定连接池下所有表的列缓存，用于无法确定受影响表的 DDL（如迁移）
+func invalidateAllTableColumns(db *sqlx.DB) {
+	tableColumnsCache.Range(func(k, _ interface{}) bool {
+		if k.(tableColumnsKey).db == db {
+			tableColumnsCache.Delete(k)
+		}
+		return true
+	})
+}
+
+// SetSoftDeleteColumn 返回启用软删除过滤的表副本
+// 此后 Query() 默认追加 col IS NULL 条件，可用 WithDeleted / OnlyDeleted 调整
+func (t Table) SetSoftDeleteColumn(col string) *Table {
+	t.softDeleteColumn = col
+	return &t
+}
+
+// defaultIDColumn 返回表的默认ID列名
+func (t Table) defaultIDColumn() string {
+	if t.idColumn != "" {
+		return t.idColumn
+	}
+	return "id"
 }
 
 func (t Table) Insert(ctx context.Context, data interface{}) error {
+	return t.insert(ctx, data, false)
+}
+
+// InsertStrict 与 Insert 相同，但在影响行数为 0 时返回 ErrNoRowsInserted
+// 用于发现被规则（RULE）或触发器静默吞掉的插入
+func (t Table) InsertStrict(ctx context.Context, data interface{}) error {
+	return t.insert(ctx, data, true)
+}
+
+func (t Table) insert(ctx context.Context, data interface{}, strict bool) error {
 	return t.withMetrics(ctx, t.name, insertOper, func(ctx context.Context) error {
 		// 解析数据结构获取字段和值
-		fields, values, err := extractFieldsAndValues(data)
+		fields, values, err := extractFieldsAndValues(data, t.fieldMapper)
 		if err != nil {
 			return t.wrapError(err, "extract fields for insert")
 		}
+		fields, values = t.stripZeroID(fields, values, t.defaultIDColumn())
 
 		if len(fields) == 0 {
-			return t.wrapError(types.ErrInvalidStructure, "no fields to insert")
+			return t.wrapError(noUsableFieldsError(data), "extract fields for insert")
 		}
 
 		// 构建 INSERT 语句
 		columns := strings.Join(fields, ", ")
-		placeholders := make([]string, len(fields))
-		for i := range placeholders {
-			placeholders[i] = ":" + fields[i]
-		}
+		placeholders, namedArgs := namedInsertValues(fields, values)
 
 		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
 			t.name, columns, strings.Join(placeholders, ", "))
 
-		// 构建字段-值映射供 sqlx.Named 使用
-		namedArgs := make(map[string]interface{})
-		for i, field := range fields {
-			namedArgs[field] = values[i]
-		}
-
 		// 使用 Named 参数执行
 		query, args, err := sqlx.Named(query, namedArgs)
 		if err != nil {
@@ -56,8 +216,20 @@ func (t Table) Insert(ctx context.Context, data interface{}) error {
 		// 转换成数据库驱动支持的格式
 		query = t.db.Rebind(query)
 
-		_, err = t.db.ExecContext(ctx, query, args...)
-		return t.wrapError(err, "insert into "+t.name)
+		result, err := t.db.ExecContext(ctx, query, args...)
+		if err != nil || !strict {
+			return t.wrapError(err, "insert into "+t.name)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return t.wrapError(err, "get rows affected")
+		}
+		recordRowsAffected(ctx, affected)
+		if affected == 0 {
+			return fmt.Errorf("%w: insert into %s affected 0 rows", ErrNoRowsInserted, t.name)
+		}
+		return nil
 	})
 }
 
@@ -67,7 +239,7 @@ func (t Table) Insert(ctx context.Context, data interface{}) error {
 //
 //	ctx: 上下文，可用于取消操作或传递事务
 //	data: 要插入的数据，可以是带有db标签的结构体或字段名到值的映射
-//	idColumnName: 要返回的ID列名，默认为"id"
+//	idColumnName: 要返回的ID列名，默认为表的默认ID列（见 WithIDColumn，未设置时为"id"）
 //
 // 返回:
 //
@@ -77,39 +249,31 @@ func (t Table) InsertAndGetID(ctx context.Context, data interface{}, idColumnNam
 	var id int64
 
 	// 确定ID列名
-	idColumn := "id"
+	idColumn := t.defaultIDColumn()
 	if len(idColumnName) > 0 && idColumnName[0] != "" {
 		idColumn = idColumnName[0]
 	}
 
 	err := t.withMetrics(ctx, t.name, insertOper, func(ctx context.Context) error {
 		// 解析数据结构获取字段和值
-		fields, values, err := extractFieldsAndValues(data)
+		fields, values, err := extractFieldsAndValues(data, t.fieldMapper)
 		if err != nil {
 			return t.wrapError(err, "extract fields for insert")
 		}
+		fields, values = t.stripZeroID(fields, values, idColumn)
 
 		if len(fields) == 0 {
-			return t.wrapError(types.ErrInvalidStructure, "no fields to insert")
+			return t.wrapError(noUsableFieldsError(data), "extract fields for insert")
 		}
 
 		// 构建INSERT语句
 		columns := strings.Join(fields, ", ")
-		placeholders := make([]string, len(fields))
-		for i := range placeholders {
-			placeholders[i] = ":" + fields[i]
-		}
+		placeholders, namedArgs := namedInsertValues(fields, values)
 
 		// 添加RETURNING子句以获取生成的ID
 		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
 			t.name, columns, strings.Join(placeholders, ", "), idColumn)
 
-		// 构建字段-值映射供sqlx.Named使用
-		namedArgs := make(map[string]interface{})
-		for i, field := range fields {
-			namedArgs[field] = values[i]
-		}
-
 		// 使用Named参数准备语句
 		query, args, err := sqlx.Named(query, namedArgs)
 		if err != nil {
@@ -122,6 +286,11 @@ func (t Table) InsertAndGetID(ctx context.Context, data interface{}, idColumnNam
 		// 执行查询并获取返回的ID
 		row := t.db.QueryRowxContext(ctx, query, args...)
 		if err := row.Scan(&id); err != nil {
+			// BEFORE 触发器返回 NULL 时插入被跳过，RETURNING 没有结果行
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: insert into %s produced no returning row (a BEFORE trigger may have skipped it)",
+					ErrNoRowsInserted, t.name)
+			}
 			return t.wrapError(err, "retrieve generated id")
 		}
 
@@ -152,32 +321,27 @@ func (t Table) InsertAndGetMultipleColumns(ctx context.Context, data interface{}
 
 	err := t.withMetrics(ctx, t.name, insertOper, func(ctx context.Context) error {
 		// 解析数据结构获取字段和值
-		fields, values, err := extractFieldsAndValues(data)
+		fields, values, err := extractFieldsAndValues(data, t.fieldMapper)
 		if err != nil {
 			return t.wrapError(err, "extract fields for insert")
 		}
 
 		if len(fields) == 0 {
-			return t.wrapError(types.ErrInvalidStructure, "no fields to insert")
+			return t.wrapError(noUsableFieldsError(data), "extract fields for insert")
 		}
 
 		// 构建INSERT语句
 		columns := strings.Join(fields, ", ")
-		placeholders := make([]string, len(fields))
-		for i := range placeholders {
-			placeholders[i] = ":" + fields[i]
+		placeholders, namedArgs := namedInsertValues(fields, values)
+
+		if err := t.checkReturnColumns(ctx, returnColumns); err != nil {
+			return err
 		}
 
 		// 添加RETURNING子句以获取多个列
 		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
 			t.name, columns, strings.Join(placeholders, ", "), strings.Join(returnColumns, ", "))
 
-		// 构建字段-值映射供sqlx.Named使用
-		namedArgs := make(map[string]interface{})
-		for i, field := range fields {
-			namedArgs[field] = values[i]
-		}
-
 		// 使用Named参数准备语句
 		query, args, err := sqlx.Named(query, namedArgs)
 		if err != nil {
@@ -190,6 +354,12 @@ func (t Table) InsertAndGetMultipleColumns(ctx context.Context, data interface{}
 		// 执行查询并扫描返回值
 		row := t.db.QueryRowxContext(ctx, query, args...)
 
+		// 列类型用于识别数组列，必须在 Scan 之前获取
+		columnTypes, err := row.ColumnTypes()
+		if err != nil {
+			return t.wrapError(err, "retrieve generated values")
+		}
+
 		// 准备接收返回值的容器
 		dest := make([]interface{}, len(returnColumns))
 		destPtrs := make([]interface{}, len(returnColumns))
@@ -207,6 +377,13 @@ func (t Table) InsertAndGetMultipleColumns(ctx context.Context, data interface{}
 			// 处理扫描的值，可能是不同类型
 			val := dest[i]
 			if bytesVal, ok := val.([]byte); ok {
+				// 数组列解码为对应的Go切片
+				if i < len(columnTypes) {
+					if decoded, ok := decodeArrayValue(columnTypes[i].DatabaseTypeName(), bytesVal); ok {
+						result[col] = decoded
+						continue
+					}
+				}
 				// 将[]byte转换为字符串，常见于文本字段
 				result[col] = string(bytesVal)
 			} else {
@@ -220,6 +397,94 @@ func (t Table) InsertAndGetMultipleColumns(ctx context.Context, data interface{}
 	return result, err
 }
 
+// InsertAndGetTypedColumns 插入数据，并将 RETURNING 的列直接扫描到 dest 中对应的指针
+// dest 的键为列名，值为接收该列的非 nil 指针（如 &id、&createdAt），由驱动按目标类型转换，
+// 避免 InsertAndGetMultipleColumns 返回的驱动默认类型需要再做断言
+func (t Table) InsertAndGetTypedColumns(ctx context.Context, data interface{}, dest map[string]interface{}) error {
+	if len(dest) == 0 {
+		return t.wrapError(fmt.Errorf("%w: no return columns specified", types.ErrInvalidStructure), "insert and get typed columns")
+	}
+
+	// 按列名排序，保证生成的SQL稳定
+	returnColumns := make([]string, 0, len(dest))
+	for col, ptr := range dest {
+		v := reflect.ValueOf(ptr)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return t.wrapError(fmt.Errorf("%w: destination for column %s must be a non-nil pointer", types.ErrInvalidStructure, col), "insert and get typed columns")
+		}
+		returnColumns = append(returnColumns, col)
+	}
+	sort.Strings(returnColumns)
+
+	return t.withMetrics(ctx, t.name, insertOper, func(ctx context.Context) error {
+		fields, values, err := extractFieldsAndValues(data, t.fieldMapper)
+		if err != nil {
+			return t.wrapError(err, "extract fields for insert")
+		}
+
+		if len(fields) == 0 {
+			return t.wrapError(noUsableFieldsError(data), "extract fields for insert")
+		}
+
+		if err := t.checkReturnColumns(ctx, returnColumns); err != nil {
+			return err
+		}
+
+		placeholders, namedArgs := namedInsertValues(fields, values)
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
+			t.name, strings.Join(fields, ", "), strings.Join(placeholders, ", "), strings.Join(returnColumns, ", "))
+
+		query, args, err := sqlx.Named(query, namedArgs)
+		if err != nil {
+			return t.wrapError(err, "prepare insert statement")
+		}
+		query = t.db.Rebind(query)
+
+		destPtrs := make([]interface{}, len(returnColumns))
+		for i, col := range returnColumns {
+			destPtrs[i] = dest[col]
+		}
+
+		err = t.db.QueryRowxContext(ctx, query, args...).Scan(destPtrs...)
+		return t.wrapError(err, "retrieve generated values")
+	})
+}
+
+// decodeArrayValue 按数据库类型名（如 _TEXT、_INT8）将数组列的原始值解码为Go切片
+// 文本类数组解码为 []string，整数数组为 []int64，浮点数组为 []float64，布尔数组为 []bool；
+// 其他类型返回 false，由调用方按原样处理
+func decodeArrayValue(typeName string, raw []byte) (interface{}, bool) {
+	var scanner sql.Scanner
+	switch strings.ToUpper(typeName) {
+	case "_TEXT", "_VARCHAR", "_BPCHAR", "_UUID", "_CITEXT":
+		scanner = &pq.StringArray{}
+	case "_INT2", "_INT4", "_INT8":
+		scanner = &pq.Int64Array{}
+	case "_FLOAT4", "_FLOAT8":
+		scanner = &pq.Float64Array{}
+	case "_BOOL":
+		scanner = &pq.BoolArray{}
+	default:
+		return nil, false
+	}
+
+	if err := scanner.Scan(raw); err != nil {
+		return nil, false
+	}
+
+	switch v := scanner.(type) {
+	case *pq.StringArray:
+		return []string(*v), true
+	case *pq.Int64Array:
+		return []int64(*v), true
+	case *pq.Float64Array:
+		return []float64(*v), true
+	case *pq.BoolArray:
+		return []bool(*v), true
+	}
+	return nil, false
+}
+
 // InsertAndGetObject 插入数据并将返回的值填充到提供的对象中
 // 对于希望直接将返回数据填充到结构体的场景很有用
 // 参数:
@@ -240,21 +505,18 @@ func (t Table) InsertAndGetObject(ctx context.Context, data interface{}, dest in
 		}
 
 		// 解析数据结构获取字段和值
-		fields, values, err := extractFieldsAndValues(data)
+		fields, values, err := extractFieldsAndValues(data, t.fieldMapper)
 		if err != nil {
 			return t.wrapError(err, "extract fields for insert")
 		}
 
 		if len(fields) == 0 {
-			return t.wrapError(types.ErrInvalidStructure, "no fields to insert")
+			return t.wrapError(noUsableFieldsError(data), "extract fields for insert")
 		}
 
 		// 构建INSERT语句
 		columns := strings.Join(fields, ", ")
-		placeholders := make([]string, len(fields))
-		for i := range placeholders {
-			placeholders[i] = ":" + fields[i]
-		}
+		placeholders, namedArgs := namedInsertValues(fields, values)
 
 		// 确定要返回的列
 		destElem := destValue.Elem()
@@ -262,12 +524,11 @@ func (t Table) InsertAndGetObject(ctx context.Context, data interface{}, dest in
 
 		if destElem.Kind() == reflect.Struct {
 			// 如果目标是结构体，从结构体获取db标签作为返回列
+			// 配置了字段映射时，未标记的导出字段按映射后的列名一并返回
 			destType := destElem.Type()
 			for i := 0; i < destType.NumField(); i++ {
-				field := destType.Field(i)
-				tag := field.Tag.Get("db")
-				if tag != "" && tag != "-" {
-					returnColumns = append(returnColumns, tag)
+				if column, _, ok := fieldColumn(destType.Field(i), t.fieldMapper); ok {
+					returnColumns = append(returnColumns, column)
 				}
 			}
 		} else {
@@ -275,16 +536,14 @@ func (t Table) InsertAndGetObject(ctx context.Context, data interface{}, dest in
 			returnColumns = []string{"*"}
 		}
 
+		if err := t.checkReturnColumns(ctx, returnColumns); err != nil {
+			return err
+		}
+
 		// 添加RETURNING子句
 		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s",
 			t.name, columns, strings.Join(placeholders, ", "), strings.Join(returnColumns, ", "))
 
-		// 构建字段-值映射供sqlx.Named使用
-		namedArgs := make(map[string]interface{})
-		for i, field := range fields {
-			namedArgs[field] = values[i]
-		}
-
 		// 使用Named参数准备语句
 		query, args, err := sqlx.Named(query, namedArgs)
 		if err != nil {
@@ -304,8 +563,123 @@ func (t Table) InsertAndGetObject(ctx context.Context, data interface{}, dest in
 	})
 }
 
+// InsertOrGet 插入记录，若与 conflictKey 冲突则返回已存在的记录，结果扫描到 dest
+// 冲突时执行 DO UPDATE SET <冲突列> = <表>.<冲突列> 的空更新，使 RETURNING * 在两种情况下都返回行
+// （DO NOTHING 在冲突时不返回任何行）
+func (t Table) InsertOrGet(ctx context.Context, conflictKey []string, data interface{}, dest interface{}) error {
+	return t.withMetrics(ctx, t.name, insertOper, func(ctx context.Context) error {
+		destValue := reflect.ValueOf(dest)
+		if destValue.Kind() != reflect.Ptr || destValue.IsNil() {
+			return t.wrapError(fmt.Errorf("%w: destination must be a non-nil pointer", types.ErrInvalidStructure), "insert or get")
+		}
+		if len(conflictKey) == 0 {
+			return t.wrapError(fmt.Errorf("%w: conflict key is required", types.ErrInvalidStructure), "insert or get")
+		}
+
+		fields, values, err := extractFieldsAndValues(data, t.fieldMapper)
+		if err != nil {
+			return t.wrapError(err, "extract fields for insert")
+		}
+
+		if len(fields) == 0 {
+			return t.wrapError(noUsableFieldsError(data), "extract fields for insert")
+		}
+
+		placeholders, namedArgs := namedInsertValues(fields, values)
+
+		// 空更新：将第一个冲突列赋值为自身，不修改数据但让冲突行出现在 RETURNING 中
+		noop := fmt.Sprintf("%s = %s.%s", conflictKey[0], t.name, conflictKey[0])
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s RETURNING *",
+			t.name, strings.Join(fields, ", "), strings.Join(placeholders, ", "),
+			strings.Join(conflictKey, ", "), noop)
+
+		query, args, err := sqlx.Named(query, namedArgs)
+		if err != nil {
+			return t.wrapError(err, "prepare insert statement")
+		}
+		query = t.db.Rebind(query)
+
+		row := t.db.QueryRowxContext(ctx, query, args...)
+		if err := row.StructScan(dest); err != nil {
+			return t.wrapError(err, "scan result into destination object")
+		}
+
+		return nil
+	})
+}
+
+// InsertBatchReturning 以单条多行 INSERT 插入多条记录，并将 RETURNING * 的结果扫描到 dest
+// dest 必须是切片指针；PostgreSQL 对单条多行 VALUES 插入按 VALUES 顺序返回行，
+// 因此 dest 中第 i 个元素对应 data[i]。所有记录必须包含相同的列
+func (t Table) InsertBatchReturning(ctx context.Context, data []interface{}, dest interface{}) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() || destValue.Elem().Kind() != reflect.Slice {
+		return t.wrapError(fmt.Errorf("%w: destination must be a pointer to slice", types.ErrInvalidStructure), "insert batch")
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	return t.withMetrics(ctx, t.name, insertOper, func(ctx context.Context) error {
+		fields, _, err := extractFieldsAndValues(data[0], t.fieldMapper)
+		if err != nil {
+			return t.wrapError(err, "extract fields for insert batch")
+		}
+		if len(fields) == 0 {
+			return t.wrapError(noUsableFieldsError(data[0]), "extract fields for insert batch")
+		}
+
+		fieldIndex := make(map[string]int, len(fields))
+		for i, field := range fields {
+			fieldIndex[field] = i
+		}
+
+		rows := make([]string, len(data))
+		args := make([]interface{}, 0, len(data)*len(fields))
+		for i, item := range data {
+			itemFields, itemValues, err := extractFieldsAndValues(item, t.fieldMapper)
+			if err != nil {
+				return t.wrapError(err, "extract fields for insert batch")
+			}
+			if len(itemFields) != len(fields) {
+				return t.wrapError(fmt.Errorf("%w: record %d has different columns than the first record",
+					types.ErrInvalidStructure, i), "insert batch")
+			}
+
+			// 按第一条记录的列顺序排列值（map 的键顺序不固定）
+			ordered := make([]interface{}, len(fields))
+			for j, field := range itemFields {
+				idx, ok := fieldIndex[field]
+				if !ok {
+					return t.wrapError(fmt.Errorf("%w: record %d has unexpected column %s",
+						types.ErrInvalidStructure, i, field), "insert batch")
+				}
+				ordered[idx] = itemValues[j]
+			}
+
+			placeholders := make([]string, len(fields))
+			for j, value := range ordered {
+				if expr, ok := value.(sqlExpr); ok {
+					placeholders[j] = string(expr)
+					continue
+				}
+				args = append(args, value)
+				placeholders[j] = fmt.Sprintf("$%d", len(args))
+			}
+			rows[i] = "(" + strings.Join(placeholders, ", ") + ")"
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s RETURNING *",
+			t.name, strings.Join(fields, ", "), strings.Join(rows, ", "))
+
+		err = t.db.SelectContext(ctx, dest, query, args...)
+		return t.wrapError(err, "insert batch into "+t.name)
+	})
+}
+
 // extractFieldsAndValues 从任意结构体或映射中提取字段名和值
-func extractFieldsAndValues(data interface{}) ([]string, []interface{}, error) {
+// mapper 不为空时，未标记 db 标签的导出字段按 mapper 转换后的名称作为列名
+func extractFieldsAndValues(data interface{}, mapper func(string) string) ([]string, []interface{}, error) {
 	val := reflect.ValueOf(data)
 	if val.Kind() == reflect.Ptr {
 		val = val.Elem()
@@ -313,7 +687,7 @@ func extractFieldsAndValues(data interface{}) ([]string, []interface{}, error) {
 
 	switch val.Kind() {
 	case reflect.Struct:
-		return extractFromStruct(val)
+		return extractFromStruct(val, mapper)
 	case reflect.Map:
 		return extractFromMap(val)
 	default:
@@ -323,7 +697,7 @@ func extractFieldsAndValues(data interface{}) ([]string, []interface{}, error) {
 }
 
 // 从结构体提取字段和值
-func extractFromStruct(val reflect.Value) ([]string, []interface{}, error) {
+func extractFromStruct(val reflect.Value, mapper func(string) string) ([]string, []interface{}, error) {
 	t := val.Type()
 	var fields []string
 	var values []interface{}
@@ -331,15 +705,15 @@ func extractFromStruct(val reflect.Value) ([]string, []interface{}, error) {
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 
-		// 获取 db 标签
-		dbTag := field.Tag.Get("db")
-		if dbTag == "" || dbTag == "-" {
+		// 获取列名（db 标签或 mapper 映射）
+		dbTag, opts, ok := fieldColumn(field, mapper)
+		if !ok {
 			continue // 跳过未标记或明确排除的字段
 		}
 
-		// 处理嵌入式结构体
-		if field.Anonymous && field.Type.Kind() == reflect.Struct {
-			embeddedFields, embeddedValues, err := extractFromStruct(val.Field(i))
+		// 处理嵌入式结构体（实现了 driver.Valuer 的嵌入类型作为单列整体绑定）
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && !isValuerType(field.Type) {
+			embeddedFields, embeddedValues, err := extractFromStruct(val.Field(i), mapper)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -348,8 +722,25 @@ func extractFromStruct(val reflect.Value) ([]string, []interface{}, error) {
 			continue
 		}
 
+		// 只读列由数据库生成，不能出现在INSERT列清单中（仍可通过RETURNING读取）
+		if opts.readonly {
+			continue
+		}
+
+		// omitempty 列为零值时不出现在列清单中（插入时使用数据库默认值，更新时保持原值）
+		if opts.omitempty && val.Field(i).IsZero() {
+			continue
+		}
+
+		// now 列未赋值时使用数据库时间
+		if opts.now && val.Field(i).IsZero() {
+			fields = append(fields, dbTag)
+			values = append(values, sqlExpr("NOW()"))
+			continue
+		}
+
 		// 常规字段
-		fieldValue := val.Field(i).Interface()
+		fieldValue := fieldArgValue(val.Field(i))
 
 		// 特殊处理零值（可选）
 		if isZeroValue(val.Field(i)) {
@@ -365,6 +756,86 @@ func extractFromStruct(val reflect.Value) ([]string, []interface{}, error) {
 	return fields, values, nil
 }
 
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// isValuerType 判断类型（或其指针）是否实现 driver.Valuer
+func isValuerType(t reflect.Type) bool {
+	return t.Implements(valuerType) || reflect.PtrTo(t).Implements(valuerType)
+}
+
+// fieldArgValue 返回字段作为绑定参数的值
+// 指针接收者实现 driver.Valuer 的类型需要以指针传入，否则驱动无法识别而报不支持的类型
+func fieldArgValue(v reflect.Value) interface{} {
+	if v.Kind() != reflect.Ptr && !v.Type().Implements(valuerType) && reflect.PtrTo(v.Type()).Implements(valuerType) {
+		if v.CanAddr() {
+			return v.Addr().Interface()
+		}
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		return ptr.Interface()
+	}
+	return v.Interface()
+}
+
+// dbTagOptions db 标签中列名之后的选项
+type dbTagOptions struct {
+	readonly  bool // 只读列（readonly/generated，如自增主键、生成列），插入时跳过
+	now       bool // 零值替换为 NOW()
+	omitempty bool // 零值不写入
+}
+
+// sqlExpr 直接写入SQL的值表达式（如 NOW()），不作为绑定参数
+type sqlExpr string
+
+// namedInsertValues 构建 INSERT 的 VALUES 占位符及 sqlx.Named 使用的参数映射
+// sqlExpr 类型的值原样写入SQL，不进入参数映射
+func namedInsertValues(fields []string, values []interface{}) ([]string, map[string]interface{}) {
+	placeholders := make([]string, len(fields))
+	namedArgs := make(map[string]interface{}, len(fields))
+	for i, field := range fields {
+		if expr, ok := values[i].(sqlExpr); ok {
+			placeholders[i] = string(expr)
+			continue
+		}
+		placeholders[i] = ":" + field
+		namedArgs[field] = values[i]
+	}
+	return placeholders, namedArgs
+}
+
+// parseDBTag 解析 db 标签，例如 `db:"id,readonly"`、`db:"total,generated"`、`db:"created_at,now"`、`db:"name,omitempty"`
+func parseDBTag(tag string) (string, dbTagOptions) {
+	var opts dbTagOptions
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		switch strings.TrimSpace(opt) {
+		case "readonly", "generated":
+			opts.readonly = true
+		case "now":
+			opts.now = true
+		case "omitempty":
+			opts.omitempty = true
+		}
+	}
+	return parts[0], opts
+}
+
+// fieldColumn 返回结构体字段对应的列名
+// 优先使用 db 标签；未标记时若配置了 mapper，则对导出字段使用 mapper(字段名)
+func fieldColumn(field reflect.StructField, mapper func(string) string) (string, dbTagOptions, bool) {
+	name, opts := parseDBTag(field.Tag.Get("db"))
+	if name == "-" {
+		return "", opts, false
+	}
+	if name == "" {
+		if mapper == nil || field.PkgPath != "" {
+			return "", opts, false
+		}
+		name = mapper(field.Name)
+	}
+	return name, opts, true
+}
+
 // 从 map 提取字段和值
 func extractFromMap(val reflect.Value) ([]string, []interface{}, error) {
 	keys := val.MapKeys()
@@ -377,6 +848,9 @@ func extractFromMap(val reflect.Value) ([]string, []interface{}, error) {
 		return nil, nil, fmt.Errorf("%w: map keys must be strings", types.ErrInvalidStructure)
 	}
 
+	// 按键名排序，保证同一 map 生成的 SQL 与参数顺序稳定
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
 	var fields []string
 	var values []interface{}
 
@@ -441,49 +915,391 @@ func (t Table) Update(ctx context.Context, whereClause string, args map[string]i
 			return t.wrapError(err, "update "+t.name)
 		}
 		total, err = result.RowsAffected()
+		recordRowsAffected(ctx, total)
 		return t.wrapError(err, "get rows affected")
 	})
 	return total, err
 }
 
-func (t Table) Delete(ctx context.Context, whereClause string, args map[string]interface{}) (int64, error) {
+// UpdateStrict 与 Update 相同，但没有记录匹配（影响行数为 0）时返回 ErrRecordNotFound
+func (t Table) UpdateStrict(ctx context.Context, whereClause string, args map[string]interface{}, data interface{}) (int64, error) {
+	affected, err := t.Update(ctx, whereClause, args, data)
+	if err == nil && affected == 0 {
+		err = fmt.Errorf("%w: update %s", ErrRecordNotFound, t.name)
+	}
+	return affected, err
+}
+
+// UpdateFrom 执行 UPDATE 表 SET ... FROM fromClause WHERE whereClause，按其他表的数据更新当前表
+// setData 的值作为绑定参数，需要引用 FROM 中的列时使用 Raw，例如 {"price": Raw("p.price")}；
+// whereClause 使用 :name 命名参数，取值来自 args，并须写明与 FROM 表的关联条件，否则会按笛卡尔积更新
+func (t Table) UpdateFrom(ctx context.Context, setData map[string]interface{}, fromClause, whereClause string, args map[string]interface{}) (int64, error) {
 	var total int64
-	err := t.withMetrics(ctx, t.name, deleteOper, func(ctx context.Context) error {
-		query := fmt.Sprintf("DELETE FROM %s WHERE %s", t.name, whereClause)
+	err := t.withMetrics(ctx, t.name, updateOper, func(ctx context.Context) error {
+		if len(setData) == 0 || fromClause == "" || whereClause == "" {
+			return t.wrapError(fmt.Errorf("%w: update from requires set data, a FROM clause and a WHERE clause",
+				types.ErrInvalidStructure), "update from")
+		}
 
-		// 使用 NamedExec 来处理命名参数
-		query, args, err := sqlx.Named(query, args)
-		if err != nil {
-			return t.wrapError(err, "prepare delete statement")
+		// 按列名排序以保证生成的SQL稳定；SET 参数加前缀，避免与 WHERE 中的同名参数冲突
+		columns := make([]string, 0, len(setData))
+		for column := range setData {
+			columns = append(columns, column)
 		}
+		sort.Strings(columns)
 
-		// 将命名参数转换为位置参数
+		namedArgs := make(map[string]interface{}, len(args)+len(setData))
+		for key, value := range args {
+			namedArgs[key] = value
+		}
+		setValues := make([]string, len(columns))
+		for i, column := range columns {
+			if expr, ok := setData[column].(sqlExpr); ok {
+				setValues[i] = fmt.Sprintf("%s = %s", column, expr)
+				continue
+			}
+			namedArgs["set_"+column] = setData[column]
+			setValues[i] = fmt.Sprintf("%s = :set_%s", column, column)
+		}
+
+		query := fmt.Sprintf("UPDATE %s SET %s FROM %s WHERE %s",
+			t.name, strings.Join(setValues, ", "), fromClause, whereClause)
+		query, queryArgs, err := sqlx.Named(query, namedArgs)
+		if err != nil {
+			return t.wrapError(err, "prepare update from statement")
+		}
 		query = t.db.Rebind(query)
 
-		result, err := t.db.ExecContext(ctx, query, args...)
+		result, err := t.db.ExecContext(ctx, query, queryArgs...)
 		if err != nil {
-			return t.wrapError(err, "delete from "+t.name)
+			return t.wrapError(err, "update "+t.name+" from "+fromClause)
 		}
 		total, err = result.RowsAffected()
+		recordRowsAffected(ctx, total)
 		return t.wrapError(err, "get rows affected")
 	})
 	return total, err
 }
 
-func (t Table) Query() types.Query {
-	return &Query{
-		DB:    t.DB,
-		table: t.name,
-	}
+// Raw 将 expr 作为SQL表达式原样写入语句而不是绑定参数，用于 UpdateFrom 的 SET 值（如 Raw("s.name")）
+// 及插入数据中的值（如 Raw("NOW()")）；expr 不做任何转义，不能包含外部输入
+func Raw(expr string) interface{} {
+	return sqlExpr(expr)
 }
 
-func (t Table) AddColumn(ctx context.Context, col types.ColumnDefinition) error {
-	return t.withMetrics(ctx, t.name, columnOper, func(ctx context.Context) error {
-		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", t.name, col.Name, col.Type)
-		if !col.Nullable {
-			query += " NOT NULL"
+// UpdateStruct 根据结构体的 db 标签生成 SET 子句，根据 where 映射生成等值 WHERE 条件
+// 带 omitempty 选项的零值字段不会被更新；只读字段被跳过；where 中值为 nil 的条件生成 IS NULL
+// 为避免误更新整张表，where 不能为空
+func (t Table) UpdateStruct(ctx context.Context, where map[string]interface{}, data interface{}) (int64, error) {
+	var total int64
+	err := t.withMetrics(ctx, t.name, updateOper, func(ctx context.Context) error {
+		query, args, err := t.buildUpdateStruct(where, data, nil)
+		if err != nil {
+			return err
 		}
-		_, err := t.db.ExecContext(ctx, query)
+
+		result, err := t.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return t.wrapError(err, "update "+t.name)
+		}
+		total, err = result.RowsAffected()
+		recordRowsAffected(ctx, total)
+		return t.wrapError(err, "get rows affected")
+	})
+	return total, err
+}
+
+// UpdateStructReturning 与 UpdateStruct 规则相同，并将 RETURNING * 的更新后记录扫描到 dest
+// dest 为切片指针时接收所有更新行；为结构体指针时接收单行，没有匹配行返回 ErrRecordNotFound
+func (t Table) UpdateStructReturning(ctx context.Context, where map[string]interface{}, data interface{}, dest interface{}) error {
+	return t.withMetrics(ctx, t.name, updateOper, func(ctx context.Context) error {
+		destValue := reflect.ValueOf(dest)
+		if destValue.Kind() != reflect.Ptr || destValue.IsNil() {
+			return t.wrapError(fmt.Errorf("%w: destination must be a non-nil pointer", types.ErrInvalidStructure), "update struct returning")
+		}
+
+		query, args, err := t.buildUpdateStruct(where, data, nil)
+		if err != nil {
+			return err
+		}
+		query += " RETURNING *"
+
+		if destValue.Elem().Kind() == reflect.Slice {
+			return t.wrapError(t.db.SelectContext(ctx, dest, query, args...), "update "+t.name)
+		}
+		return t.wrapError(t.db.GetContext(ctx, dest, query, args...), "update "+t.name)
+	})
+}
+
+// UpdateFields 只更新结构体中 fields 指定的列（按 db 标签或 mapper 映射的列名），其余字段保持原值
+// 列出的字段即使为零值且带 omitempty 也会被写入；字段不存在或为只读字段时返回 ErrInvalidStructure
+// where 规则与 UpdateStruct 相同
+func (t Table) UpdateFields(ctx context.Context, where map[string]interface{}, data interface{}, fields []string) (int64, error) {
+	var total int64
+	err := t.withMetrics(ctx, t.name, updateOper, func(ctx context.Context) error {
+		if len(fields) == 0 {
+			return t.wrapError(fmt.Errorf("%w: fields are required", types.ErrInvalidStructure), "update fields")
+		}
+
+		query, args, err := t.buildUpdateStruct(where, data, fields)
+		if err != nil {
+			return err
+		}
+
+		result, err := t.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return t.wrapError(err, "update "+t.name)
+		}
+		total, err = result.RowsAffected()
+		recordRowsAffected(ctx, total)
+		return t.wrapError(err, "get rows affected")
+	})
+	return total, err
+}
+
+// buildUpdateStruct 构建 UpdateStruct 的 UPDATE 语句及位置参数
+// mask 非空时只更新其中列出的列
+func (t Table) buildUpdateStruct(where map[string]interface{}, data interface{}, mask []string) (string, []interface{}, error) {
+	if len(where) == 0 {
+		return "", nil, t.wrapError(fmt.Errorf("%w: where conditions are required", types.ErrInvalidStructure), "update struct")
+	}
+
+	val := reflect.ValueOf(data)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return "", nil, t.wrapError(fmt.Errorf("%w: expected struct, got %s", types.ErrInvalidStructure, val.Kind()), "update struct")
+	}
+
+	var fields []string
+	var values []interface{}
+	var err error
+	if len(mask) > 0 {
+		fields, values, err = extractMaskedFields(val, t.fieldMapper, mask)
+	} else {
+		fields, values, err = extractFromStruct(val, t.fieldMapper)
+	}
+	if err != nil {
+		return "", nil, t.wrapError(err, "extract fields for update")
+	}
+	if len(fields) == 0 {
+		return "", nil, t.wrapError(types.ErrInvalidStructure, "no fields to update")
+	}
+
+	placeholders, namedArgs := namedInsertValues(fields, values)
+	setValues := make([]string, len(fields))
+	for i, field := range fields {
+		setValues[i] = fmt.Sprintf("%s = %s", field, placeholders[i])
+	}
+
+	// WHERE 参数加前缀，避免与 SET 参数同名
+	keys := make([]string, 0, len(where))
+	for key := range where {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	conditions := make([]string, len(keys))
+	for i, key := range keys {
+		if where[key] == nil {
+			conditions[i] = key + " IS NULL"
+			continue
+		}
+		conditions[i] = fmt.Sprintf("%s = :where_%s", key, key)
+		namedArgs["where_"+key] = where[key]
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		t.name, strings.Join(setValues, ", "), strings.Join(conditions, " AND "))
+
+	query, args, err := sqlx.Named(query, namedArgs)
+	if err != nil {
+		return "", nil, t.wrapError(err, "prepare update statement")
+	}
+	return t.db.Rebind(query), args, nil
+}
+
+// extractMaskedFields 按 mask 的顺序提取结构体中指定列的值，忽略 omitempty
+func extractMaskedFields(val reflect.Value, mapper func(string) string, mask []string) ([]string, []interface{}, error) {
+	columns := make(map[string]reflect.Value)
+	readonly := make(map[string]bool)
+	collectStructColumns(val, mapper, columns, readonly)
+
+	values := make([]interface{}, len(mask))
+	for i, name := range mask {
+		if readonly[name] {
+			return nil, nil, fmt.Errorf("%w: field %s is read-only", types.ErrInvalidStructure, name)
+		}
+		fieldValue, ok := columns[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: field %s not found in %s", types.ErrInvalidStructure, name, val.Type())
+		}
+		values[i] = fieldArgValue(fieldValue)
+	}
+	return mask, values, nil
+}
+
+// collectStructColumns 收集结构体（含嵌入结构体）的列名到字段值的映射，只读列单独记录
+func collectStructColumns(val reflect.Value, mapper func(string) string, columns map[string]reflect.Value, readonly map[string]bool) {
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, ok := fieldColumn(field, mapper)
+		if !ok {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && !isValuerType(field.Type) {
+			collectStructColumns(val.Field(i), mapper, columns, readonly)
+			continue
+		}
+		if opts.readonly {
+			readonly[name] = true
+			continue
+		}
+		columns[name] = val.Field(i)
+	}
+}
+
+func (t Table) Delete(ctx context.Context, whereClause string, args map[string]interface{}) (int64, error) {
+	var total int64
+	err := t.withMetrics(ctx, t.name, deleteOper, func(ctx context.Context) error {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s", t.name, whereClause)
+
+		// 使用 NamedExec 来处理命名参数
+		query, args, err := sqlx.Named(query, args)
+		if err != nil {
+			return t.wrapError(err, "prepare delete statement")
+		}
+
+		// 将命名参数转换为位置参数
+		query = t.db.Rebind(query)
+
+		result, err := t.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return t.wrapError(err, "delete from "+t.name)
+		}
+		total, err = result.RowsAffected()
+		recordRowsAffected(ctx, total)
+		return t.wrapError(err, "get rows affected")
+	})
+	return total, err
+}
+
+// DeleteStrict 与 Delete 相同，但没有记录匹配（影响行数为 0）时返回 ErrRecordNotFound
+func (t Table) DeleteStrict(ctx context.Context, whereClause string, args map[string]interface{}) (int64, error) {
+	affected, err := t.Delete(ctx, whereClause, args)
+	if err == nil && affected == 0 {
+		err = fmt.Errorf("%w: delete from %s", ErrRecordNotFound, t.name)
+	}
+	return affected, err
+}
+
+// DeleteUsing 执行 DELETE FROM 表 USING usingClause WHERE whereClause，按与其他表的关联条件删除记录
+// whereClause 使用 :name 命名参数，取值来自 args，并须写明与 USING 表的关联条件
+func (t Table) DeleteUsing(ctx context.Context, usingClause, whereClause string, args map[string]interface{}) (int64, error) {
+	var total int64
+	err := t.withMetrics(ctx, t.name, deleteOper, func(ctx context.Context) error {
+		if usingClause == "" || whereClause == "" {
+			return t.wrapError(fmt.Errorf("%w: delete using requires a USING clause and a WHERE clause",
+				types.ErrInvalidStructure), "delete using")
+		}
+
+		query := fmt.Sprintf("DELETE FROM %s USING %s WHERE %s", t.name, usingClause, whereClause)
+		query, queryArgs, err := sqlx.Named(query, args)
+		if err != nil {
+			return t.wrapError(err, "prepare delete using statement")
+		}
+		query = t.db.Rebind(query)
+
+		result, err := t.db.ExecContext(ctx, query, queryArgs...)
+		if err != nil {
+			return t.wrapError(err, "delete from "+t.name+" using "+usingClause)
+		}
+		total, err = result.RowsAffected()
+		recordRowsAffected(ctx, total)
+		return t.wrapError(err, "get rows affected")
+	})
+	return total, err
+}
+
+// DeleteByIDs 按ID列表批量删除记录，返回删除的行数；ids 为空时不执行任何操作
+// idColumn 为空时使用表的默认ID列
+func (t Table) DeleteByIDs(ctx context.Context, idColumn string, ids []interface{}) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if idColumn == "" {
+		idColumn = t.defaultIDColumn()
+	}
+
+	var total int64
+	err := t.withMetrics(ctx, t.name, deleteOper, func(ctx context.Context) error {
+		placeholders := make([]string, len(ids))
+		for i := range ids {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		}
+
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)",
+			t.name, idColumn, strings.Join(placeholders, ", "))
+
+		result, err := t.db.ExecContext(ctx, query, ids...)
+		if err != nil {
+			return t.wrapError(err, "delete from "+t.name)
+		}
+		total, err = result.RowsAffected()
+		recordRowsAffected(ctx, total)
+		return t.wrapError(err, "get rows affected")
+	})
+	return total, err
+}
+
+// Count 统计表中满足 whereClause 的记录数，whereClause 为空时统计全表
+// whereClause 使用 :name 命名参数，取值来自 args；设置了软删除列时与 Query().Count 一样排除已删除记录
+func (t Table) Count(ctx context.Context, whereClause string, args map[string]interface{}) (int64, error) {
+	var count int64
+	err := t.withMetrics(ctx, t.name, queryOper, func(ctx context.Context) error {
+		var conditions []string
+		if whereClause != "" {
+			conditions = append(conditions, "("+whereClause+")")
+		}
+		if t.softDeleteColumn != "" {
+			conditions = append(conditions, t.softDeleteColumn+" IS NULL")
+		}
+
+		query := "SELECT COUNT(*) FROM " + t.name
+		if len(conditions) > 0 {
+			query += " WHERE " + strings.Join(conditions, " AND ")
+		}
+
+		query, queryArgs, err := sqlx.Named(query, args)
+		if err != nil {
+			return t.wrapError(err, "prepare count statement")
+		}
+		query = t.db.Rebind(query)
+
+		return t.wrapError(t.db.GetContext(ctx, &count, query, queryArgs...), "count "+t.name)
+	})
+	return count, err
+}
+
+func (t Table) Query() types.Query {
+	return &Query{
+		DB:               t.DB,
+		table:            t.name,
+		softDeleteColumn: t.softDeleteColumn,
+	}
+}
+
+func (t Table) AddColumn(ctx context.Context, col types.ColumnDefinition) error {
+	return t.withMetrics(ctx, t.name, columnOper, func(ctx context.Context) error {
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", t.name, col.Name, col.Type)
+		query += generatedClause(col)
+		if !col.Nullable {
+			query += " NOT NULL"
+		}
+		_, err := t.db.ExecContext(ctx, query)
+		t.invalidateColumns()
 		return t.wrapError(err, "add column "+col.Name)
 	})
 }
@@ -492,6 +1308,7 @@ func (t Table) DropColumn(ctx context.Context, columnName string) error {
 	return t.withMetrics(ctx, t.name, columnOper, func(ctx context.Context) error {
 		query := fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", t.name, columnName)
 		_, err := t.db.ExecContext(ctx, query)
+		t.invalidateColumns()
 		return t.wrapError(err, "drop column "+columnName)
 	})
 }
@@ -501,10 +1318,63 @@ func (t Table) RenameColumn(ctx context.Context, oldName, newName string) error
 		query := fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s",
 			t.name, oldName, newName)
 		_, err := t.db.ExecContext(ctx, query)
+		t.invalidateColumns()
 		return t.wrapError(err, "rename column "+oldName+" to "+newName)
 	})
 }
 
+// NamingStrategy 根据表名、索引列和唯一性生成索引名，用于 CreateIndex 未指定名称的场景
+type NamingStrategy func(table string, columns []string, unique bool) string
+
+// maxIdentifierLength PostgreSQL 标识符的最大字节数（NAMEDATALEN - 1），超出部分会被服务端截断
+const maxIdentifierLength = 63
+
+// DefaultIndexName 默认的索引命名规则：普通索引为 idx_<表>_<列...>，唯一索引为 uniq_<表>_<列...>
+// 表名与列中的模式前缀、表达式符号、排序方向等非标识符字符替换为下划线，如 lower(email) 生成 lower_email；
+// 超过 63 字节时截断并追加哈希后缀，保证不同列组合生成的名称不会因截断而冲突
+func DefaultIndexName(table string, columns []string, unique bool) string {
+	prefix := "idx"
+	if unique {
+		prefix = "uniq"
+	}
+	parts := make([]string, 0, len(columns)+2)
+	parts = append(parts, prefix, sanitizeIdentifier(table))
+	for _, column := range columns {
+		if column = sanitizeIdentifier(column); column != "" {
+			parts = append(parts, column)
+		}
+	}
+	name := strings.Join(parts, "_")
+	if len(name) <= maxIdentifierLength {
+		return name
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	return strings.TrimRight(name[:maxIdentifierLength-len(suffix)], "_") + suffix
+}
+
+// sanitizeIdentifier 转为小写，并将连续的非字母数字字符替换为单个下划线
+func sanitizeIdentifier(s string) string {
+	var sb strings.Builder
+	pending := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pending && sb.Len() > 0 {
+				sb.WriteByte('_')
+			}
+			pending = false
+			sb.WriteRune(r)
+		} else {
+			pending = true
+		}
+	}
+	return sb.String()
+}
+
+// CreateIndex 在 columns 上创建索引；indexName 为空时按 DBConfig.IndexNaming
+// （未配置时为 DefaultIndexName）自动生成名称
 func (t Table) CreateIndex(ctx context.Context, indexName string, columns []string, unique bool) error {
 	return t.withMetrics(ctx, t.name, indexOper, func(ctx context.Context) error {
 		if len(columns) == 0 {
@@ -514,6 +1384,14 @@ func (t Table) CreateIndex(ctx context.Context, indexName string, columns []stri
 			)
 		}
 
+		if indexName == "" {
+			naming := t.indexNaming
+			if naming == nil {
+				naming = DefaultIndexName
+			}
+			indexName = naming(t.name, columns, unique)
+		}
+
 		uniqueClause := ""
 		if unique {
 			uniqueClause = "UNIQUE "
@@ -540,76 +1418,364 @@ func (t Table) DropIndex(ctx context.Context, indexName string) error {
 
 // 优化后的 BulkUpsert 方法
 func (t Table) BulkUpsert(ctx context.Context, conflictKey []string, data []interface{}) (int64, error) {
+	return t.BulkUpsertWithOptions(ctx, data, types.UpsertOptions{ConflictColumns: conflictKey})
+}
+
+// BulkUpsertWithOptions 批量插入/更新，冲突目标由 opts 指定
+// 设置 ConflictConstraint 时生成 ON CONFLICT ON CONSTRAINT name，
+// 适用于冲突目标是具名约束而非列清单的场景
+func (t Table) BulkUpsertWithOptions(ctx context.Context, data []interface{}, opts types.UpsertOptions) (int64, error) {
 	var affected int64
 	err := t.withMetrics(ctx, t.name, upsertOper, func(ctx context.Context) error {
 		if len(data) == 0 {
 			return nil // 没有数据要插入，直接返回
 		}
 
-		// 使用缓存获取结构体字段定义，减少反射操作
-		fields, err := getStructFieldsWithCache(data[0])
+		query, args, err := t.buildBulkUpsert(data, opts)
 		if err != nil {
-			return t.wrapError(err, "extract fields for bulk upsert")
+			return err
 		}
 
-		if len(fields) == 0 {
-			return t.wrapError(types.ErrInvalidStructure, "no fields found")
+		// 执行批量操作
+		result, err := t.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return t.wrapError(err, "execute bulk upsert")
 		}
 
-		// 构建 INSERT 语句前缀
-		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES ",
-			t.name, strings.Join(fields, ", "))
+		affected, err = result.RowsAffected()
+		if err != nil {
+			return t.wrapError(err, "get rows affected")
+		}
+		recordRowsAffected(ctx, affected)
 
-		// 预分配足够容量以减少内存分配
-		placeholders := make([]string, len(data))
-		args := make([]interface{}, 0, len(data)*len(fields))
+		return nil
+	})
+
+	return affected, err
+}
 
-		// 为每行数据构建占位符和提取值
-		placeholderTemplate := buildPlaceholderTemplate(len(fields))
+// BulkUpsertReturning 与 BulkUpsertWithOptions 相同，并将 RETURNING * 的结果扫描到 dest（切片指针）
+// opts.ReturnInserted 为 true 时追加 (xmax = 0) AS inserted，dest 元素可通过 db:"inserted" 的 bool 字段
+// 区分每一行是新插入（true）还是冲突后更新（false）；DO NOTHING 跳过的行不会出现在结果中
+func (t Table) BulkUpsertReturning(ctx context.Context, data []interface{}, opts types.UpsertOptions, dest interface{}) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() || destValue.Elem().Kind() != reflect.Slice {
+		return t.wrapError(fmt.Errorf("%w: destination must be a pointer to slice", types.ErrInvalidStructure), "bulk upsert returning")
+	}
 
+	return t.withMetrics(ctx, t.name, upsertOper, func(ctx context.Context) error {
+		if len(data) == 0 {
+			return nil
+		}
+
+		query, args, err := t.buildBulkUpsert(data, opts)
+		if err != nil {
+			return err
+		}
+		query += " RETURNING *"
+		if opts.ReturnInserted {
+			query += ", (xmax = 0) AS inserted"
+		}
+
+		err = t.db.SelectContext(ctx, dest, query, args...)
+		return t.wrapError(err, "execute bulk upsert")
+	})
+}
+
+// buildBulkUpsert 构建批量 upsert 的 INSERT ... ON CONFLICT 语句及参数，data 不能为空
+func (t Table) buildBulkUpsert(data []interface{}, opts types.UpsertOptions) (string, []interface{}, error) {
+	var (
+		fields    []string
+		rowValues [][]interface{}
+		err       error
+	)
+	if isMapValue(data[0]) {
+		// 映射切片没有固定的字段定义，取键的并集作为列
+		fields, rowValues, err = mapBatchValues(data)
+		if err != nil {
+			return "", nil, t.wrapError(err, "extract fields for bulk upsert")
+		}
+	} else {
+		// 使用缓存获取结构体字段定义，减少反射操作
+		fields, err = getStructFieldsWithCache(data[0], t.fieldMapper)
+		if err != nil {
+			return "", nil, t.wrapError(err, "extract fields for bulk upsert")
+		}
+
+		if len(fields) == 0 {
+			return "", nil, t.wrapError(noUsableFieldsError(data[0]), "extract fields for bulk upsert")
+		}
+
+		rowValues = make([][]interface{}, len(data))
 		for i, item := range data {
-			values, err := extractValuesWithCache(item, fields)
+			values, err := extractValuesWithCache(item, fields, t.fieldMapper)
 			if err != nil {
-				return t.wrapError(err, "extract values")
+				return "", nil, t.wrapError(err, "extract values")
 			}
+			rowValues[i] = values
+		}
+	}
 
-			// 构建带有参数索引的占位符
-			rowPlaceholders := fmt.Sprintf(placeholderTemplate, i*len(fields)+1)
-			placeholders[i] = rowPlaceholders
-			args = append(args, values...)
+	// 按冲突键排序，使并发的批量 upsert 以一致的顺序加锁
+	if opts.SortByConflictKey {
+		if err := sortRowsByColumns(fields, rowValues, opts.ConflictColumns); err != nil {
+			return "", nil, t.wrapError(err, "sort rows for bulk upsert")
 		}
+	}
 
-		// 完成 VALUES 子句
-		query += strings.Join(placeholders, ", ")
+	// 构建 INSERT 语句及 ON CONFLICT 子句 (如果提供了冲突目标)
+	rows, args := buildValuesRows(rowValues)
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+		t.name, strings.Join(fields, ", "), strings.Join(rows, ", "))
+	query += buildConflictClause(fields, opts)
+	return query, args, nil
+}
 
-		// 添加 ON CONFLICT 子句 (如果提供了冲突键)
-		if len(conflictKey) > 0 {
-			updateClauses := buildUpdateClauses(fields, conflictKey)
-			if len(updateClauses) > 0 {
-				query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s",
-					strings.Join(conflictKey, ", "),
-					strings.Join(updateClauses, ", "))
-			} else {
-				query += fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING",
-					strings.Join(conflictKey, ", "))
-			}
+// Merge 执行 MERGE INTO 表 USING using ON on 语句，返回影响的行数（需要 PostgreSQL 15 及以上版本，
+// 可用 DB.ServerVersion 判断）。whenMatched / whenNotMatched 的每一项生成一个 WHEN 分支，按顺序匹配：
+// 以 AND 开头的项附带额外条件（如 "AND s.deleted THEN DELETE"），其余项视为动作（如 "UPDATE SET name = s.name"、
+// "DO NOTHING"），自动补全 THEN。using 与 on 中可使用 $N 占位符，对应 args
+func (t Table) Merge(ctx context.Context, using, on string, whenMatched, whenNotMatched []string, args ...interface{}) (int64, error) {
+	var affected int64
+	err := t.withMetrics(ctx, t.name, upsertOper, func(ctx context.Context) error {
+		if using == "" || on == "" {
+			return t.wrapError(fmt.Errorf("%w: USING source and ON condition are required", types.ErrInvalidStructure), "merge")
+		}
+		if len(whenMatched) == 0 && len(whenNotMatched) == 0 {
+			return t.wrapError(fmt.Errorf("%w: at least one WHEN clause is required", types.ErrInvalidStructure), "merge")
 		}
 
-		// 执行批量操作
-		result, err := t.db.ExecContext(ctx, query, args...)
-		if err != nil {
-			return t.wrapError(err, "execute bulk upsert")
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("MERGE INTO %s USING %s ON %s", t.name, using, on))
+		for _, clause := range whenMatched {
+			sb.WriteString(mergeWhenClause("WHEN MATCHED", clause))
+		}
+		for _, clause := range whenNotMatched {
+			sb.WriteString(mergeWhenClause("WHEN NOT MATCHED", clause))
 		}
 
+		result, err := t.db.ExecContext(ctx, sb.String(), args...)
+		if err != nil {
+			return t.wrapError(err, "merge into "+t.name)
+		}
 		affected, err = result.RowsAffected()
+		recordRowsAffected(ctx, affected)
+		return t.wrapError(err, "get rows affected")
+	})
+	return affected, err
+}
+
+// mergeWhenClause 生成 MERGE 的 WHEN 分支，clause 未以 AND 开头时补全 THEN
+func mergeWhenClause(when, clause string) string {
+	clause = strings.TrimSpace(clause)
+	upper := strings.ToUpper(clause)
+	if strings.HasPrefix(upper, "AND ") || strings.HasPrefix(upper, "THEN ") {
+		return " " + when + " " + clause
+	}
+	return " " + when + " THEN " + clause
+}
+
+// InsertMaps 以单条多行 INSERT 批量插入映射数据，适用于列在运行时才确定的场景
+// 列取所有映射键的并集，任一映射缺少或多出键时返回 ErrInvalidStructure
+func (t Table) InsertMaps(ctx context.Context, rows []map[string]interface{}) (int64, error) {
+	data := make([]interface{}, len(rows))
+	for i, row := range rows {
+		data[i] = row
+	}
+	return t.BulkUpsertWithOptions(ctx, data, types.UpsertOptions{})
+}
+
+// isMapValue 判断数据（或其指向的值）是否为映射
+func isMapValue(data interface{}) bool {
+	val := reflect.ValueOf(data)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	return val.Kind() == reflect.Map
+}
+
+// mapBatchValues 提取映射切片的列和每行的值
+// 列为全部键的并集（排序以保证SQL稳定），各映射的键集合必须一致
+func mapBatchValues(data []interface{}) ([]string, [][]interface{}, error) {
+	records := make([]map[string]interface{}, len(data))
+	columnSet := make(map[string]struct{})
+	for i, item := range data {
+		if !isMapValue(item) {
+			return nil, nil, fmt.Errorf("%w: record %d is not a map", types.ErrInvalidStructure, i)
+		}
+		fields, values, err := extractFieldsAndValues(item, nil)
 		if err != nil {
-			return t.wrapError(err, "get rows affected")
+			return nil, nil, err
+		}
+		record := make(map[string]interface{}, len(fields))
+		for j, field := range fields {
+			record[field] = values[j]
+			columnSet[field] = struct{}{}
 		}
+		records[i] = record
+	}
 
-		return nil
+	if len(columnSet) == 0 {
+		return nil, nil, fmt.Errorf("%w: no columns to insert", types.ErrInvalidStructure)
+	}
+
+	fields := make([]string, 0, len(columnSet))
+	for field := range columnSet {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	rowValues := make([][]interface{}, len(records))
+	for i, record := range records {
+		values := make([]interface{}, len(fields))
+		for j, field := range fields {
+			value, ok := record[field]
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: record %d is missing column %s",
+					types.ErrInvalidStructure, i, field)
+			}
+			values[j] = value
+		}
+		rowValues[i] = values
+	}
+	return fields, rowValues, nil
+}
+
+// buildValuesRows 为多行数据生成 ($1, $2), ($3, $4) 形式的占位符，SQL表达式（如 NOW()）直接内联
+func buildValuesRows(rowValues [][]interface{}) ([]string, []interface{}) {
+	rows := make([]string, len(rowValues))
+	args := make([]interface{}, 0, len(rowValues)*len(rowValues[0]))
+	for i, values := range rowValues {
+		placeholders := make([]string, len(values))
+		for j, value := range values {
+			if expr, ok := value.(sqlExpr); ok {
+				placeholders[j] = string(expr)
+				continue
+			}
+			args = append(args, value)
+			placeholders[j] = fmt.Sprintf("$%d", len(args))
+		}
+		rows[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+	return rows, args
+}
+
+// sortRowsByColumns 按指定列的值对行稳定排序，列必须出现在 fields 中
+func sortRowsByColumns(fields []string, rowValues [][]interface{}, columns []string) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: sorting by conflict key requires conflict columns", types.ErrInvalidStructure)
+	}
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = -1
+		for j, field := range fields {
+			if field == column {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] == -1 {
+			return fmt.Errorf("%w: conflict column %s is not part of the inserted columns", types.ErrInvalidStructure, column)
+		}
+	}
+
+	sort.SliceStable(rowValues, func(a, b int) bool {
+		for _, idx := range indexes {
+			if c := compareValues(rowValues[a][idx], rowValues[b][idx]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
 	})
+	return nil
+}
 
-	return affected, err
+// compareValues 比较两个列值，支持数值、字符串、布尔和时间类型，其他类型按字符串形式比较；nil 排在最前
+func compareValues(a, b interface{}) int {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for va.Kind() == reflect.Ptr && !va.IsNil() {
+		va = va.Elem()
+	}
+	for vb.Kind() == reflect.Ptr && !vb.IsNil() {
+		vb = vb.Elem()
+	}
+	aNil := !va.IsValid() || (va.Kind() == reflect.Ptr && va.IsNil())
+	bNil := !vb.IsValid() || (vb.Kind() == reflect.Ptr && vb.IsNil())
+	switch {
+	case aNil && bNil:
+		return 0
+	case aNil:
+		return -1
+	case bNil:
+		return 1
+	}
+
+	if ta, ok := va.Interface().(time.Time); ok {
+		if tb, ok := vb.Interface().(time.Time); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	switch {
+	case isIntKind(va.Kind()) && isIntKind(vb.Kind()):
+		return compareOrdered(va.Int(), vb.Int())
+	case isUintKind(va.Kind()) && isUintKind(vb.Kind()):
+		return compareOrdered(va.Uint(), vb.Uint())
+	case isFloatKind(va.Kind()) && isFloatKind(vb.Kind()):
+		return compareOrdered(va.Float(), vb.Float())
+	case va.Kind() == reflect.String && vb.Kind() == reflect.String:
+		return strings.Compare(va.String(), vb.String())
+	case va.Kind() == reflect.Bool && vb.Kind() == reflect.Bool:
+		return compareOrdered(int64(boolToInt(va.Bool())), int64(boolToInt(vb.Bool())))
+	}
+	return strings.Compare(fmt.Sprint(va.Interface()), fmt.Sprint(vb.Interface()))
+}
+
+func compareOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isIntKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloatKind(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// buildConflictClause 根据冲突选项构建 ON CONFLICT 子句，未设置冲突目标时返回空串
+func buildConflictClause(fields []string, opts types.UpsertOptions) string {
+	target := buildConflictTarget(opts)
+	if target == "" {
+		return ""
+	}
+	if updateClauses := buildUpdateClauses(fields, opts.ConflictColumns); len(updateClauses) > 0 {
+		return fmt.Sprintf(" ON CONFLICT %s DO UPDATE SET %s", target, strings.Join(updateClauses, ", "))
+	}
+	return fmt.Sprintf(" ON CONFLICT %s DO NOTHING", target)
 }
 
 // 使用同步映射缓存结构体字段定义
@@ -618,6 +1784,20 @@ var (
 	fieldValuesCache  = sync.Map{}
 )
 
+// structCacheKey 字段缓存键：同一结构体在不同 mapper 下解析出的列名不同
+type structCacheKey struct {
+	typ    reflect.Type
+	mapper uintptr
+}
+
+func newStructCacheKey(t reflect.Type, mapper func(string) string) structCacheKey {
+	key := structCacheKey{typ: t}
+	if mapper != nil {
+		key.mapper = reflect.ValueOf(mapper).Pointer()
+	}
+	return key
+}
+
 // 构建占位符模板 (例如: ($%d, $%d, $%d))
 func buildPlaceholderTemplate(fieldCount int) string {
 	placeholders := make([]string, fieldCount)
@@ -627,6 +1807,21 @@ func buildPlaceholderTemplate(fieldCount int) string {
 	return "(" + strings.Join(placeholders, ", ") + ")"
 }
 
+// 构建冲突目标 (例如: (id, email)、(email) WHERE deleted_at IS NULL 或 ON CONSTRAINT users_email_key)
+func buildConflictTarget(opts types.UpsertOptions) string {
+	if opts.ConflictConstraint != "" {
+		return "ON CONSTRAINT " + opts.ConflictConstraint
+	}
+	if len(opts.ConflictColumns) > 0 {
+		target := "(" + strings.Join(opts.ConflictColumns, ", ") + ")"
+		if where := strings.TrimSpace(opts.ConflictWhere); where != "" {
+			target += " WHERE " + where
+		}
+		return target
+	}
+	return ""
+}
+
 // 构建 UPDATE 子句，排除冲突键
 func buildUpdateClauses(fields []string, conflictKey []string) []string {
 	// 创建冲突键集合，用于快速查找
@@ -648,7 +1843,7 @@ func buildUpdateClauses(fields []string, conflictKey []string) []string {
 }
 
 // 使用缓存获取结构体字段
-func getStructFieldsWithCache(data interface{}) ([]string, error) {
+func getStructFieldsWithCache(data interface{}, mapper func(string) string) ([]string, error) {
 	t := reflect.TypeOf(data)
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
@@ -660,7 +1855,7 @@ func getStructFieldsWithCache(data interface{}) ([]string, error) {
 	}
 
 	// 尝试从缓存获取
-	cacheKey := t.PkgPath() + "." + t.Name()
+	cacheKey := newStructCacheKey(t, mapper)
 	if cachedFields, found := structFieldsCache.Load(cacheKey); found {
 		return cachedFields.([]string), nil
 	}
@@ -668,9 +1863,8 @@ func getStructFieldsWithCache(data interface{}) ([]string, error) {
 	// 缓存未命中，解析字段
 	fields := make([]string, 0, t.NumField())
 	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		tag := field.Tag.Get("db")
-		if tag != "" && tag != "-" {
+		tag, opts, ok := fieldColumn(t.Field(i), mapper)
+		if ok && !opts.readonly {
 			fields = append(fields, tag)
 		}
 	}
@@ -682,7 +1876,7 @@ func getStructFieldsWithCache(data interface{}) ([]string, error) {
 }
 
 // 使用缓存提取结构体值
-func extractValuesWithCache(data interface{}, fields []string) ([]interface{}, error) {
+func extractValuesWithCache(data interface{}, fields []string, mapper func(string) string) ([]interface{}, error) {
 	v := reflect.ValueOf(data)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
@@ -693,7 +1887,7 @@ func extractValuesWithCache(data interface{}, fields []string) ([]interface{}, e
 	}
 
 	t := v.Type()
-	cacheKey := t.PkgPath() + "." + t.Name()
+	cacheKey := newStructCacheKey(t, mapper)
 
 	// 尝试从缓存获取字段索引映射
 	var fieldIndexMap map[string]int
@@ -703,8 +1897,7 @@ func extractValuesWithCache(data interface{}, fields []string) ([]interface{}, e
 		// 创建字段名到索引的映射
 		fieldIndexMap = make(map[string]int, t.NumField())
 		for i := 0; i < t.NumField(); i++ {
-			tag := t.Field(i).Tag.Get("db")
-			if tag != "" && tag != "-" {
+			if tag, _, ok := fieldColumn(t.Field(i), mapper); ok {
 				fieldIndexMap[tag] = i
 			}
 		}
@@ -716,7 +1909,7 @@ func extractValuesWithCache(data interface{}, fields []string) ([]interface{}, e
 	values := make([]interface{}, len(fields))
 	for i, fieldName := range fields {
 		if idx, ok := fieldIndexMap[fieldName]; ok {
-			values[i] = v.Field(idx).Interface()
+			values[i] = fieldArgValue(v.Field(idx))
 		} else {
 			// 如果字段不存在，使用零值
 			values[i] = nil
@@ -728,31 +1921,47 @@ func extractValuesWithCache(data interface{}, fields []string) ([]interface{}, e
 
 func getStructFields(data interface{}) []string {
 	// 使用反射或结构体标签获取字段列表
-	// 这里简化实现，实际应使用sqlx的字段解析
+	// 与缓存版本一致，跳过未标记或标记为 "-" 的字段
 	t := reflect.TypeOf(data)
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
 	var fields []string
 	for i := 0; i < t.NumField(); i++ {
-		fields = append(fields, t.Field(i).Tag.Get("db"))
+		if tag, _, ok := fieldColumn(t.Field(i), nil); ok {
+			fields = append(fields, tag)
+		}
 	}
 	return fields
 }
 
 func getStructValues(data interface{}) []interface{} {
-	// 使用反射获取字段值
+	// 使用反射获取字段值，与 getStructFields 的字段一一对应
 	v := reflect.ValueOf(data)
 	if v.Kind() == reflect.Ptr {
 		v = v.Elem()
 	}
 	var values []interface{}
 	for i := 0; i < v.NumField(); i++ {
-		values = append(values, v.Field(i).Interface())
+		if _, _, ok := fieldColumn(v.Type().Field(i), nil); ok {
+			values = append(values, v.Field(i).Interface())
+		}
 	}
 	return values
 }
 
+// noUsableFieldsError 数据中没有可写入的列时返回的错误，错误信息中包含结构体名称便于定位
+func noUsableFieldsError(data interface{}) error {
+	t := reflect.TypeOf(data)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: no fields to write", types.ErrInvalidStructure)
+	}
+	return fmt.Errorf("%w: struct %s has no usable db-tagged fields", types.ErrInvalidStructure, t.String())
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
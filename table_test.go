@@ -2,13 +2,18 @@ package postgresql_helper
 
 import (
 	"context"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
 	"github.com/lib/pq"
 	"github.com/songzhibin97/postgresql_helper/types"
 	"github.com/stretchr/testify/assert"
@@ -128,6 +133,102 @@ func TestTable_Insert(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
+	t.Run("insert skips generated columns", func(t *testing.T) {
+		type Order struct {
+			Price    int `db:"price"`
+			Quantity int `db:"quantity"`
+			Total    int `db:"total,generated"`
+		}
+
+		// 设置期望 - total 不应出现在列清单中
+		mock.ExpectExec(`INSERT INTO users \(price, quantity\) VALUES \(\$1, \$2\)`).
+			WithArgs(10, 3).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		// 执行测试
+		err := table.Insert(ctx, Order{Price: 10, Quantity: 3, Total: 30})
+		assert.NoError(t, err, "Insert should skip generated columns")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("insert untagged struct", func(t *testing.T) {
+		type Untagged struct {
+			Name  string
+			Email string
+		}
+
+		// 不应执行任何SQL
+		err := table.Insert(ctx, Untagged{Name: "John"})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "Untagged has no usable db-tagged fields")
+
+		_, err = table.BulkUpsert(ctx, []string{"name"}, []interface{}{Untagged{Name: "John"}})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "Untagged")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("insert uses NOW() for zero now columns", func(t *testing.T) {
+		type Event struct {
+			Name      string    `db:"name"`
+			CreatedAt time.Time `db:"created_at,now"`
+		}
+
+		// created_at 使用 NOW() 表达式而非占位符
+		mock.ExpectExec(`INSERT INTO users \(name, created_at\) VALUES \(\$1, NOW\(\)\)`).
+			WithArgs("signup").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := table.Insert(ctx, Event{Name: "signup"})
+		assert.NoError(t, err, "Insert should substitute NOW()")
+
+		// 显式赋值时正常绑定参数
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		mock.ExpectExec(`INSERT INTO users \(name, created_at\) VALUES \(\$1, \$2\)`).
+			WithArgs("signup", createdAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err = table.Insert(ctx, Event{Name: "signup", CreatedAt: createdAt})
+		assert.NoError(t, err, "Insert should bind explicit time")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("insert untagged struct with field mapper", func(t *testing.T) {
+		type Profile struct {
+			UserID    int
+			FirstName string
+			Nickname  string `db:"nick"`
+			internal  string
+			Ignored   string `db:"-"`
+		}
+
+		mapped := *table.DB
+		mapped.fieldMapper = SnakeCase
+		mappedTable := &Table{DB: &mapped, name: "users"}
+
+		// 设置期望 - 未标记字段按蛇形命名映射，标签仍然优先
+		mock.ExpectExec(`INSERT INTO users \(user_id, first_name, nick\) VALUES \(\$1, \$2, \$3\)`).
+			WithArgs(7, "John", "jd").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		// 执行测试
+		err := mappedTable.Insert(ctx, Profile{UserID: 7, FirstName: "John", Nickname: "jd", internal: "x", Ignored: "y"})
+		assert.NoError(t, err, "Insert with field mapper should succeed")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("untagged struct without field mapper", func(t *testing.T) {
+		type Profile struct {
+			UserID    int
+			FirstName string
+		}
+
+		// 默认要求显式标记，没有可插入的字段
+		err := table.Insert(ctx, Profile{UserID: 7, FirstName: "John"})
+		assert.Error(t, err, "Insert without tags should fail by default")
+		assert.Contains(t, err.Error(), "invalid table structure")
+	})
+
 	t.Run("invalid data type", func(t *testing.T) {
 		// 执行测试 - 传入非结构体非map类型
 		err := table.Insert(ctx, "invalid")
@@ -136,6 +237,96 @@ func TestTable_Insert(t *testing.T) {
 	})
 }
 
+// testMoney 以分为单位存储、以指针接收者实现 driver.Valuer 的金额类型
+type testMoney struct {
+	Cents int64
+}
+
+func (m *testMoney) Value() (driver.Value, error) {
+	return fmt.Sprintf("%d.%02d", m.Cents/100, m.Cents%100), nil
+}
+
+// AuditInfo 嵌入使用的值接收者 Valuer，整体绑定为一列（嵌入字段须导出）
+type AuditInfo struct {
+	By string
+}
+
+func (a AuditInfo) Value() (driver.Value, error) {
+	return "audit:" + a.By, nil
+}
+
+func TestTable_InsertValuer(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	type Order struct {
+		Name      string    `db:"name"`
+		Price     testMoney `db:"price"`
+		AuditInfo `db:"audit"`
+	}
+
+	t.Run("insert binds Value output", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO users \(name, price, audit\) VALUES \(\$1, \$2, \$3\)`).
+			WithArgs("book", "12.34", "audit:alice").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := table.Insert(ctx, Order{Name: "book", Price: testMoney{Cents: 1234}, AuditInfo: AuditInfo{By: "alice"}})
+		assert.NoError(t, err, "Insert with Valuer fields should succeed")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("bulk upsert binds Value output", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO users \(name, price, audit\) VALUES \(\$1, \$2, \$3\)`).
+			WithArgs("pen", "0.99", "audit:bob").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := table.BulkUpsert(ctx, nil, []interface{}{
+			Order{Name: "pen", Price: testMoney{Cents: 99}, AuditInfo: AuditInfo{By: "bob"}},
+		})
+		assert.NoError(t, err, "BulkUpsert with Valuer fields should succeed")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+}
+
+// TestTable_InsertStrict 测试InsertStrict方法
+func TestTable_InsertStrict(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	user := TestUser{Name: "John Doe", Email: "john@example.com", Age: 30}
+
+	t.Run("zero rows affected", func(t *testing.T) {
+		// 插入被规则或触发器吞掉时影响行数为 0
+		mock.ExpectExec(`INSERT INTO users \(name, email, age\)`).
+			WithArgs("John Doe", "john@example.com", 30).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := table.InsertStrict(ctx, user)
+		assert.ErrorIs(t, err, ErrNoRowsInserted)
+		assert.Contains(t, err.Error(), "insert into users affected 0 rows")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("one row affected", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO users \(name, email, age\)`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		assert.NoError(t, table.InsertStrict(ctx, user))
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("Insert ignores zero rows affected", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO users \(name, email, age\)`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.NoError(t, table.Insert(ctx, user))
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+}
+
 // TestTable_InsertAndGetID 测试InsertAndGetID方法
 func TestTable_InsertAndGetID(t *testing.T) {
 	table, mock, cleanup := setupTableTest(t)
@@ -164,6 +355,51 @@ func TestTable_InsertAndGetID(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
+	t.Run("insert skipped by trigger", func(t *testing.T) {
+		// BEFORE 触发器返回 NULL 时 RETURNING 没有结果行
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING id`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		id, err := table.InsertAndGetID(ctx, TestUser{Name: "Skipped", Email: "skip@example.com", Age: 40})
+		assert.ErrorIs(t, err, ErrNoRowsInserted)
+		assert.NotErrorIs(t, err, ErrRecordNotFound)
+		assert.Contains(t, err.Error(), "insert into users produced no returning row")
+		assert.Equal(t, int64(0), id)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("configured default id column", func(t *testing.T) {
+		user := TestUser{
+			Name:  "Jane Doe",
+			Email: "jane@example.com",
+			Age:   25,
+		}
+
+		// 未显式传入列名时使用 WithIDColumn 配置的列
+		rows := sqlmock.NewRows([]string{"pk"}).AddRow(789)
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING pk$`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(rows)
+
+		pkTable := table.WithIDColumn("pk")
+		id, err := pkTable.InsertAndGetID(ctx, user)
+		assert.NoError(t, err, "InsertAndGetID should succeed")
+		assert.Equal(t, int64(789), id, "Should return correct ID")
+
+		// 原表不受影响
+		assert.Equal(t, "id", table.defaultIDColumn())
+
+		// DeleteByIDs 同样使用默认ID列
+		mock.ExpectExec(`DELETE FROM users WHERE pk IN \(\$1\)`).
+			WithArgs(789).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		affected, err := pkTable.DeleteByIDs(ctx, "", []interface{}{789})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), affected)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
 	t.Run("custom id column", func(t *testing.T) {
 		// 使用没有ID的结构体
 		user := TestUser{
@@ -207,6 +443,68 @@ func TestTable_InsertAndGetID(t *testing.T) {
 	})
 }
 
+// TestTable_WithOmitZeroID 测试插入时忽略零值ID列
+func TestTable_WithOmitZeroID(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	omitTable := table.WithOmitZeroID()
+
+	t.Run("InsertAndGetID strips zero id from map", func(t *testing.T) {
+		mock.ExpectQuery(`^INSERT INTO users \(name\) VALUES \(\$1\) RETURNING id$`).
+			WithArgs("John").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+		id, err := omitTable.InsertAndGetID(ctx, map[string]interface{}{"id": 0, "name": "John"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Insert strips nil id", func(t *testing.T) {
+		mock.ExpectExec(`^INSERT INTO users \(name\) VALUES \(\$1\)$`).
+			WithArgs("John").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := omitTable.Insert(ctx, map[string]interface{}{"id": nil, "name": "John"})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("non-zero id is kept", func(t *testing.T) {
+		mock.ExpectQuery(`^INSERT INTO users \(id, name\) VALUES \(\$1, \$2\) RETURNING id$`).
+			WithArgs(7, "John").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+		id, err := omitTable.InsertAndGetID(ctx, map[string]interface{}{"id": 7, "name": "John"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("custom id column", func(t *testing.T) {
+		mock.ExpectQuery(`^INSERT INTO users \(name\) VALUES \(\$1\) RETURNING user_id$`).
+			WithArgs("John").
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(9))
+
+		id, err := omitTable.WithIDColumn("user_id").InsertAndGetID(ctx, map[string]interface{}{"user_id": int64(0), "name": "John"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(9), id)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		mock.ExpectQuery(`^INSERT INTO users \(id, name\) VALUES \(\$1, \$2\) RETURNING id$`).
+			WithArgs(0, "John").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+
+		_, err := table.InsertAndGetID(ctx, map[string]interface{}{"id": 0, "name": "John"})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
 // TestTable_InsertAndGetMultipleColumns 测试InsertAndGetMultipleColumns方法
 func TestTable_InsertAndGetMultipleColumns(t *testing.T) {
 	table, mock, cleanup := setupTableTest(t)
@@ -239,6 +537,29 @@ func TestTable_InsertAndGetMultipleColumns(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
+	t.Run("array columns decoded", func(t *testing.T) {
+		user := TestUser{Name: "John Doe", Email: "john@example.com", Age: 30}
+
+		rows := mock.NewRowsWithColumnDefinition(
+			sqlmock.NewColumn("id").OfType("INT8", int64(0)),
+			sqlmock.NewColumn("tags").OfType("_TEXT", []byte{}),
+			sqlmock.NewColumn("scores").OfType("_INT4", []byte{}),
+			sqlmock.NewColumn("note").OfType("TEXT", []byte{}),
+		).AddRow(int64(7), []byte(`{admin,"power user"}`), []byte(`{1,2,3}`), []byte("hello"))
+
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING id, tags, scores, note`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(rows)
+
+		result, err := table.InsertAndGetMultipleColumns(ctx, user, []string{"id", "tags", "scores", "note"})
+		require.NoError(t, err, "InsertAndGetMultipleColumns should succeed")
+		assert.Equal(t, int64(7), result["id"])
+		assert.Equal(t, []string{"admin", "power user"}, result["tags"], "text[] should decode to []string")
+		assert.Equal(t, []int64{1, 2, 3}, result["scores"], "int[] should decode to []int64")
+		assert.Equal(t, "hello", result["note"], "Non-array bytes should stay strings")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
 	t.Run("empty return columns", func(t *testing.T) {
 		// 使用没有ID的结构体
 		user := TestUser{
@@ -320,6 +641,59 @@ func TestTable_InsertAndGetObject(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
+	t.Run("readonly id omitted from insert but returned", func(t *testing.T) {
+		type Account struct {
+			ID    int    `db:"id,readonly"`
+			Name  string `db:"name"`
+			Email string `db:"email"`
+		}
+
+		// 设置期望 - id 不在列清单中，但在RETURNING中
+		rows := sqlmock.NewRows([]string{"id", "name", "email"}).
+			AddRow(42, "John Doe", "john@example.com")
+
+		mock.ExpectQuery(`INSERT INTO users \(name, email\) VALUES \(\$1, \$2\) RETURNING id, name, email`).
+			WithArgs("John Doe", "john@example.com").
+			WillReturnRows(rows)
+
+		// 执行测试
+		account := Account{Name: "John Doe", Email: "john@example.com"}
+		err := table.InsertAndGetObject(ctx, account, &account)
+		assert.NoError(t, err, "InsertAndGetObject should succeed")
+		assert.Equal(t, 42, account.ID, "Readonly ID should be populated via RETURNING")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("untagged field populated with field mapper", func(t *testing.T) {
+		type Account struct {
+			ID        int    `db:"id,readonly"`
+			Name      string `db:"name"`
+			CreatedAt time.Time
+			internal  string
+		}
+
+		// 扫描结果同样需要按映射规则匹配列名
+		mappedDB := sqlx.NewDb(table.db.DB, "postgres")
+		mappedDB.Mapper = reflectx.NewMapperFunc("db", SnakeCase)
+		mapped := *table.DB
+		mapped.db = mappedDB
+		mapped.fieldMapper = SnakeCase
+		mappedTable := &Table{DB: &mapped, name: "users"}
+
+		createdAt := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(`INSERT INTO users \(name\) VALUES \(\$1\) RETURNING id, name, created_at$`).
+			WithArgs("John Doe").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).
+				AddRow(42, "John Doe", createdAt))
+
+		var account Account
+		err := mappedTable.InsertAndGetObject(ctx, map[string]interface{}{"name": "John Doe"}, &account)
+		require.NoError(t, err, "InsertAndGetObject should succeed")
+		assert.Equal(t, 42, account.ID)
+		assert.Equal(t, createdAt, account.CreatedAt, "Untagged field should be populated via RETURNING")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
 	t.Run("nil destination", func(t *testing.T) {
 		// 使用TestUser结构体
 		inputUser := TestUser{
@@ -372,6 +746,127 @@ func TestTable_InsertAndGetObject(t *testing.T) {
 	})
 }
 
+func TestTable_InsertOrGet(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	type Account struct {
+		ID    int    `db:"id,readonly"`
+		Name  string `db:"name"`
+		Email string `db:"email"`
+	}
+
+	upsertSQL := `INSERT INTO users \(name, email\) VALUES \(\$1, \$2\) ON CONFLICT \(email\) DO UPDATE SET email = users\.email RETURNING \*`
+
+	t.Run("inserts new row", func(t *testing.T) {
+		mock.ExpectQuery(upsertSQL).
+			WithArgs("John", "john@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).
+				AddRow(1, "John", "john@example.com"))
+
+		var got Account
+		err := table.InsertOrGet(ctx, []string{"email"}, Account{Name: "John", Email: "john@example.com"}, &got)
+		require.NoError(t, err, "InsertOrGet should succeed")
+		assert.Equal(t, Account{ID: 1, Name: "John", Email: "john@example.com"}, got)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("conflict returns existing row", func(t *testing.T) {
+		// 已存在的记录保持原有的 name，不会被新数据覆盖
+		mock.ExpectQuery(upsertSQL).
+			WithArgs("Johnny", "john@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).
+				AddRow(1, "John", "john@example.com"))
+
+		var got Account
+		err := table.InsertOrGet(ctx, []string{"email"}, Account{Name: "Johnny", Email: "john@example.com"}, &got)
+		require.NoError(t, err, "InsertOrGet should succeed")
+		assert.Equal(t, 1, got.ID)
+		assert.Equal(t, "John", got.Name)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("conflict key required", func(t *testing.T) {
+		var got Account
+		err := table.InsertOrGet(ctx, nil, Account{Name: "John"}, &got)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_InsertBatchReturning 测试InsertBatchReturning方法
+func TestTable_InsertBatchReturning(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	type Account struct {
+		ID    int    `db:"id,readonly"`
+		Name  string `db:"name"`
+		Email string `db:"email"`
+	}
+
+	t.Run("returns generated ids in insert order", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO users \(name, email\) VALUES \(\$1, \$2\), \(\$3, \$4\) RETURNING \*`).
+			WithArgs("John", "john@example.com", "Jane", "jane@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).
+				AddRow(1, "John", "john@example.com").
+				AddRow(2, "Jane", "jane@example.com"))
+
+		var inserted []Account
+		err := table.InsertBatchReturning(ctx, []interface{}{
+			Account{Name: "John", Email: "john@example.com"},
+			&Account{Name: "Jane", Email: "jane@example.com"},
+		}, &inserted)
+		require.NoError(t, err, "InsertBatchReturning should succeed")
+		require.Len(t, inserted, 2)
+		assert.Equal(t, 1, inserted[0].ID)
+		assert.Equal(t, "John", inserted[0].Name)
+		assert.Equal(t, 2, inserted[1].ID)
+		assert.Equal(t, "Jane", inserted[1].Name)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("maps with different key order", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO users \((name, email|email, name)\) VALUES \(\$1, \$2\), \(\$3, \$4\) RETURNING \*`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).
+				AddRow(3, "A", "a@example.com").
+				AddRow(4, "B", "b@example.com"))
+
+		var inserted []Account
+		err := table.InsertBatchReturning(ctx, []interface{}{
+			map[string]interface{}{"name": "A", "email": "a@example.com"},
+			map[string]interface{}{"email": "b@example.com", "name": "B"},
+		}, &inserted)
+		require.NoError(t, err)
+		assert.Len(t, inserted, 2)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("mismatched columns", func(t *testing.T) {
+		var inserted []Account
+		err := table.InsertBatchReturning(ctx, []interface{}{
+			map[string]interface{}{"name": "A", "email": "a@example.com"},
+			map[string]interface{}{"name": "B", "age": 3},
+		}, &inserted)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		var inserted Account
+		err := table.InsertBatchReturning(ctx, []interface{}{Account{Name: "A"}}, &inserted)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+
+	t.Run("empty data", func(t *testing.T) {
+		var inserted []Account
+		assert.NoError(t, table.InsertBatchReturning(ctx, nil, &inserted))
+		assert.Empty(t, inserted)
+	})
+}
+
 // TestTable_Update 测试Update方法
 func TestTable_Update(t *testing.T) {
 	table, mock, cleanup := setupTableTest(t)
@@ -415,34 +910,403 @@ func TestTable_Update(t *testing.T) {
 			"name": "New Name",
 		}
 
-		// 执行测试
-		affected, err := table.Update(ctx, whereClause, whereArgs, updateData)
-		assert.NoError(t, err, "Update should succeed even with no rows affected")
-		assert.Equal(t, int64(0), affected, "Should affect 0 rows")
+		// 执行测试
+		affected, err := table.Update(ctx, whereClause, whereArgs, updateData)
+		assert.NoError(t, err, "Update should succeed even with no rows affected")
+		assert.Equal(t, int64(0), affected, "Should affect 0 rows")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		// 设置期望
+		mock.ExpectExec("UPDATE users SET .*").
+			WillReturnError(errors.New("update error"))
+
+		// 准备测试数据
+		whereClause := "id = $1"
+		whereArgs := map[string]interface{}{
+			"1": 1,
+		}
+		updateData := map[string]interface{}{
+			"email": "invalid@email",
+		}
+
+		// 执行测试
+		affected, err := table.Update(ctx, whereClause, whereArgs, updateData)
+		assert.Error(t, err, "Update should return error")
+		assert.Equal(t, int64(0), affected, "Affected rows should be 0 on error")
+		assert.Contains(t, err.Error(), "update error")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+}
+
+// TestTable_InsertAndGetTypedColumns 测试InsertAndGetTypedColumns方法
+func TestTable_InsertAndGetTypedColumns(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	user := TestUser{Name: "John Doe", Email: "john@example.com", Age: 30}
+
+	t.Run("scan into typed destinations", func(t *testing.T) {
+		createdAt := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING created_at, id$`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "id"}).AddRow(createdAt, int64(123)))
+
+		var id int64
+		var created time.Time
+		err := table.InsertAndGetTypedColumns(ctx, user, map[string]interface{}{
+			"id":         &id,
+			"created_at": &created,
+		})
+		assert.NoError(t, err, "InsertAndGetTypedColumns should succeed")
+		assert.Equal(t, int64(123), id)
+		assert.True(t, createdAt.Equal(created), "created_at should be scanned as time.Time")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("non-pointer destination", func(t *testing.T) {
+		var id int64
+		err := table.InsertAndGetTypedColumns(ctx, user, map[string]interface{}{"id": id})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+
+	t.Run("no columns", func(t *testing.T) {
+		err := table.InsertAndGetTypedColumns(ctx, user, nil)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_WithReturningValidation 测试RETURNING列校验
+func TestTable_WithReturningValidation(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	validated := table.WithReturningValidation()
+	user := TestUser{Name: "John Doe", Email: "john@example.com", Age: 30}
+
+	expectColumns := func() {
+		mock.ExpectQuery(`FROM information_schema.columns`).
+			WithArgs("users").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}).
+				AddRow("id", "int8", "NO", nil).
+				AddRow("name", "text", "NO", nil).
+				AddRow("created_at", "timestamptz", "NO", "now()"))
+	}
+
+	t.Run("unknown return column", func(t *testing.T) {
+		expectColumns()
+
+		_, err := validated.InsertAndGetMultipleColumns(ctx, user, []string{"id", "craeted_at"})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "unknown return column craeted_at for table users")
+		assert.NoError(t, mock.ExpectationsWereMet(), "INSERT should not be executed")
+	})
+
+	t.Run("columns are cached", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING created_at, id$`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"created_at", "id"}).AddRow(time.Now(), 1))
+
+		var id int64
+		var createdAt time.Time
+		err := validated.InsertAndGetTypedColumns(ctx, user, map[string]interface{}{"id": &id, "created_at": &createdAt})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet(), "Column list should come from the cache")
+	})
+
+	t.Run("struct destination", func(t *testing.T) {
+		type result struct {
+			ID       int64  `db:"id"`
+			Nickname string `db:"nickname"`
+		}
+		// 缓存未命中时重新加载一次列清单，仍不存在才报错
+		expectColumns()
+
+		var dest result
+		err := validated.InsertAndGetObject(ctx, user, &dest)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "unknown return column nickname")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("stale cache is reloaded once", func(t *testing.T) {
+		// 列在本包之外新增（如其他进程的迁移），缓存中没有 updated_at
+		mock.ExpectQuery(`FROM information_schema.columns`).
+			WithArgs("users").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}).
+				AddRow("id", "int8", "NO", nil).
+				AddRow("updated_at", "timestamptz", "YES", nil))
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING updated_at$`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+
+		_, err := validated.InsertAndGetMultipleColumns(ctx, user, []string{"updated_at"})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Schema.AlterTable invalidates cache", func(t *testing.T) {
+		mock.ExpectExec(`ALTER TABLE users ADD COLUMN score INTEGER`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		require.NoError(t, Schema{DB: table.DB}.AlterTable(ctx, "users", []string{"ADD COLUMN score INTEGER"}))
+
+		mock.ExpectQuery(`FROM information_schema.columns`).
+			WithArgs("users").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}).
+				AddRow("id", "int8", "NO", nil).
+				AddRow("score", "int4", "YES", nil))
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING score$`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"score"}).AddRow(0))
+
+		_, err := validated.InsertAndGetMultipleColumns(ctx, user, []string{"score"})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet(), "Columns should be reloaded after AlterTable")
+	})
+
+	t.Run("schema-qualified table", func(t *testing.T) {
+		qualified := (&Table{DB: table.DB, name: "sales.orders"}).WithReturningValidation()
+		mock.ExpectQuery(`FROM information_schema.columns\s+WHERE table_name = \$1 AND table_schema = \$2`).
+			WithArgs("orders", "sales").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}).
+				AddRow("id", "int8", "NO", nil).
+				AddRow("name", "text", "NO", nil))
+
+		err := qualified.checkReturnColumns(ctx, []string{"id", "name"})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("AddColumn invalidates cache", func(t *testing.T) {
+		mock.ExpectExec(`ALTER TABLE users ADD COLUMN nickname TEXT`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		require.NoError(t, validated.AddColumn(ctx, types.ColumnDefinition{Name: "nickname", Type: "TEXT", Nullable: true}))
+
+		mock.ExpectQuery(`FROM information_schema.columns`).
+			WithArgs("users").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "is_nullable", "column_default"}).
+				AddRow("id", "int8", "NO", nil).
+				AddRow("nickname", "text", "YES", nil))
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING nickname$`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"nickname"}).AddRow("jd"))
+
+		result, err := validated.InsertAndGetMultipleColumns(ctx, user, []string{"nickname"})
+		assert.NoError(t, err)
+		assert.Equal(t, "jd", result["nickname"])
+		assert.NoError(t, mock.ExpectationsWereMet(), "Columns should be reloaded after AddColumn")
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO users \(.*\) VALUES \(.*\) RETURNING anything$`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"anything"}).AddRow(1))
+
+		_, err := table.InsertAndGetMultipleColumns(ctx, user, []string{"anything"})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestTable_UpdateFrom 测试UpdateFrom方法
+func TestTable_UpdateFrom(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("update from another table", func(t *testing.T) {
+		expected := "UPDATE users SET email = s.email, name = $1, updated_at = NOW() FROM staging_users s " +
+			"WHERE users.id = s.id AND s.batch_id = $2"
+		mock.ExpectExec("^"+regexp.QuoteMeta(expected)+"$").
+			WithArgs("imported", 42).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+
+		affected, err := table.UpdateFrom(ctx, map[string]interface{}{
+			"email":      Raw("s.email"),
+			"name":       "imported",
+			"updated_at": Raw("NOW()"),
+		}, "staging_users s", "users.id = s.id AND s.batch_id = :batch_id", map[string]interface{}{"batch_id": 42})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("set value and where argument with the same name", func(t *testing.T) {
+		mock.ExpectExec(`^UPDATE users SET age = \$1 FROM teams t WHERE users.team_id = t.id AND t.age = \$2$`).
+			WithArgs(30, 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := table.UpdateFrom(ctx, map[string]interface{}{"age": 30},
+			"teams t", "users.team_id = t.id AND t.age = :age", map[string]interface{}{"age": 5})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("requires WHERE clause", func(t *testing.T) {
+		_, err := table.UpdateFrom(ctx, map[string]interface{}{"name": "x"}, "staging_users s", "", nil)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_UpdateStruct 测试UpdateStruct方法
+func TestTable_UpdateStruct(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	type Profile struct {
+		ID    int    `db:"id,readonly"`
+		Name  string `db:"name"`
+		Email string `db:"email,omitempty"`
+		Age   int    `db:"age,omitempty"`
+	}
+
+	t.Run("set from struct", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE users SET name = \$1, email = \$2, age = \$3 WHERE id = \$4 AND tenant_id = \$5`).
+			WithArgs("Jane", "jane@example.com", 31, 7, "acme").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		affected, err := table.UpdateStruct(ctx,
+			map[string]interface{}{"tenant_id": "acme", "id": 7},
+			&Profile{ID: 7, Name: "Jane", Email: "jane@example.com", Age: 31})
+		assert.NoError(t, err, "UpdateStruct should succeed")
+		assert.Equal(t, int64(1), affected)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("omitempty skips zero values", func(t *testing.T) {
+		// email、age 为零值且带 omitempty，不出现在 SET 中；name 无 omitempty，即使为空也会更新
+		mock.ExpectExec(`UPDATE users SET name = \$1 WHERE deleted_at IS NULL AND id = \$2`).
+			WithArgs("", 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		affected, err := table.UpdateStruct(ctx,
+			map[string]interface{}{"id": 7, "deleted_at": nil},
+			Profile{})
+		assert.NoError(t, err, "UpdateStruct should succeed")
+		assert.Equal(t, int64(1), affected)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("where required", func(t *testing.T) {
+		_, err := table.UpdateStruct(ctx, nil, Profile{Name: "Jane"})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+
+	t.Run("non-struct data", func(t *testing.T) {
+		_, err := table.UpdateStruct(ctx, map[string]interface{}{"id": 1}, map[string]interface{}{"name": "Jane"})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_UpdateStructReturning 测试UpdateStructReturning方法
+func TestTable_UpdateStructReturning(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	type Profile struct {
+		ID   int    `db:"id,readonly"`
+		Name string `db:"name"`
+		Age  int    `db:"age,omitempty"`
+	}
+
+	t.Run("scan single row", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE users SET name = \$1 WHERE id = \$2 RETURNING \*`).
+			WithArgs("Jane", 7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "age"}).AddRow(7, "Jane", 31))
+
+		var updated Profile
+		err := table.UpdateStructReturning(ctx, map[string]interface{}{"id": 7}, Profile{Name: "Jane"}, &updated)
+		assert.NoError(t, err, "UpdateStructReturning should succeed")
+		assert.Equal(t, Profile{ID: 7, Name: "Jane", Age: 31}, updated)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("scan multiple rows", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE users SET name = \$1, age = \$2 WHERE tenant_id = \$3 RETURNING \*`).
+			WithArgs("Anon", 18, "acme").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "age"}).
+				AddRow(1, "Anon", 18).
+				AddRow(2, "Anon", 18))
+
+		var updated []Profile
+		err := table.UpdateStructReturning(ctx, map[string]interface{}{"tenant_id": "acme"},
+			&Profile{Name: "Anon", Age: 18}, &updated)
+		assert.NoError(t, err, "UpdateStructReturning should succeed")
+		assert.Equal(t, []Profile{{ID: 1, Name: "Anon", Age: 18}, {ID: 2, Name: "Anon", Age: 18}}, updated)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("no matching row", func(t *testing.T) {
+		mock.ExpectQuery(`UPDATE users SET name = \$1 WHERE id = \$2 RETURNING \*`).
+			WithArgs("Jane", 404).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "age"}))
+
+		var updated Profile
+		err := table.UpdateStructReturning(ctx, map[string]interface{}{"id": 404}, Profile{Name: "Jane"}, &updated)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		var updated Profile
+		err := table.UpdateStructReturning(ctx, map[string]interface{}{"id": 7}, Profile{Name: "Jane"}, updated)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_UpdateFields 测试UpdateFields方法
+func TestTable_UpdateFields(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	type Profile struct {
+		ID    int    `db:"id,readonly"`
+		Name  string `db:"name"`
+		Email string `db:"email,omitempty"`
+		Age   int    `db:"age,omitempty"`
+	}
+
+	t.Run("masked update", func(t *testing.T) {
+		// 只写入列出的列；age 虽为零值且带 omitempty，但被显式列出，仍然写入
+		mock.ExpectExec(`UPDATE users SET email = \$1, age = \$2 WHERE id = \$3$`).
+			WithArgs("jane@example.com", 0, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		affected, err := table.UpdateFields(ctx, map[string]interface{}{"id": 7},
+			&Profile{ID: 7, Name: "ignored", Email: "jane@example.com"}, []string{"email", "age"})
+		assert.NoError(t, err, "UpdateFields should succeed")
+		assert.Equal(t, int64(1), affected)
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
-	t.Run("update error", func(t *testing.T) {
-		// 设置期望
-		mock.ExpectExec("UPDATE users SET .*").
-			WillReturnError(errors.New("update error"))
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := table.UpdateFields(ctx, map[string]interface{}{"id": 7}, Profile{}, []string{"nickname"})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "field nickname not found")
+	})
 
-		// 准备测试数据
-		whereClause := "id = $1"
-		whereArgs := map[string]interface{}{
-			"1": 1,
-		}
-		updateData := map[string]interface{}{
-			"email": "invalid@email",
-		}
+	t.Run("readonly field", func(t *testing.T) {
+		_, err := table.UpdateFields(ctx, map[string]interface{}{"id": 7}, Profile{}, []string{"id"})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "read-only")
+	})
 
-		// 执行测试
-		affected, err := table.Update(ctx, whereClause, whereArgs, updateData)
-		assert.Error(t, err, "Update should return error")
-		assert.Equal(t, int64(0), affected, "Affected rows should be 0 on error")
-		assert.Contains(t, err.Error(), "update error")
-		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	t.Run("fields required", func(t *testing.T) {
+		_, err := table.UpdateFields(ctx, map[string]interface{}{"id": 7}, Profile{}, nil)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
 	})
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "No query should be executed for invalid input")
 }
 
 // TestTable_Delete 测试Delete方法
@@ -526,6 +1390,180 @@ func TestTable_Delete(t *testing.T) {
 	})
 }
 
+// TestTable_StrictUpdateDelete 测试UpdateStrict与DeleteStrict方法
+func TestTable_StrictUpdateDelete(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	where := map[string]interface{}{"id": 1}
+
+	t.Run("lenient variants return zero rows without error", func(t *testing.T) {
+		mock.ExpectExec(`^UPDATE users SET name = \$1 WHERE id = \$2$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`^DELETE FROM users WHERE id = \$1$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		affected, err := table.Update(ctx, "id = :id", map[string]interface{}{"id": 1}, map[string]interface{}{"name": "x"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), affected)
+
+		affected, err = table.Delete(ctx, "id = :id", where)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("strict variants return ErrRecordNotFound", func(t *testing.T) {
+		mock.ExpectExec(`^UPDATE users SET name = \$1 WHERE id = \$2$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`^DELETE FROM users WHERE id = \$1$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		affected, err := table.UpdateStrict(ctx, "id = :id", map[string]interface{}{"id": 1}, map[string]interface{}{"name": "x"})
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+		assert.Equal(t, int64(0), affected)
+
+		affected, err = table.DeleteStrict(ctx, "id = :id", where)
+		assert.ErrorIs(t, err, ErrRecordNotFound)
+		assert.Equal(t, int64(0), affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("strict variants succeed when rows match", func(t *testing.T) {
+		mock.ExpectExec(`^UPDATE users SET name = \$1 WHERE id = \$2$`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`^DELETE FROM users WHERE id = \$1$`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		affected, err := table.UpdateStrict(ctx, "id = :id", map[string]interface{}{"id": 1}, map[string]interface{}{"name": "x"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), affected)
+
+		affected, err = table.DeleteStrict(ctx, "id = :id", where)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("strict variants keep execution errors", func(t *testing.T) {
+		mock.ExpectExec(`^DELETE FROM users`).WillReturnError(errors.New("connection reset"))
+
+		_, err := table.DeleteStrict(ctx, "id = :id", where)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrRecordNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestTable_DeleteUsing 测试DeleteUsing方法
+func TestTable_DeleteUsing(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("delete using join", func(t *testing.T) {
+		mock.ExpectExec(`^DELETE FROM users USING banned_emails b WHERE users.email = b.email AND b.reason = \$1$`).
+			WithArgs("spam").
+			WillReturnResult(sqlmock.NewResult(0, 4))
+
+		affected, err := table.DeleteUsing(ctx, "banned_emails b",
+			"users.email = b.email AND b.reason = :reason", map[string]interface{}{"reason": "spam"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no arguments", func(t *testing.T) {
+		mock.ExpectExec(`^DELETE FROM users USING accounts a WHERE users.account_id = a.id AND a.closed$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		affected, err := table.DeleteUsing(ctx, "accounts a", "users.account_id = a.id AND a.closed", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("requires WHERE clause", func(t *testing.T) {
+		_, err := table.DeleteUsing(ctx, "accounts a", "", nil)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_Count 测试Count方法
+func TestTable_Count(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("full table", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM users$`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+
+		count, err := table.Count(ctx, "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(12), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM users WHERE \(age >= \$1 OR name = \$2\)$`).
+			WithArgs(18, "admin").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+		count, err := table.Count(ctx, "age >= :min_age OR name = :name",
+			map[string]interface{}{"min_age": 18, "name": "admin"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("excludes soft deleted rows", func(t *testing.T) {
+		mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM users WHERE \(age > \$1\) AND deleted_at IS NULL$`).
+			WithArgs(30).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+		count, err := table.SetSoftDeleteColumn("deleted_at").Count(ctx, "age > :age", map[string]interface{}{"age": 30})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("missing named argument", func(t *testing.T) {
+		_, err := table.Count(ctx, "age > :age", nil)
+		assert.Error(t, err)
+	})
+}
+
+// TestTable_DeleteByIDs 测试DeleteByIDs方法
+func TestTable_DeleteByIDs(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("delete multiple ids", func(t *testing.T) {
+		mock.ExpectExec(`DELETE FROM users WHERE id IN \(\$1, \$2, \$3\)`).
+			WithArgs(1, 2, 3).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+
+		affected, err := table.DeleteByIDs(ctx, "id", []interface{}{1, 2, 3})
+		assert.NoError(t, err, "DeleteByIDs should succeed")
+		assert.Equal(t, int64(3), affected, "Should affect 3 rows")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("empty ids", func(t *testing.T) {
+		// 不应执行任何SQL
+		affected, err := table.DeleteByIDs(ctx, "id", nil)
+		assert.NoError(t, err, "DeleteByIDs should be a no-op")
+		assert.Equal(t, int64(0), affected)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+}
+
 // TestTable_Query 测试Query方法
 func TestTable_Query(t *testing.T) {
 	table, _, cleanup := setupTableTest(t)
@@ -583,6 +1621,26 @@ func TestTable_AddColumn(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
+	t.Run("add generated column", func(t *testing.T) {
+		// 设置期望
+		mock.ExpectExec(`ALTER TABLE users ADD COLUMN full_name TEXT GENERATED ALWAYS AS \(first_name \|\| ' ' \|\| last_name\) STORED$`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// 准备测试数据
+		col := types.ColumnDefinition{
+			Name:            "full_name",
+			Type:            "TEXT",
+			Nullable:        true,
+			Generated:       "first_name || ' ' || last_name",
+			GeneratedStored: true,
+		}
+
+		// 执行测试
+		err := table.AddColumn(ctx, col)
+		assert.NoError(t, err, "AddColumn with generated expression should succeed")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
 	t.Run("add column error", func(t *testing.T) {
 		// 设置期望
 		mock.ExpectExec("ALTER TABLE users ADD COLUMN").
@@ -722,6 +1780,45 @@ func TestTable_CreateIndex(t *testing.T) {
 		assert.Contains(t, err.Error(), "index already exists")
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
+
+	t.Run("generated name", func(t *testing.T) {
+		mock.ExpectExec("^CREATE UNIQUE INDEX uniq_users_tenant_id_email ON users \\(tenant_id, email\\)$").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := table.CreateIndex(ctx, "", []string{"tenant_id", "email"}, true)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("custom naming strategy", func(t *testing.T) {
+		db := *table.DB
+		db.indexNaming = func(table string, columns []string, unique bool) string {
+			return table + "_" + strings.Join(columns, "_") + "_ix"
+		}
+		custom := *table
+		custom.DB = &db
+
+		mock.ExpectExec("^CREATE INDEX users_name_ix ON users \\(name\\)$").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := custom.CreateIndex(ctx, "", []string{"name"}, false)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+}
+
+// TestDefaultIndexName 测试默认索引命名规则
+func TestDefaultIndexName(t *testing.T) {
+	assert.Equal(t, "idx_users_email", DefaultIndexName("users", []string{"email"}, false))
+	assert.Equal(t, "uniq_users_tenant_id_email", DefaultIndexName("users", []string{"tenant_id", "email"}, true))
+	assert.Equal(t, "idx_public_users_lower_email_created_at_desc",
+		DefaultIndexName("public.users", []string{"LOWER(email)", "created_at DESC"}, false))
+
+	columns := []string{"a_very_long_column_name_one", "a_very_long_column_name_two", "a_very_long_column_name_three"}
+	long := DefaultIndexName("events", columns, false)
+	assert.LessOrEqual(t, len(long), 63)
+	assert.NotEqual(t, long, DefaultIndexName("events", append(columns[:2:2], "a_very_long_column_name_four"), false),
+		"Truncated names should stay distinct")
 }
 
 // TestTable_DropIndex 测试DropIndex方法
@@ -844,6 +1941,44 @@ func TestTable_BulkUpsert(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
 	})
 
+	t.Run("upsert on named constraint", func(t *testing.T) {
+		// 设置期望 - ON CONFLICT ON CONSTRAINT，所有字段都参与更新
+		mock.ExpectExec("INSERT INTO users .* ON CONFLICT ON CONSTRAINT users_email_key DO UPDATE SET " +
+			"id = EXCLUDED.id, name = EXCLUDED.name, email = EXCLUDED.email, age = EXCLUDED.age$").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		users := []interface{}{
+			User{ID: 1, Name: "User1", Email: "user1@example.com", Age: 25},
+		}
+
+		// 执行测试
+		affected, err := table.BulkUpsertWithOptions(ctx, users, types.UpsertOptions{
+			ConflictConstraint: "users_email_key",
+		})
+		assert.NoError(t, err, "BulkUpsertWithOptions with constraint should succeed")
+		assert.Equal(t, int64(1), affected, "Should affect 1 row")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("upsert on partial unique index", func(t *testing.T) {
+		// 设置期望 - 索引谓词紧跟在冲突列之后
+		mock.ExpectExec(`INSERT INTO users .* ON CONFLICT \(email\) WHERE deleted_at IS NULL DO UPDATE SET ` +
+			"id = EXCLUDED.id, name = EXCLUDED.name, age = EXCLUDED.age$").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		users := []interface{}{
+			User{ID: 1, Name: "User1", Email: "user1@example.com", Age: 25},
+		}
+
+		affected, err := table.BulkUpsertWithOptions(ctx, users, types.UpsertOptions{
+			ConflictColumns: []string{"email"},
+			ConflictWhere:   "deleted_at IS NULL",
+		})
+		assert.NoError(t, err, "BulkUpsertWithOptions with index predicate should succeed")
+		assert.Equal(t, int64(1), affected, "Should affect 1 row")
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
 	t.Run("upsert error", func(t *testing.T) {
 		// 设置期望
 		mock.ExpectExec("INSERT INTO users").
@@ -883,6 +2018,192 @@ func TestTable_BulkUpsert(t *testing.T) {
 		assert.Equal(t, int64(0), affected, "Affected rows should be 0 on error")
 		assert.Contains(t, err.Error(), "invalid table structure")
 	})
+
+	t.Run("map records with conflict key", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO users \(email, name\) VALUES \(\$1, \$2\), \(\$3, \$4\) ON CONFLICT \(email\) DO UPDATE SET name = EXCLUDED\.name`).
+			WithArgs("a@example.com", "A", "b@example.com", "B").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		affected, err := table.BulkUpsert(ctx, []string{"email"}, []interface{}{
+			map[string]interface{}{"name": "A", "email": "a@example.com"},
+			map[string]interface{}{"email": "b@example.com", "name": "B"},
+		})
+		require.NoError(t, err, "BulkUpsert with maps should succeed")
+		assert.Equal(t, int64(2), affected)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("sorted by conflict key", func(t *testing.T) {
+		type Account struct {
+			TenantID int    `db:"tenant_id"`
+			Email    string `db:"email"`
+			Name     string `db:"name"`
+		}
+
+		// 参数顺序按 (tenant_id, email) 排序，而不是传入顺序
+		mock.ExpectExec(`INSERT INTO users \(tenant_id, email, name\) VALUES \(\$1, \$2, \$3\), \(\$4, \$5, \$6\), \(\$7, \$8, \$9\) `+
+			`ON CONFLICT \(tenant_id, email\) DO UPDATE SET name = EXCLUDED\.name`).
+			WithArgs(
+				1, "a@example.com", "A",
+				1, "c@example.com", "C",
+				2, "b@example.com", "B",
+			).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+
+		affected, err := table.BulkUpsertWithOptions(ctx, []interface{}{
+			Account{TenantID: 2, Email: "b@example.com", Name: "B"},
+			Account{TenantID: 1, Email: "c@example.com", Name: "C"},
+			&Account{TenantID: 1, Email: "a@example.com", Name: "A"},
+		}, types.UpsertOptions{ConflictColumns: []string{"tenant_id", "email"}, SortByConflictKey: true})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), affected)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("sorting requires conflict columns", func(t *testing.T) {
+		_, err := table.BulkUpsertWithOptions(ctx, []interface{}{
+			map[string]interface{}{"id": 1},
+		}, types.UpsertOptions{ConflictConstraint: "users_pkey", SortByConflictKey: true})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_Merge 测试Merge方法
+func TestTable_Merge(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("composed MERGE statement", func(t *testing.T) {
+		expected := "MERGE INTO users USING staging_users s ON users.id = s.id AND s.batch_id = $1" +
+			" WHEN MATCHED AND s.deleted THEN DELETE" +
+			" WHEN MATCHED THEN UPDATE SET name = s.name, email = s.email" +
+			" WHEN NOT MATCHED AND NOT s.deleted THEN INSERT (id, name, email) VALUES (s.id, s.name, s.email)"
+		mock.ExpectExec("^" + regexp.QuoteMeta(expected) + "$").
+			WithArgs(42).
+			WillReturnResult(sqlmock.NewResult(0, 5))
+
+		affected, err := table.Merge(ctx, "staging_users s", "users.id = s.id AND s.batch_id = $1",
+			[]string{"AND s.deleted THEN DELETE", "UPDATE SET name = s.name, email = s.email"},
+			[]string{"AND NOT s.deleted THEN INSERT (id, name, email) VALUES (s.id, s.name, s.email)"},
+			42)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), affected)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("only not matched", func(t *testing.T) {
+		mock.ExpectExec(`^MERGE INTO users USING \(VALUES \(\$1, \$2\)\) AS v\(id, name\) ON users.id = v.id `+
+			`WHEN NOT MATCHED THEN INSERT \(id, name\) VALUES \(v.id, v.name\)$`).
+			WithArgs(1, "Alice").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := table.Merge(ctx, "(VALUES ($1, $2)) AS v(id, name)", "users.id = v.id",
+			nil, []string{"INSERT (id, name) VALUES (v.id, v.name)"}, 1, "Alice")
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("requires WHEN clause", func(t *testing.T) {
+		_, err := table.Merge(ctx, "staging_users s", "users.id = s.id", nil, nil)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_BulkUpsertReturning 测试BulkUpsertReturning方法
+func TestTable_BulkUpsertReturning(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	type upserted struct {
+		ID       int    `db:"id"`
+		Email    string `db:"email"`
+		Inserted bool   `db:"inserted"`
+	}
+	type account struct {
+		ID    int    `db:"id"`
+		Email string `db:"email"`
+	}
+
+	t.Run("inserted and updated rows", func(t *testing.T) {
+		mock.ExpectQuery(`^INSERT INTO users \(id, email\) VALUES \(\$1, \$2\), \(\$3, \$4\) `+
+			`ON CONFLICT \(id\) DO UPDATE SET email = EXCLUDED.email RETURNING \*, \(xmax = 0\) AS inserted$`).
+			WithArgs(1, "a@example.com", 2, "b@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "inserted"}).
+				AddRow(1, "a@example.com", false).
+				AddRow(2, "b@example.com", true))
+
+		var result []upserted
+		err := table.BulkUpsertReturning(ctx, []interface{}{
+			account{ID: 1, Email: "a@example.com"},
+			account{ID: 2, Email: "b@example.com"},
+		}, types.UpsertOptions{ConflictColumns: []string{"id"}, ReturnInserted: true}, &result)
+		require.NoError(t, err)
+		assert.Equal(t, []upserted{
+			{ID: 1, Email: "a@example.com", Inserted: false},
+			{ID: 2, Email: "b@example.com", Inserted: true},
+		}, result)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("without inserted flag", func(t *testing.T) {
+		mock.ExpectQuery(`ON CONFLICT \(id\) DO UPDATE SET email = EXCLUDED.email RETURNING \*$`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, "a@example.com"))
+
+		var result []account
+		err := table.BulkUpsertReturning(ctx, []interface{}{account{ID: 1, Email: "a@example.com"}},
+			types.UpsertOptions{ConflictColumns: []string{"id"}}, &result)
+		require.NoError(t, err)
+		assert.Len(t, result, 1)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		var result []account
+		err := table.BulkUpsertReturning(ctx, []interface{}{account{ID: 1}}, types.UpsertOptions{}, result)
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+	})
+}
+
+// TestTable_InsertMaps 测试InsertMaps方法
+func TestTable_InsertMaps(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("consistent maps", func(t *testing.T) {
+		mock.ExpectExec(`INSERT INTO users \(age, name\) VALUES \(\$1, \$2\), \(\$3, \$4\)$`).
+			WithArgs(20, "A", 30, "B").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		affected, err := table.InsertMaps(ctx, []map[string]interface{}{
+			{"name": "A", "age": 20},
+			{"age": 30, "name": "B"},
+		})
+		require.NoError(t, err, "InsertMaps should succeed")
+		assert.Equal(t, int64(2), affected)
+		assert.NoError(t, mock.ExpectationsWereMet(), "All expectations should be met")
+	})
+
+	t.Run("mismatched keys", func(t *testing.T) {
+		affected, err := table.InsertMaps(ctx, []map[string]interface{}{
+			{"name": "A", "age": 20},
+			{"name": "B", "email": "b@example.com"},
+		})
+		assert.ErrorIs(t, err, types.ErrInvalidStructure)
+		assert.Contains(t, err.Error(), "record 0 is missing column email")
+		assert.Equal(t, int64(0), affected)
+	})
+
+	t.Run("empty data", func(t *testing.T) {
+		affected, err := table.InsertMaps(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), affected)
+	})
 }
 
 // 测试缓存机制的辅助函数
@@ -904,7 +2225,7 @@ func TestGetStructFieldsWithCache(t *testing.T) {
 		structFieldsCache = sync.Map{}
 
 		// 执行测试
-		fields, err := getStructFieldsWithCache(user)
+		fields, err := getStructFieldsWithCache(user, nil)
 		assert.NoError(t, err, "getStructFieldsWithCache should succeed")
 		assert.Equal(t, 4, len(fields), "Should extract 4 fields")
 		assert.Contains(t, fields, "id", "Fields should contain id")
@@ -918,17 +2239,29 @@ func TestGetStructFieldsWithCache(t *testing.T) {
 	t.Run("second call with cache", func(t *testing.T) {
 		// 确保缓存已经被填充
 		// 执行测试
-		fields, err := getStructFieldsWithCache(user)
+		fields, err := getStructFieldsWithCache(user, nil)
 		assert.NoError(t, err, "getStructFieldsWithCache should succeed")
 		assert.Equal(t, 4, len(fields), "Should extract 4 fields with cache")
 	})
 
+	t.Run("field mapper uses separate cache entry", func(t *testing.T) {
+		// 同一类型在配置 mapper 后应包含未标记字段，且不影响无 mapper 的缓存
+		fields, err := getStructFieldsWithCache(user, SnakeCase)
+		assert.NoError(t, err, "getStructFieldsWithCache should succeed")
+		assert.Contains(t, fields, "ignored", "Untagged field should be mapped")
+		assert.NotContains(t, fields, "excluded", "Explicitly excluded field should stay excluded")
+
+		fields, err = getStructFieldsWithCache(user, nil)
+		assert.NoError(t, err)
+		assert.NotContains(t, fields, "ignored", "Cache without mapper should be unaffected")
+	})
+
 	t.Run("invalid type", func(t *testing.T) {
 		// 使用非结构体类型
 		invalidData := "not a struct"
 
 		// 执行测试
-		fields, err := getStructFieldsWithCache(invalidData)
+		fields, err := getStructFieldsWithCache(invalidData, nil)
 		assert.Error(t, err, "getStructFieldsWithCache should fail for non-struct type")
 		assert.Contains(t, err.Error(), "invalid table structure")
 		assert.Nil(t, fields, "Fields should be nil for invalid type")
@@ -959,7 +2292,7 @@ func TestExtractValuesWithCache(t *testing.T) {
 		fieldValuesCache = sync.Map{}
 
 		// 执行测试
-		values, err := extractValuesWithCache(user, fields)
+		values, err := extractValuesWithCache(user, fields, nil)
 		assert.NoError(t, err, "extractValuesWithCache should succeed")
 		assert.Equal(t, 4, len(values), "Should extract 4 values")
 		assert.Equal(t, 1, values[0], "First value should be ID")
@@ -971,7 +2304,7 @@ func TestExtractValuesWithCache(t *testing.T) {
 	t.Run("second call with cache", func(t *testing.T) {
 		// 确保缓存已经被填充
 		// 执行测试
-		values, err := extractValuesWithCache(user, fields)
+		values, err := extractValuesWithCache(user, fields, nil)
 		assert.NoError(t, err, "extractValuesWithCache should succeed with cache")
 		assert.Equal(t, 4, len(values), "Should extract 4 values with cache")
 	})
@@ -981,7 +2314,7 @@ func TestExtractValuesWithCache(t *testing.T) {
 		fieldsWithMissing := []string{"id", "name", "email", "age", "nonexistent"}
 
 		// 执行测试
-		values, err := extractValuesWithCache(user, fieldsWithMissing)
+		values, err := extractValuesWithCache(user, fieldsWithMissing, nil)
 		assert.NoError(t, err, "extractValuesWithCache should handle missing fields")
 		assert.Equal(t, 5, len(values), "Should extract 5 values")
 		assert.Nil(t, values[4], "Value for nonexistent field should be nil")
@@ -992,7 +2325,7 @@ func TestExtractValuesWithCache(t *testing.T) {
 		invalidData := "not a struct"
 
 		// 执行测试
-		values, err := extractValuesWithCache(invalidData, fields)
+		values, err := extractValuesWithCache(invalidData, fields, nil)
 		assert.Error(t, err, "extractValuesWithCache should fail for non-struct type")
 		assert.Contains(t, err.Error(), "invalid table structure")
 		assert.Nil(t, values, "Values should be nil for invalid type")
@@ -1001,6 +2334,18 @@ func TestExtractValuesWithCache(t *testing.T) {
 
 // 测试辅助函数
 func TestHelperFunctions(t *testing.T) {
+	t.Run("compareValues", func(t *testing.T) {
+		earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		id := 3
+		assert.Equal(t, -1, compareValues(1, 2))
+		assert.Equal(t, 1, compareValues(int64(10), int32(2)), "Different int kinds compare numerically")
+		assert.Equal(t, 0, compareValues(&id, 3), "Pointers are dereferenced")
+		assert.Equal(t, -1, compareValues("a", "b"))
+		assert.Equal(t, -1, compareValues(earlier, earlier.Add(time.Second)))
+		assert.Equal(t, -1, compareValues(nil, 1), "nil sorts first")
+		assert.Equal(t, 1, compareValues(2.5, 1.5))
+	})
+
 	t.Run("buildPlaceholderTemplate", func(t *testing.T) {
 		tests := []struct {
 			fieldCount int
@@ -1020,6 +2365,62 @@ func TestHelperFunctions(t *testing.T) {
 		}
 	})
 
+	t.Run("decodeArrayValue", func(t *testing.T) {
+		v, ok := decodeArrayValue("_float8", []byte("{1.5,2}"))
+		assert.True(t, ok)
+		assert.Equal(t, []float64{1.5, 2}, v)
+
+		v, ok = decodeArrayValue("_BOOL", []byte("{t,f}"))
+		assert.True(t, ok)
+		assert.Equal(t, []bool{true, false}, v)
+
+		_, ok = decodeArrayValue("TEXT", []byte("plain"))
+		assert.False(t, ok, "Non-array types should not be decoded")
+
+		_, ok = decodeArrayValue("_INT8", []byte("not-an-array"))
+		assert.False(t, ok, "Malformed arrays should fall back")
+	})
+
+	t.Run("parseDBTag", func(t *testing.T) {
+		name, opts := parseDBTag("id")
+		assert.Equal(t, "id", name)
+		assert.False(t, opts.readonly)
+
+		name, opts = parseDBTag("id,readonly")
+		assert.Equal(t, "id", name)
+		assert.True(t, opts.readonly)
+
+		name, opts = parseDBTag("total,generated")
+		assert.Equal(t, "total", name)
+		assert.True(t, opts.readonly)
+
+		name, opts = parseDBTag("email,omitempty")
+		assert.Equal(t, "email", name)
+		assert.True(t, opts.omitempty)
+
+		name, opts = parseDBTag("created_at,now")
+		assert.Equal(t, "created_at", name)
+		assert.True(t, opts.now)
+		assert.False(t, opts.readonly)
+	})
+
+	t.Run("buildConflictTarget", func(t *testing.T) {
+		assert.Equal(t, "", buildConflictTarget(types.UpsertOptions{}))
+		assert.Equal(t, "(id, email)", buildConflictTarget(types.UpsertOptions{ConflictColumns: []string{"id", "email"}}))
+		assert.Equal(t, "ON CONSTRAINT users_email_key", buildConflictTarget(types.UpsertOptions{
+			ConflictColumns:    []string{"email"},
+			ConflictConstraint: "users_email_key",
+		}), "Constraint name should take precedence over columns")
+		assert.Equal(t, "(email) WHERE deleted_at IS NULL", buildConflictTarget(types.UpsertOptions{
+			ConflictColumns: []string{"email"},
+			ConflictWhere:   "deleted_at IS NULL",
+		}), "Index predicate should follow the conflict columns")
+		assert.Equal(t, "ON CONSTRAINT users_email_key", buildConflictTarget(types.UpsertOptions{
+			ConflictConstraint: "users_email_key",
+			ConflictWhere:      "deleted_at IS NULL",
+		}), "Index predicate is not valid with ON CONSTRAINT")
+	})
+
 	t.Run("buildUpdateClauses", func(t *testing.T) {
 		tests := []struct {
 			name        string
@@ -1123,6 +2524,18 @@ func TestGetStructFields(t *testing.T) {
 		assert.Contains(t, fields, "age", "Fields should contain age")
 	})
 
+	t.Run("getStructFields skips untagged fields", func(t *testing.T) {
+		type Mixed struct {
+			ID       int `db:"id"`
+			Internal string
+			Ignored  string `db:"-"`
+			Name     string `db:"name,omitempty"`
+		}
+		mixed := Mixed{ID: 1, Internal: "x", Ignored: "y", Name: "n"}
+		assert.Equal(t, []string{"id", "name"}, getStructFields(mixed))
+		assert.Equal(t, []interface{}{1, "n"}, getStructValues(mixed))
+	})
+
 	t.Run("getStructValues", func(t *testing.T) {
 		values := getStructValues(user)
 		assert.Equal(t, 4, len(values), "Should get 4 values from struct")
@@ -1134,3 +2547,49 @@ func TestGetStructFields(t *testing.T) {
 		assert.Contains(t, values, 30, "Values should contain Age")
 	})
 }
+
+func TestTable_SoftDelete(t *testing.T) {
+	table, mock, cleanup := setupTableTest(t)
+	defer cleanup()
+
+	softTable := table.SetSoftDeleteColumn("deleted_at")
+
+	t.Run("filters deleted rows by default", func(t *testing.T) {
+		sql, _ := softTable.Query().ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE deleted_at IS NULL", sql)
+
+		sql, args := softTable.Query().Where("status = $1", "active").ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE (status = $1) AND deleted_at IS NULL", sql)
+		assert.Equal(t, []interface{}{"active"}, args)
+
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users WHERE deleted_at IS NULL`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		count, err := softTable.Query().Count(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("WithDeleted includes deleted rows", func(t *testing.T) {
+		sql, args := softTable.Query().Where("status = $1", "active").WithDeleted().ToSQL()
+		assert.Equal(t, "SELECT * FROM users WHERE status = $1", sql)
+		assert.Equal(t, []interface{}{"active"}, args)
+	})
+
+	t.Run("OnlyDeleted fetches deleted rows", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT \* FROM users WHERE \(id > \$1\) AND deleted_at IS NOT NULL`).
+			WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(11, "Alice"))
+
+		var users []User
+		err := softTable.Query().Where("id > $1", 10).OnlyDeleted().GetAll(context.Background(), &users)
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+	})
+
+	t.Run("table without soft delete column is unaffected", func(t *testing.T) {
+		sql, _ := table.Query().OnlyDeleted().ToSQL()
+		assert.Equal(t, "SELECT * FROM users", sql)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,41 @@
+// Package testhelper 提供基于 sqlmock 的测试辅助函数，便于在不连接真实数据库的情况下
+// 对构建在 postgresql_helper 之上的代码编写单元测试
+package testhelper
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+
+	postgresql_helper "github.com/songzhibin97/postgresql_helper"
+)
+
+// MockDSN NewMockDB 使用的DSN，DB 的名称为 test_db
+const MockDSN = "postgres://mock/test_db"
+
+// NewMockDB 创建连接到 sqlmock 的 DB，返回 mock 用于设置期望，以及关闭连接的清理函数
+// SQL 期望使用正则表达式匹配，与本库自身的测试方式一致
+func NewMockDB(t testing.TB) (*postgresql_helper.DB, sqlmock.Sqlmock, func()) {
+	t.Helper()
+
+	mockDB, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp),
+	)
+	if err != nil {
+		t.Fatalf("create mock database: %v", err)
+	}
+
+	config := postgresql_helper.DefaultDBConfig()
+	config.DSN = MockDSN
+	db, err := postgresql_helper.NewFromSQLX(sqlx.NewDb(mockDB, "postgres"), config)
+	if err != nil {
+		_ = mockDB.Close()
+		t.Fatalf("create helper database: %v", err)
+	}
+
+	cleanup := func() {
+		_ = db.Close()
+	}
+	return db, mock, cleanup
+}
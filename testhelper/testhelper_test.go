@@ -0,0 +1,55 @@
+package testhelper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMockDB(t *testing.T) {
+	db, mock, cleanup := NewMockDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	t.Run("query through table", func(t *testing.T) {
+		type user struct {
+			ID   int    `db:"id"`
+			Name string `db:"name"`
+		}
+
+		mock.ExpectQuery(`SELECT \* FROM users WHERE id = \$1`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Alice"))
+
+		var u user
+		err := db.Table(ctx, "users").Query().Where("id = $1", 1).Get(ctx, &u)
+		require.NoError(t, err)
+		assert.Equal(t, user{ID: 1, Name: "Alice"}, u)
+	})
+
+	t.Run("exec through table", func(t *testing.T) {
+		mock.ExpectExec(`DELETE FROM users WHERE id = \$1`).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		affected, err := db.Table(ctx, "users").Delete(ctx, "id = :id", map[string]interface{}{"id": 1})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), affected)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewMockDB_Cleanup(t *testing.T) {
+	db, mock, cleanup := NewMockDB(t)
+	mock.ExpectClose()
+
+	cleanup()
+
+	assert.NoError(t, mock.ExpectationsWereMet(), "cleanup should close the database")
+	assert.Error(t, db.Ping(context.Background()), "closed database should not be usable")
+}
@@ -25,6 +25,11 @@ type (
 		Index      bool        `json:"index"`
 		Check      string      `json:"check"`
 		ForeignKey *ForeignKey `json:"foreign_key"`
+
+		Generated       string `json:"generated"`        // 生成列表达式，渲染为 GENERATED ALWAYS AS (expr)
+		GeneratedStored bool   `json:"generated_stored"` // 是否为存储生成列 (STORED)
+
+		EnumValues []string `json:"enum_values"` // 枚举列的可选值（按定义顺序，由GetTableSchema填充），此时 Type 为枚举类型名
 	}
 
 	ForeignKey struct {
@@ -35,9 +40,50 @@ type (
 	}
 
 	TableSchema struct {
-		Name        string             `json:"name"`
-		Columns     []ColumnDefinition `json:"columns"`
-		IfNotExists bool               `json:"if_not_exists"`
+		Name              string             `json:"name"`
+		Columns           []ColumnDefinition `json:"columns"`
+		IfNotExists       bool               `json:"if_not_exists"`
+		Checks            []string           `json:"checks"`             // 表级CHECK约束，可引用多列
+		UniqueConstraints [][]string         `json:"unique_constraints"` // 表级复合唯一约束，如 (tenant_id, email)
+		Indexes           []IndexDefinition  `json:"indexes"`            // 表上的索引（由GetTableSchema填充）
+		Constraints       []TableConstraint  `json:"constraints"`        // 涉及多列或不涉及列的表级约束（由GetTableSchema填充）
+		StorageParams     map[string]string  `json:"storage_params"`     // 存储参数，生成 WITH (fillfactor=70, ...)，按参数名排序
+		Tablespace        string             `json:"tablespace"`         // 表空间，生成 TABLESPACE name
+	}
+
+	// TableConstraint 表级约束，单列CHECK仍记录在 ColumnDefinition.Check 中
+	TableConstraint struct {
+		Name       string   `json:"name"`
+		Type       string   `json:"type"`       // CHECK | UNIQUE
+		Columns    []string `json:"columns"`    // 约束涉及的列，按列序排列
+		Definition string   `json:"definition"` // pg_get_constraintdef 的输出，如 CHECK ((start_at < end_at))
+	}
+
+	IndexDefinition struct {
+		Name      string   `json:"name"`
+		Columns   []string `json:"columns"` // 索引列或表达式，保持定义中的顺序
+		Unique    bool     `json:"unique"`
+		Method    string   `json:"method"`    // btree | hash | gin | gist ...
+		Predicate string   `json:"predicate"` // 部分索引条件（WHERE之后的部分）
+	}
+
+	// TableStats 表的统计信息（来自系统目录的估算值）
+	TableStats struct {
+		EstimatedRows int64 `json:"estimated_rows" db:"estimated_rows"` // 估算行数（pg_class.reltuples，未分析过的表为0）
+		TotalBytes    int64 `json:"total_bytes" db:"total_bytes"`       // 含索引和TOAST的总占用字节数
+	}
+
+	// UpsertOptions 批量插入/更新的冲突处理选项
+	UpsertOptions struct {
+		ConflictColumns    []string `json:"conflict_columns"`    // ON CONFLICT (col, ...)
+		ConflictConstraint string   `json:"conflict_constraint"` // ON CONFLICT ON CONSTRAINT name，优先于ConflictColumns
+		// ConflictWhere 部分唯一索引的索引谓词，生成 ON CONFLICT (col, ...) WHERE predicate
+		// 仅与 ConflictColumns 一起生效（ON CONSTRAINT 不支持谓词）
+		ConflictWhere string `json:"conflict_where"`
+		// ReturnInserted 在 BulkUpsertReturning 的 RETURNING 中追加 (xmax = 0) AS inserted，区分插入与更新的行
+		ReturnInserted bool `json:"return_inserted"`
+		// SortByConflictKey 插入前按 ConflictColumns 的值排序，使并发 upsert 以一致顺序加锁，降低死锁概率
+		SortByConflictKey bool `json:"sort_by_conflict_key"`
 	}
 
 	QueryConfig struct {
@@ -50,6 +96,12 @@ type (
 		GroupBy      string   `json:"group_by"`
 		Having       string   `json:"having"`
 		ForUpdate    bool     `json:"for_update"`
+		// LockMode 行锁子句（如 SHARE、NO KEY UPDATE、KEY SHARE），设置时替代 ForUpdate
+		LockMode string `json:"lock_mode"`
+		// LockTables FOR UPDATE OF 限定加锁的表（或别名），为空时锁定查询涉及的所有表
+		LockTables []string `json:"lock_tables"`
+		// CursorDirection 未设置 OrderBy 时游标分页按键字段排序的默认方向（ASC/DESC），为空表示 ASC
+		CursorDirection string `json:"cursor_direction"`
 	}
 )
 
@@ -77,6 +129,22 @@ type PageResult struct {
 	HasNext bool `json:"has_next"`
 	// 是否有上一页
 	HasPrev bool `json:"has_prev"`
+	// 编码后的下一页游标，可直接返回给客户端（由 Query.Paginate 填充）
+	NextToken string `json:"next_token,omitempty"`
+	// 编码后的上一页游标，可直接返回给客户端（由 Query.Paginate 填充）
+	PrevToken string `json:"prev_token,omitempty"`
+	// 当前页第一行的游标（向前翻页），空页时为 nil（由 Query.GetPage 填充）
+	StartCursor *Cursor `json:"start_cursor,omitempty"`
+	// 当前页最后一行的游标（向后翻页），空页时为 nil（由 Query.GetPage 填充）
+	EndCursor *Cursor `json:"end_cursor,omitempty"`
+	// 页大小：请求的每页条数，未设置 LIMIT 时为本页行数（由 Query.GetPage 填充）
+	PageSize int `json:"page_size,omitempty"`
+}
+
+// OrderField 表示一个排序字段及其方向
+type OrderField struct {
+	Name      string `json:"name"`
+	Direction string `json:"direction"` // ASC 或 DESC（不区分大小写）
 }
 
 type CompositeCursor struct {
@@ -101,6 +169,11 @@ type Migration struct {
 	UpFn        MigrateFn  `json:"-"`           // 升级函数
 	DownFn      MigrateFn  `json:"-"`           // 回滚函数
 	AppliedAt   *time.Time `json:"applied_at"`  // 应用时间
+	Checksum    string     `json:"checksum"`    // 迁移内容校验和（SQL迁移自动计算），为空则不校验
+
+	// NonTransactional 为 true 时不在事务中执行 UpFn/DownFn
+	// 用于 CREATE INDEX CONCURRENTLY、ALTER TYPE ... ADD VALUE 等不能在事务中运行的语句
+	NonTransactional bool `json:"non_transactional"`
 }
 
 // MigrateFn 迁移函数类型
@@ -108,15 +181,22 @@ type MigrateFn func(ctx context.Context, db DB) error
 
 // MigrationResult 迁移执行结果
 type MigrationResult struct {
-	AppliedMigrations []Migration   `json:"applied_migrations"` // 已应用的迁移
-	CurrentVersion    int64         `json:"current_version"`    // 当前版本
-	Error             error         `json:"error,omitempty"`    // 错误信息（如果有）
-	StartVersion      int64         `json:"start_version"`      // 起始版本
-	EndVersion        int64         `json:"end_version"`        // 结束版本
-	ExecutionTime     time.Duration `json:"execution_time"`     // 执行时间
+	AppliedMigrations []Migration   `json:"applied_migrations"`            // 已应用的迁移
+	CurrentVersion    int64         `json:"current_version"`               // 当前版本
+	Error             error         `json:"error,omitempty"`               // 错误信息（如果有）
+	StartVersion      int64         `json:"start_version"`                 // 起始版本
+	EndVersion        int64         `json:"end_version"`                   // 结束版本
+	ExecutionTime     time.Duration `json:"execution_time"`                // 执行时间
+	TimedOutMigration *Migration    `json:"timed_out_migration,omitempty"` // 执行超时的迁移（如果有）
 }
 
 type (
+	// Cache 查询结果缓存，实现需并发安全
+	Cache interface {
+		Get(key string) (interface{}, bool)
+		Set(key string, value interface{}, ttl time.Duration)
+	}
+
 	DB interface {
 		// Table 获取表操作接口
 		Table(ctx context.Context, tableName string) Table
@@ -135,23 +215,38 @@ type (
 
 		// Query 原始SQL执行
 		Query(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+
+		// QueryNamed 原始SQL执行，name 作为指标的 collection 标签
+		QueryNamed(ctx context.Context, name string, query string, args ...interface{}) (*sqlx.Rows, error)
 	}
 
 	Schema interface {
 		// CreateTable 动态创建表
 		CreateTable(ctx context.Context, schema TableSchema) error
 
+		// CreateTableFromStruct 根据结构体字段推断列定义并创建表，pgtype 标签可覆盖推断的列类型
+		CreateTableFromStruct(ctx context.Context, tableName string, model interface{}) error
+
 		// AlterTable 修改表结构
 		AlterTable(ctx context.Context, tableName string, alterations []string) error
 
 		// DropTable 删除表
 		DropTable(ctx context.Context, tableName string, cascade bool) error
 
+		// TruncateTables 以单条 TRUNCATE ... CASCADE 语句清空多张表，restartIdentity 为 true 时重置自增序列
+		TruncateTables(ctx context.Context, tables []string, restartIdentity bool) error
+
 		// TableExists 检查表是否存在
 		TableExists(ctx context.Context, tableName string) (bool, error)
 
 		// GetTableSchema 获取表结构
 		GetTableSchema(ctx context.Context, tableName string) (*TableSchema, error)
+
+		// GetIndexes 获取表上的全部索引定义
+		GetIndexes(ctx context.Context, tableName string) ([]IndexDefinition, error)
+
+		// GetTableStats 获取表的估算行数和占用空间
+		GetTableStats(ctx context.Context, tableName string) (*TableStats, error)
 	}
 
 	Table interface {
@@ -176,7 +271,7 @@ type (
 		// RenameColumn 重命名列
 		RenameColumn(ctx context.Context, oldName, newName string) error
 
-		// CreateIndex 创建索引
+		// CreateIndex 创建索引，indexName 为空时按配置的命名规则自动生成
 		CreateIndex(ctx context.Context, indexName string, columns []string, unique bool) error
 
 		// DropIndex 删除索引
@@ -188,25 +283,107 @@ type (
 
 	Query interface {
 		Select(fields ...string) Query
+		// ClearWhere 返回清除 WHERE 条件及其参数的副本
+		ClearWhere() Query
+		// ClearOrder 返回清除 ORDER BY 的副本
+		ClearOrder() Query
+		// SelectAs 以 表达式 -> 别名 的映射设置查询字段，生成 expr AS alias（按表达式排序）
+		SelectAs(aliases map[string]string) Query
 		Where(conditions string, args ...interface{}) Query
 		OrderBy(fields string) Query
+		// OrderByFields 按结构化字段排序，生成 ORDER BY a ASC, b DESC
+		// 字段名须为普通标识符（可带表前缀），方向只能是 ASC 或 DESC，否则执行查询时返回错误
+		OrderByFields(fields []OrderField) Query
 		Limit(n int) Query
 		Offset(n int) Query
 		Join(joinClause string) Query
 		GroupBy(fields string) Query
+		// GroupByRollup 按 ROLLUP (fields...) 分组，生成逐级小计
+		GroupByRollup(fields ...string) Query
+		// GroupByGroupingSets 按 GROUPING SETS 分组，每个元素是一组分组列，空切片表示总计
+		GroupByGroupingSets(sets [][]string) Query
 		Having(conditions string) Query
 		ForUpdate() Query
+		// ForUpdateOf 添加 FOR UPDATE OF tables...，JOIN 查询中只锁定指定表的行
+		ForUpdateOf(tables ...string) Query
+		// ForShare 添加 FOR SHARE 共享锁；各锁方法互相覆盖，只渲染最后设置的一个
+		ForShare() Query
+		// ForNoKeyUpdate 添加 FOR NO KEY UPDATE，不阻塞引用该行的外键检查
+		ForNoKeyUpdate() Query
+		// ForKeyShare 添加 FOR KEY SHARE，仅阻止删除和修改键列
+		ForKeyShare() Query
+
+		// WhereExists 追加 EXISTS (subquery) 条件，与已有条件以AND组合
+		WhereExists(subquery string, args ...interface{}) Query
+		// WhereNotExists 追加 NOT EXISTS (subquery) 条件，与已有条件以AND组合
+		WhereNotExists(subquery string, args ...interface{}) Query
+		// WhereRaw 原样追加条件，与已有条件以AND组合
+		// 条件中可直接使用绝对编号的 $N 占位符（与已有参数连续编号），最终由构建阶段统一编号
+		WhereRaw(clause string, args ...interface{}) Query
+		// WhereNamed 使用 :name 命名参数追加条件，与已有条件以AND组合
+		WhereNamed(clause string, args map[string]interface{}) Query
+		// WhereNullSafeEq 追加 column IS NOT DISTINCT FROM value 条件，value 为 nil 时匹配 NULL
+		WhereNullSafeEq(column string, value interface{}) Query
+		// WhereFullText 追加 column @@ plainto_tsquery([language,] query) 全文检索条件，query 作为参数绑定
+		WhereFullText(column, query string, language ...string) Query
+		// OrderByRank 按 ts_rank(column, plainto_tsquery([language,] query)) 降序排序
+		OrderByRank(column, query string, language ...string) Query
+		// WhereIn 追加 column IN (...) 条件，values 为非空切片；参数无效时执行查询返回错误
+		// 值较多（超过 1000 个）时改为 column = ANY($n) 单个数组参数，避免超出参数数量上限
+		WhereIn(column string, values interface{}) Query
+		// WhereNotIn 追加 column NOT IN (...) 条件，values 为非空切片；参数无效时执行查询返回错误
+		WhereNotIn(column string, values interface{}) Query
+
+		// WithDeleted 包含已软删除的记录（仅对设置了软删除列的表生效）
+		WithDeleted() Query
+		// OnlyDeleted 只返回已软删除的记录（仅对设置了软删除列的表生效）
+		OnlyDeleted() Query
+
+		// Cached 启用结果缓存（需配置 DBConfig.Cache），GetAll 优先读取缓存，未命中时查询并写入
+		// 缓存失效由调用方负责
+		Cached(key string, ttl time.Duration) Query
+
+		// Union 合并两个查询的结果（UNION 去重），合并结果作为子查询，之后的条件、排序与游标分页作用于合并结果
+		Union(other Query) Query
+		// UnionAll 与 Union 相同，但保留重复行（UNION ALL）
+		UnionAll(other Query) Query
+
+		// Raw 在构建器的指标与上下文事务中执行手写SQL，切片指针 dest 接收多行，其他类型接收单行
+		Raw(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+
+		// Comment 在生成的查询前添加 /* tag */ 注释（清理注释定界符），便于在 pg_stat_activity 中识别
+		Comment(tag string) Query
+
+		// ToSQL 返回最终执行的SQL（占位符已统一编号为 $N）及参数，不执行查询
+		ToSQL() (string, []interface{})
 
 		Get(ctx context.Context, dest interface{}) error
 		GetAll(ctx context.Context, dest interface{}) error
+		// GetAllInto 将结果追加到 dest（*[]T）已有元素之后，容量足够时复用底层数组
+		// 复用缓冲区时先执行 buf = buf[:0]，否则保留上一次的结果
+		GetAllInto(ctx context.Context, dest interface{}) error
+
+		// GetJSON 查询单行单列的JSON结果（如 Select("json_agg(u) AS users")）并反序列化到 dest
+		// 结果为 NULL（例如 json_agg 没有输入行）时 dest 保持不变
+		GetJSON(ctx context.Context, dest interface{}) error
 		Count(ctx context.Context) (int64, error)
+		// CountDistinct 统计 COUNT(DISTINCT column)，沿用当前的 WHERE / JOIN 条件
+		CountDistinct(ctx context.Context, column string) (int64, error)
 		Exists(ctx context.Context) (bool, error)
 
+		// FindDuplicates 按 columns 分组查找重复记录（HAVING COUNT(*) > 1），结果扫描到 dest 切片
+		// 每行包含 columns 各列及重复次数 count，未设置 OrderBy 时按 count 降序
+		FindDuplicates(ctx context.Context, columns []string, dest interface{}) error
+
 		// WithCursor 应用游标分页
 		// keyField: 用于分页的键字段（通常是主键）
 		// cursor: 分页游标，可以是上一次查询返回的NextCursor或PrevCursor
 		WithCursor(keyField string, cursor *Cursor) Query
 
+		// DefaultCursorDirection 设置未指定 OrderBy 时游标分页的默认排序方向（"ASC" 或 "DESC"）
+		// 例如 DefaultCursorDirection("DESC") 可实现新记录在前的分页
+		DefaultCursorDirection(direction string) Query
+
 		// GetPage 执行分页查询并返回结果
 		// dest: 结果容器（应为切片指针）
 		// withCount: 是否计算总记录数（可能影响性能）
@@ -218,6 +395,13 @@ type (
 		// PageByKeyBefore 获取指定键值之前的分页
 		PageByKeyBefore(ctx context.Context, dest interface{}, keyField string, keyValue interface{}, limit int, withCount bool) (*PageResult, error)
 
+		// Paginate 按 keyField 键集分页：将不透明的 token 解码为游标（空 token 表示第一页），
+		// 读取一页数据到 dest，并在结果的 NextToken / PrevToken 中返回编码后的前后页游标
+		Paginate(ctx context.Context, dest interface{}, keyField string, token string, limit int) (*PageResult, error)
+
+		// ForEachPage 按键集分页逐页读取，dest 为切片指针（仅用于确定元素类型），fn 接收每页的 []T
+		ForEachPage(ctx context.Context, dest interface{}, keyField string, pageSize int, fn func(batch interface{}) error) error
+
 		WithCompositeCursor(cursor *CompositeCursor) Query
 	}
 )
@@ -239,12 +423,18 @@ type Migrator interface {
 	// MigrateDownTo 回滚到指定版本（含）
 	MigrateDownTo(ctx context.Context, targetVersion int64) (*MigrationResult, error)
 
+	// Redo 回滚最近一次迁移并重新应用
+	Redo(ctx context.Context) (*MigrationResult, error)
+
 	// GetCurrentVersion 获取当前迁移版本
 	GetCurrentVersion(ctx context.Context) (int64, error)
 
 	// GetAppliedMigrations 获取已应用的迁移列表
 	GetAppliedMigrations(ctx context.Context) ([]Migration, error)
 
+	// GetAppliedMigrationsRange 获取版本在 [from, to] 区间内的已应用迁移
+	GetAppliedMigrationsRange(ctx context.Context, from, to int64) ([]Migration, error)
+
 	// CreateMigrationsTable 创建迁移表（如果不存在）
 	CreateMigrationsTable(ctx context.Context) error
 }